@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"github.com/1f349/azalea"
 	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/dnssec"
 	"github.com/1f349/azalea/logger"
 	"github.com/1f349/azalea/resolver"
+	"github.com/1f349/azalea/secondary"
 	"github.com/1f349/azalea/server"
 	"github.com/1f349/azalea/server/api"
 	"github.com/1f349/mjwt"
@@ -17,6 +21,7 @@ import (
 	"github.com/oschwald/geoip2-golang"
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -89,15 +94,29 @@ func (s *serveCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...any) subcomm
 	}
 	wd := filepath.Dir(configPathAbs)
 
-	// load the MJWT RSA public key from a pem encoded file
-	mJwtVerify, err := mjwt.NewKeyStoreFromDir(afero.NewBasePathFs(afero.NewOsFs(), filepath.Join(wd, "keys")))
-	if err != nil {
-		logger.Logger.Fatal("Failed to load MJWT verifier public key", "file", filepath.Join(wd, "signer.public.pem"), "err", err)
-	}
-
-	db, err := azalea.InitDB(config.DB)
-	if err != nil {
-		logger.Logger.Fatal("Failed to open database", "err", err)
+	// secondary nameservers load zones from the primary instead of the database
+	var db *database.Queries
+	var sec *secondary.Secondary
+	var notifyReceiver server.NotifyReceiver
+	if config.Secondary.Primary != "" {
+		if config.Master {
+			logger.Logger.Fatal("The API cannot be enabled in secondary mode")
+		}
+		var zoneDir string
+		if config.Secondary.Dir != "" {
+			zoneDir = filepath.Join(wd, config.Secondary.Dir)
+			err = os.MkdirAll(zoneDir, 0700)
+			if err != nil {
+				logger.Logger.Fatal("Failed to create zone directory", "err", err)
+			}
+		}
+		sec = secondary.New(config.Secondary, zoneDir)
+		notifyReceiver = sec
+	} else {
+		db, err = azalea.InitDB(config.DB)
+		if err != nil {
+			logger.Logger.Fatal("Failed to open database", "err", err)
+		}
 	}
 
 	var openGeo *geoip2.Reader
@@ -110,7 +129,15 @@ func (s *serveCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...any) subcomm
 	}
 
 	geoRes := resolver.NewGeoResolver(openGeo, db)
-	res := resolver.NewResolver(config.Soa, db, geoRes)
+	aliasRes := resolver.NewAliasResolver(config.Alias.Upstream)
+	var res *resolver.Resolver
+	if sec != nil {
+		res = resolver.NewResolver(config.Soa, sec.Store(), geoRes, aliasRes)
+		logger.Logger.Info("Starting secondary", "primary", config.Secondary.Primary)
+		sec.Run()
+	} else {
+		res = resolver.NewResolver(config.Soa, db, geoRes, aliasRes)
+	}
 
 	dnsTcp, err := upg.Listen("tcp", config.Listen.Dns)
 	if err != nil {
@@ -121,18 +148,66 @@ func (s *serveCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...any) subcomm
 		logger.Logger.Fatal("Listen failed", "err", err)
 	}
 
-	dnsSrv := server.NewDnsServer(dnsTcp, dnsUdp, res)
-	logger.Logger.Info("Starting server", "addr", config.Listen.Dns)
+	var dnsTls net.Listener
+	if config.Listen.Dot != "" {
+		certLoader, err := server.NewCertLoader(filepath.Join(wd, config.Tls.Cert), filepath.Join(wd, config.Tls.Key))
+		if err != nil {
+			logger.Logger.Fatal("Failed to load TLS certificate", "err", err)
+		}
+		dotLn, err := upg.Listen("tcp", config.Listen.Dot)
+		if err != nil {
+			logger.Logger.Fatal("Listen failed", "err", err)
+		}
+		dnsTls = tls.NewListener(dotLn, &tls.Config{
+			GetCertificate: certLoader.GetCertificate,
+			NextProtos:     []string{"dot"},
+			MinVersion:     tls.VersionTLS12,
+		})
+	}
+
+	transferAcl, err := server.NewTransferAcl(config.Transfer)
+	if err != nil {
+		logger.Logger.Fatal("Invalid transfer config", "err", err)
+	}
+
+	// dynamic updates change the database so they are refused by secondaries
+	notifier := server.NewNotifier(config.Transfer)
+	var updater *server.Updater
+	if db != nil && len(config.Update) > 0 {
+		updatePolicy, err := server.NewUpdatePolicy(config.Update)
+		if err != nil {
+			logger.Logger.Fatal("Invalid update config", "err", err)
+		}
+		updater = server.NewUpdater(updatePolicy, db, notifier)
+	}
+
+	dnsSrv := server.NewDnsServer(dnsTcp, dnsUdp, dnsTls, res, transferAcl, notifyReceiver, updater)
+	logger.Logger.Info("Starting server", "addr", config.Listen.Dns, "dot", config.Listen.Dot)
 	dnsSrv.Run()
 
 	var apiSrv *http.Server
+	var keyManager *dnssec.Manager
 	if config.Master {
+		// load the MJWT RSA public key from a pem encoded file
+		mJwtVerify, err := mjwt.NewKeyStoreFromDir(afero.NewBasePathFs(afero.NewOsFs(), filepath.Join(wd, "keys")))
+		if err != nil {
+			logger.Logger.Fatal("Failed to load MJWT verifier public key", "file", filepath.Join(wd, "signer.public.pem"), "err", err)
+		}
+
 		lnApi, err := upg.Listen("tcp", config.Listen.Api)
 		if err != nil {
 			logger.Logger.Fatal("Listen failed", "err", err)
 		}
 
-		apiMux := api.NewApiServer(db, res, mJwtVerify, config.MetricsAuth)
+		// only the master runs the DNSSEC key rollovers
+		keyManager = dnssec.NewManager(db, config.Dnssec, config.Transfer)
+		err = keyManager.CheckSecondaries(context.Background())
+		if err != nil {
+			logger.Logger.Fatal("Invalid DNSSEC config", "err", err)
+		}
+		keyManager.Run()
+
+		apiMux := api.NewApiServer(db, res, notifier, keyManager, mJwtVerify, config.MetricsAuth)
 		apiSrv = &http.Server{
 			Handler:           apiMux,
 			ReadTimeout:       time.Minute,
@@ -179,9 +254,15 @@ func (s *serveCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...any) subcomm
 	})
 
 	dnsSrv.Close()
+	if sec != nil {
+		sec.Close()
+	}
 	if apiSrv != nil {
 		_ = apiSrv.Shutdown(context.Background())
 	}
+	if keyManager != nil {
+		keyManager.Close()
+	}
 
 	return subcommands.ExitSuccess
 }
@@ -1,17 +1,43 @@
 package conf
 
+import "time"
+
 type Conf struct {
-	Listen      ListenConf `yaml:"listen"`
-	DB          string     `yaml:"db"`
-	Master      bool       `yaml:"master"`
-	GeoIP       string     `yaml:"geoip"`
-	MetricsAuth string     `yaml:"metricsAuth"`
-	Soa         SoaConf    `yaml:"soa"`
+	Listen      ListenConf              `yaml:"listen"`
+	DB          string                  `yaml:"db"`
+	Master      bool                    `yaml:"master"`
+	GeoIP       string                  `yaml:"geoip"`
+	MetricsAuth string                  `yaml:"metricsAuth"`
+	Soa         SoaConf                 `yaml:"soa"`
+	Transfer    map[string]TransferConf `yaml:"transfer"`
+	Secondary   SecondaryConf           `yaml:"secondary"`
+	Dnssec      DnssecConf              `yaml:"dnssec"`
+	Tls         TlsConf                 `yaml:"tls"`
+	Alias       AliasConf               `yaml:"alias"`
+	Update      map[string]UpdateConf   `yaml:"update"`
 }
 
 type ListenConf struct {
 	Dns string `yaml:"dns"`
 	Api string `yaml:"api"`
+
+	// Dot is the optional DNS-over-TLS listen address, usually port 853
+	Dot string `yaml:"dot"`
+}
+
+// TlsConf contains the certificate used by the DNS-over-TLS listener, the files
+// are reloaded when they change
+type TlsConf struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// AliasConf configures how ALIAS records with targets outside the hosted zones
+// are resolved
+type AliasConf struct {
+	// Upstream is the address of the recursive resolver used for ALIAS targets
+	// outside the hosted zones, the port defaults to 53
+	Upstream string `yaml:"upstream"`
 }
 
 type SoaConf struct {
@@ -22,3 +48,83 @@ type SoaConf struct {
 	Expire  uint32   `yaml:"expire"`
 	Ttl     uint32   `yaml:"ttl"`
 }
+
+// TransferConf contains the zone transfer settings for a single zone, the map
+// key in Conf.Transfer is the zone name
+//
+// Secondaries cannot serve signed zones so DNSSEC cannot be enabled for zones
+// with transfer settings.
+type TransferConf struct {
+	// Allow is a list of IP addresses or CIDR prefixes which may request zone
+	// transfers
+	Allow []string `yaml:"allow"`
+
+	// Notify is a list of secondary nameserver addresses which are sent DNS
+	// NOTIFY messages when records in the zone change, the port defaults to 53
+	Notify []string `yaml:"notify"`
+}
+
+// UpdateConf contains a TSIG key which may send RFC 2136 dynamic updates and
+// the changes it is allowed to make, the map key in Conf.Update is the key name
+type UpdateConf struct {
+	// Algorithm is the TSIG algorithm used by the key, this defaults to
+	// hmac-sha256
+	Algorithm string `yaml:"algorithm"`
+
+	// Secret is the base64 encoded TSIG secret
+	Secret string `yaml:"secret"`
+
+	// Zones is the list of zones the key may update
+	Zones []string `yaml:"zones"`
+
+	// Names is an optional list of names the key may update, a name starting
+	// with "*." matches every name below it, every name in the zones can be
+	// updated if this is empty
+	Names []string `yaml:"names"`
+
+	// Types is an optional list of record types the key may update, every type
+	// can be updated if this is empty
+	Types []string `yaml:"types"`
+}
+
+// SecondaryConf configures a secondary nameserver which pulls zones from the
+// primary nameserver with zone transfers instead of reading the database,
+// location resolving records depend on the service locations stored in the
+// database so these are not supported by secondaries
+type SecondaryConf struct {
+	// Primary is the address of the primary nameserver, the port defaults to 53
+	Primary string `yaml:"primary"`
+
+	// Zones is the list of zones to transfer from the primary
+	Zones []string `yaml:"zones"`
+
+	// Dir is an optional directory used to store copies of the transferred
+	// zones, these are loaded on startup
+	Dir string `yaml:"dir"`
+}
+
+// DnssecConf contains the DNSSEC key rollover policy used for every signed zone
+type DnssecConf struct {
+	// ZskLifetime is how long a ZSK is used before a pre-publish rollover is
+	// started, zero disables automatic ZSK rollovers
+	ZskLifetime time.Duration `yaml:"zskLifetime"`
+
+	// KskLifetime is how long a KSK is used before a double-DS rollover is
+	// started, zero disables automatic KSK rollovers
+	KskLifetime time.Duration `yaml:"kskLifetime"`
+
+	// Propagation is how long a DNSKEY change takes to reach every resolver,
+	// this must be longer than the largest TTL in the zone plus the time taken
+	// for the secondaries to update
+	Propagation time.Duration `yaml:"propagation"`
+
+	// ParentDsTtl is how long to wait after the new DS record has been seen in
+	// the parent zone before the new KSK replaces the old KSK
+	ParentDsTtl time.Duration `yaml:"parentDsTtl"`
+
+	// DsResolver is the address of a recursive resolver which is asked for the
+	// DS records of new KSKs, the port defaults to 53. A KSK rollover waits in
+	// the ds-pending state until the new DS record is in the parent zone, if
+	// this is empty the DS record has to be confirmed using the ds-seen API.
+	DsResolver string `yaml:"dsResolver"`
+}
@@ -1,12 +1,14 @@
 package converters
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/1f349/azalea/models"
 	"github.com/miekg/dns"
 	"net"
 	"strconv"
+	"strings"
 )
 
 type ErrInvalidRecord struct {
@@ -95,4 +97,252 @@ var Converters = map[uint16]func(data []string) (models.RecordValue, error){
 			Target:   data[3],
 		}, nil
 	},
+	dns.TypeCAA: func(data []string) (models.RecordValue, error) {
+		if len(data) != 3 {
+			return nil, ErrInvalidSegmentCount
+		}
+		flag, err := strconv.ParseUint(data[0], 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		return &models.CAA{
+			Flag:  uint8(flag),
+			Tag:   data[1],
+			Value: data[2],
+		}, nil
+	},
+	dns.TypePTR: func(data []string) (models.RecordValue, error) {
+		if len(data) != 1 {
+			return nil, ErrInvalidSegmentCount
+		}
+		return &models.PTR{Ptr: data[0]}, nil
+	},
+	dns.TypeDNAME: func(data []string) (models.RecordValue, error) {
+		if len(data) != 1 {
+			return nil, ErrInvalidSegmentCount
+		}
+		return &models.DNAME{Target: data[0]}, nil
+	},
+	dns.TypeNAPTR: func(data []string) (models.RecordValue, error) {
+		if len(data) != 6 {
+			return nil, ErrInvalidSegmentCount
+		}
+		order, err := strconv.ParseUint(data[0], 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		preference, err := strconv.ParseUint(data[1], 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		return &models.NAPTR{
+			Order:       uint16(order),
+			Preference:  uint16(preference),
+			Flags:       data[2],
+			Service:     data[3],
+			Regexp:      data[4],
+			Replacement: data[5],
+		}, nil
+	},
+	dns.TypeSSHFP: func(data []string) (models.RecordValue, error) {
+		if len(data) != 3 {
+			return nil, ErrInvalidSegmentCount
+		}
+		algorithm, err := strconv.ParseUint(data[0], 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		fpType, err := strconv.ParseUint(data[1], 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		return &models.SSHFP{
+			Algorithm:   uint8(algorithm),
+			Type:        uint8(fpType),
+			FingerPrint: data[2],
+		}, nil
+	},
+	dns.TypeTLSA: func(data []string) (models.RecordValue, error) {
+		if len(data) != 4 {
+			return nil, ErrInvalidSegmentCount
+		}
+		usage, err := strconv.ParseUint(data[0], 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		selector, err := strconv.ParseUint(data[1], 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		matchingType, err := strconv.ParseUint(data[2], 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		return &models.TLSA{
+			Usage:        uint8(usage),
+			Selector:     uint8(selector),
+			MatchingType: uint8(matchingType),
+			Certificate:  data[3],
+		}, nil
+	},
+	dns.TypeDS: func(data []string) (models.RecordValue, error) {
+		if len(data) != 4 {
+			return nil, ErrInvalidSegmentCount
+		}
+		keyTag, err := strconv.ParseUint(data[0], 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		algorithm, err := strconv.ParseUint(data[1], 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		digestType, err := strconv.ParseUint(data[2], 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		return &models.DS{
+			KeyTag:     uint16(keyTag),
+			Algorithm:  uint8(algorithm),
+			DigestType: uint8(digestType),
+			Digest:     data[3],
+		}, nil
+	},
+	dns.TypeURI: func(data []string) (models.RecordValue, error) {
+		if len(data) != 3 {
+			return nil, ErrInvalidSegmentCount
+		}
+		priority, err := strconv.ParseUint(data[0], 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		weight, err := strconv.ParseUint(data[1], 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		return &models.URI{
+			Priority: uint16(priority),
+			Weight:   uint16(weight),
+			Target:   data[2],
+		}, nil
+	},
+	dns.TypeSVCB: func(data []string) (models.RecordValue, error) {
+		svcb, err := parseSvcb(data)
+		if err != nil {
+			return nil, err
+		}
+		return svcb, nil
+	},
+	dns.TypeHTTPS: func(data []string) (models.RecordValue, error) {
+		svcb, err := parseSvcb(data)
+		if err != nil {
+			return nil, err
+		}
+		return &models.HTTPS{SVCB: *svcb}, nil
+	},
+	models.TypeALIAS: func(data []string) (models.RecordValue, error) {
+		if len(data) != 1 {
+			return nil, ErrInvalidSegmentCount
+		}
+		return &models.ALIAS{Target: data[0]}, nil
+	},
+}
+
+// IsGeneric reports whether records of the type are stored using the RFC 3597
+// representation as there is no converter for the type
+func IsGeneric(t uint16) bool {
+	_, ok := Converters[t]
+	return !ok && models.AllowsGeneric(t)
+}
+
+// Generic returns the converter for a type stored using the RFC 3597
+// representation
+func Generic(t uint16) func(data []string) (models.RecordValue, error) {
+	return func(data []string) (models.RecordValue, error) {
+		if len(data) != 1 {
+			return nil, ErrInvalidSegmentCount
+		}
+		return models.ParseGeneric(t, data[0])
+	}
+}
+
+// parseSvcb parses the stored value shared by SVCB and HTTPS records
+func parseSvcb(data []string) (*models.SVCB, error) {
+	if len(data) != 3 {
+		return nil, ErrInvalidSegmentCount
+	}
+	priority, err := strconv.ParseUint(data[0], 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	params, err := models.ParseSvcParams(data[2])
+	if err != nil {
+		return nil, err
+	}
+	return &models.SVCB{
+		Priority: uint16(priority),
+		Target:   data[1],
+		Params:   params,
+	}, nil
+}
+
+// FromRR converts a dns.RR into the matching models.RecordValue
+func FromRR(rr dns.RR) (models.RecordValue, error) {
+	switch v := rr.(type) {
+	case *dns.NS:
+		return &models.NS{Ns: v.Ns}, nil
+	case *dns.A:
+		return &models.A{IP: v.A}, nil
+	case *dns.AAAA:
+		return &models.AAAA{IP: v.AAAA}, nil
+	case *dns.TXT:
+		return &models.TXT{Value: strings.Join(v.Txt, "")}, nil
+	case *dns.CNAME:
+		return &models.CNAME{Target: v.Target}, nil
+	case *dns.MX:
+		return &models.MX{Preference: v.Preference, Mx: v.Mx}, nil
+	case *dns.SRV:
+		return &models.SRV{Priority: v.Priority, Weight: v.Weight, Port: v.Port, Target: v.Target}, nil
+	case *dns.CAA:
+		return &models.CAA{Flag: v.Flag, Tag: strings.ToLower(v.Tag), Value: v.Value}, nil
+	case *dns.PTR:
+		return &models.PTR{Ptr: v.Ptr}, nil
+	case *dns.DNAME:
+		return &models.DNAME{Target: v.Target}, nil
+	case *dns.NAPTR:
+		return &models.NAPTR{Order: v.Order, Preference: v.Preference, Flags: v.Flags, Service: v.Service, Regexp: v.Regexp, Replacement: v.Replacement}, nil
+	case *dns.SSHFP:
+		return &models.SSHFP{Algorithm: v.Algorithm, Type: v.Type, FingerPrint: v.FingerPrint}, nil
+	case *dns.TLSA:
+		return &models.TLSA{Usage: v.Usage, Selector: v.Selector, MatchingType: v.MatchingType, Certificate: v.Certificate}, nil
+	case *dns.DS:
+		return &models.DS{KeyTag: v.KeyTag, Algorithm: v.Algorithm, DigestType: v.DigestType, Digest: v.Digest}, nil
+	case *dns.URI:
+		return &models.URI{Priority: v.Priority, Weight: v.Weight, Target: v.Target}, nil
+	case *dns.SVCB:
+		return models.SvcbFromRR(v)
+	case *dns.HTTPS:
+		svcb, err := models.SvcbFromRR(&v.SVCB)
+		if err != nil {
+			return nil, err
+		}
+		return &models.HTTPS{SVCB: *svcb}, nil
+	case *dns.PrivateRR:
+		if alias, ok := v.Data.(*models.ALIAS); ok {
+			return &models.ALIAS{Target: alias.Target}, nil
+		}
+	}
+	if IsGeneric(rr.Header().Rrtype) {
+		generic := new(dns.RFC3597)
+		err := generic.ToRFC3597(rr)
+		if err != nil {
+			return nil, err
+		}
+		data, err := hex.DecodeString(generic.Rdata)
+		if err != nil {
+			return nil, err
+		}
+		return &models.Generic{Type: rr.Header().Rrtype, Data: data}, nil
+	}
+	return nil, fmt.Errorf("unsupported record type %s", models.TypeToString(rr.Header().Rrtype))
 }
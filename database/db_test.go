@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// fakeHandler answers a query with the column names and rows, these are only
+// used by queries which return rows
+type fakeHandler func(query string, args []any) (columns []string, rows [][]driver.Value, err error)
+
+// fakeQuery is a query received by the fake database
+type fakeQuery struct {
+	query string
+	args  []any
+}
+
+// fakeDB is a database/sql driver which records the queries and answers them
+// with a handler, this checks the generated queries without a MySQL server
+type fakeDB struct {
+	mu        sync.Mutex
+	handle    fakeHandler
+	queries   []fakeQuery
+	lastId    int64
+	commits   int
+	rollbacks int
+}
+
+func newFakeDB(t *testing.T, handle fakeHandler) (*Queries, *fakeDB) {
+	t.Helper()
+	f := &fakeDB{handle: handle}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { _ = db.Close() })
+	return New(db), f
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{f}, nil }
+
+func (f *fakeDB) Driver() driver.Driver { return fakeDriver{f} }
+
+func (f *fakeDB) run(query string, named []driver.NamedValue) ([]string, [][]driver.Value, error) {
+	args := make([]any, 0, len(named))
+	for _, i := range named {
+		args = append(args, i.Value)
+	}
+	f.mu.Lock()
+	f.queries = append(f.queries, fakeQuery{query: query, args: args})
+	f.mu.Unlock()
+	if f.handle == nil {
+		return nil, nil, nil
+	}
+	return f.handle(query, args)
+}
+
+type fakeDriver struct{ f *fakeDB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d.f}, nil }
+
+type fakeConn struct{ f *fakeDB }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{c.f}, nil }
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows, err := c.f.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, _, err := c.f.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.lastId++
+	return fakeResult(c.f.lastId), nil
+}
+
+// fakeResult is the result of every exec, the insert IDs count up from one
+type fakeResult int64
+
+func (r fakeResult) LastInsertId() (int64, error) { return int64(r), nil }
+
+func (r fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeTx struct{ f *fakeDB }
+
+func (t fakeTx) Commit() error {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	t.f.commits++
+	return nil
+}
+
+func (t fakeTx) Rollback() error {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	t.f.rollbacks++
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var zoneColumns = []string{"id", "name", "serial", "default_ttl", "serial_scheme", "nameservers", "mbox", "refresh", "retry", "expire", "minimum"}
+
+// fakeZoneRow returns a zones row without SOA settings
+func fakeZoneRow(id int64, name string) []driver.Value {
+	return []driver.Value{id, name, int64(1), int64(300), "date", nil, nil, nil, nil, nil, nil}
+}
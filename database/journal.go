@@ -0,0 +1,198 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// journalLimit is the number of journal entries kept for each zone
+const journalLimit = 1000
+
+// AddZoneRecordWithJournal adds the record and records the change in the zone
+// journal
+func (q *Queries) AddZoneRecordWithJournal(ctx context.Context, arg AddZoneRecordParams) (int64, error) {
+	var id int64
+	err := q.Tx(ctx, nil, func(db *Queries) error {
+		var err error
+		id, err = db.AddZoneRecord(ctx, arg)
+		if err != nil {
+			return err
+		}
+		return db.journalChange(ctx, arg.Zone, nil, []Record{{
+			Zone:  arg.Zone,
+			Name:  arg.Name,
+			Type:  arg.Type,
+			Ttl:   arg.Ttl,
+			Value: arg.Value,
+		}})
+	})
+	return id, err
+}
+
+// PutZoneRecordByIdWithJournal replaces the record TTL and value and records
+// the change in the zone journal
+func (q *Queries) PutZoneRecordByIdWithJournal(ctx context.Context, arg PutZoneRecordByIdParams) error {
+	return q.Tx(ctx, nil, func(db *Queries) error {
+		old, err := db.GetZoneRecordById(ctx, GetZoneRecordByIdParams{Zone: arg.Zone, ID: arg.ID})
+		if err != nil {
+			return err
+		}
+		err = db.PutZoneRecordById(ctx, arg)
+		if err != nil {
+			return err
+		}
+		updated := old
+		updated.Ttl = arg.Ttl
+		updated.Value = arg.Value
+		return db.journalChange(ctx, arg.Zone, []Record{old}, []Record{updated})
+	})
+}
+
+// DeleteZoneRecordByIdWithJournal deletes the record and records the change in
+// the zone journal
+func (q *Queries) DeleteZoneRecordByIdWithJournal(ctx context.Context, arg DeleteZoneRecordByIdParams) error {
+	return q.Tx(ctx, nil, func(db *Queries) error {
+		old, err := db.GetZoneRecordById(ctx, GetZoneRecordByIdParams{Zone: arg.Zone, ID: arg.ID})
+		if err != nil {
+			return err
+		}
+		err = db.DeleteZoneRecordById(ctx, arg)
+		if err != nil {
+			return err
+		}
+		return db.journalChange(ctx, arg.Zone, []Record{old}, nil)
+	})
+}
+
+// UpdateZoneWithJournal passes the zone and its records to fn with the zone
+// row locked, the records deleted and added by fn are applied and recorded in
+// the zone journal in the same transaction, the serial is unchanged if fn does
+// not return any changes
+func (q *Queries) UpdateZoneWithJournal(ctx context.Context, zone string, fn func(zone Zone, records []Record) (deleted, added []Record, err error)) error {
+	return q.Tx(ctx, nil, func(db *Queries) error {
+		zoneRow, err := db.GetZone(ctx, zone)
+		if err != nil {
+			return err
+		}
+		// lock the zone row so the records can't change until the transaction
+		// is committed
+		_, err = db.GetZoneSerialForUpdate(ctx, zoneRow.ID)
+		if err != nil {
+			return err
+		}
+		records, err := db.GetZoneRecords(ctx, zone)
+		if err != nil {
+			return err
+		}
+
+		deleted, added, err := fn(zoneRow, records)
+		if err != nil {
+			return err
+		}
+		if len(deleted) == 0 && len(added) == 0 {
+			return nil
+		}
+		for _, i := range deleted {
+			err = db.DeleteZoneRecordById(ctx, DeleteZoneRecordByIdParams{Zone: zoneRow.ID, ID: i.ID})
+			if err != nil {
+				return err
+			}
+		}
+		for n, i := range added {
+			id, err := db.AddZoneRecord(ctx, AddZoneRecordParams{
+				Zone:   zoneRow.ID,
+				Name:   i.Name,
+				Type:   i.Type,
+				Locked: i.Locked,
+				Ttl:    i.Ttl,
+				Value:  i.Value,
+			})
+			if err != nil {
+				return err
+			}
+			added[n].ID = int32(id)
+			added[n].Zone = zoneRow.ID
+		}
+		return db.journalChange(ctx, zoneRow.ID, deleted, added)
+	})
+}
+
+// SetZoneDefaultTtlWithJournal changes the default TTL of the zone and
+// increments the zone serial, the journal is cleared as the TTL of every record
+// using the default changes so secondaries must use a full zone transfer
+func (q *Queries) SetZoneDefaultTtlWithJournal(ctx context.Context, arg SetZoneDefaultTtlParams) error {
+	return q.Tx(ctx, nil, func(db *Queries) error {
+		_, _, err := db.bumpSerial(ctx, arg.ID)
+		if err != nil {
+			return err
+		}
+		err = db.SetZoneDefaultTtl(ctx, arg)
+		if err != nil {
+			return err
+		}
+		return db.ClearJournal(ctx, arg.ID)
+	})
+}
+
+// SetZoneSoaWithJournal changes the SOA and NS settings of the zone and
+// increments the zone serial, the journal is cleared as it can't contain the
+// generated apex records so secondaries must use a full zone transfer
+func (q *Queries) SetZoneSoaWithJournal(ctx context.Context, arg SetZoneSoaParams) error {
+	return q.Tx(ctx, nil, func(db *Queries) error {
+		_, _, err := db.bumpSerial(ctx, arg.ID)
+		if err != nil {
+			return err
+		}
+		err = db.SetZoneSoa(ctx, arg)
+		if err != nil {
+			return err
+		}
+		return db.ClearJournal(ctx, arg.ID)
+	})
+}
+
+// journalChange increments the zone serial and writes the deleted and added
+// records to the journal, this must be called inside a transaction
+func (q *Queries) journalChange(ctx context.Context, zone int32, deleted, added []Record) error {
+	prevSerial, serial, err := q.bumpSerial(ctx, zone)
+	if err != nil {
+		return err
+	}
+
+	write := func(records []Record, isDeleted bool) error {
+		for _, i := range records {
+			err := q.AddJournalEntry(ctx, AddJournalEntryParams{
+				Zone:       zone,
+				PrevSerial: prevSerial,
+				Serial:     serial,
+				Deleted:    isDeleted,
+				Name:       i.Name,
+				Type:       i.Type,
+				Ttl:        i.Ttl,
+				Value:      i.Value,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := write(deleted, true); err != nil {
+		return err
+	}
+	if err := write(added, false); err != nil {
+		return err
+	}
+
+	// remove old journal entries, the whole change containing the prune point is
+	// removed so the journal never starts partway through a change
+	prunePoint, err := q.GetJournalPrunePoint(ctx, GetJournalPrunePointParams{Zone: zone, Offset: journalLimit})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return q.PruneJournal(ctx, PruneJournalParams{Zone: zone, ID: prunePoint.ID, Serial: prunePoint.Serial})
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/gobuffalo/nulls"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// queryName returns the sqlc name of the query
+func queryName(query string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(query, "-- name: "), " ")
+	return name
+}
+
+// queryNames returns the names of the queries received by the fake database
+func (f *fakeDB) queryNames() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(f.queries))
+	for _, i := range f.queries {
+		names = append(names, queryName(i.query))
+	}
+	return names
+}
+
+// journalHandler answers the zone serial lock with the serial using the
+// increment scheme, the journal prune point is only found if prune is set
+func journalHandler(serial int64, prune bool) fakeHandler {
+	return func(query string, args []any) ([]string, [][]driver.Value, error) {
+		switch queryName(query) {
+		case "GetZoneSerialForUpdate":
+			return []string{"serial", "serial_scheme"}, [][]driver.Value{{serial, SerialSchemeIncrement}}, nil
+		case "GetZone":
+			return zoneColumns, [][]driver.Value{fakeZoneRow(1, "example.com.")}, nil
+		case "GetZoneRecords":
+			return []string{"id", "zone", "name", "type", "locked", "ttl", "value"}, [][]driver.Value{
+				{int64(7), int64(1), "www", "A", false, nil, "10.0.0.1"},
+			}, nil
+		case "GetJournalPrunePoint":
+			if prune {
+				return []string{"id", "serial"}, [][]driver.Value{{int64(3), int64(4)}}, nil
+			}
+			return []string{"id", "serial"}, nil, nil
+		}
+		return nil, nil, nil
+	}
+}
+
+func TestQueries_AddZoneRecordWithJournal(t *testing.T) {
+	db, f := newFakeDB(t, journalHandler(5, false))
+	id, err := db.AddZoneRecordWithJournal(context.Background(), AddZoneRecordParams{
+		Zone:  1,
+		Name:  "www",
+		Type:  "A",
+		Ttl:   nulls.NewUInt32(60),
+		Value: "10.0.0.1",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+	assert.Equal(t, []string{"AddZoneRecord", "GetZoneSerialForUpdate", "SetZoneSerial", "AddJournalEntry", "GetJournalPrunePoint"}, f.queryNames())
+	assert.Equal(t, 1, f.commits)
+
+	// the serial is incremented and the entry records the serial step
+	assert.Equal(t, []any{int64(6), int64(1)}, f.queries[2].args)
+	assert.Equal(t, []any{int64(1), int64(5), int64(6), false, "www", "A", int64(60), "10.0.0.1"}, f.queries[3].args)
+	assert.Equal(t, []any{int64(1), int64(journalLimit)}, f.queries[4].args)
+}
+
+func TestQueries_UpdateZoneWithJournal(t *testing.T) {
+	db, f := newFakeDB(t, journalHandler(5, true))
+	err := db.UpdateZoneWithJournal(context.Background(), "example.com.", func(zone Zone, records []Record) ([]Record, []Record, error) {
+		assert.Equal(t, int32(1), zone.ID)
+		assert.Len(t, records, 1)
+		return records, []Record{{Name: "www", Type: "A", Value: "10.0.0.2"}}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"GetZone", "GetZoneSerialForUpdate", "GetZoneRecords",
+		"DeleteZoneRecordById", "AddZoneRecord",
+		"GetZoneSerialForUpdate", "SetZoneSerial",
+		"AddJournalEntry", "AddJournalEntry",
+		"GetJournalPrunePoint", "PruneJournal",
+	}, f.queryNames())
+	assert.Equal(t, 1, f.commits)
+
+	// deleted records are written to the journal before added records
+	assert.Equal(t, []any{int64(1), int64(5), int64(6), true, "www", "A", nil, "10.0.0.1"}, f.queries[7].args)
+	assert.Equal(t, []any{int64(1), int64(5), int64(6), false, "www", "A", nil, "10.0.0.2"}, f.queries[8].args)
+
+	// the whole change containing the prune point is removed
+	assert.Equal(t, []any{int64(1), int64(3), int64(4)}, f.queries[10].args)
+}
+
+func TestQueries_UpdateZoneWithJournal_noChanges(t *testing.T) {
+	db, f := newFakeDB(t, journalHandler(5, false))
+	err := db.UpdateZoneWithJournal(context.Background(), "example.com.", func(zone Zone, records []Record) ([]Record, []Record, error) {
+		return nil, nil, nil
+	})
+	assert.NoError(t, err)
+
+	// the serial is unchanged
+	assert.Equal(t, []string{"GetZone", "GetZoneSerialForUpdate", "GetZoneRecords"}, f.queryNames())
+}
+
+func TestQueries_GetJournalEntries(t *testing.T) {
+	db, f := newFakeDB(t, func(query string, args []any) ([]string, [][]driver.Value, error) {
+		return []string{"id", "zone", "prev_serial", "serial", "deleted", "name", "type", "ttl", "value"}, [][]driver.Value{
+			{int64(1), int64(1), int64(1), int64(2), false, "www", "A", nil, "10.0.0.1"},
+			{int64(2), int64(1), int64(2), int64(3), true, "www", "A", int64(60), "10.0.0.1"},
+		}, nil
+	})
+	entries, err := db.GetJournalEntries(context.Background(), GetJournalEntriesParams{Name: "example.com.", PrevSerial: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []ZoneJournal{
+		{ID: 1, Zone: 1, PrevSerial: 1, Serial: 2, Name: "www", Type: "A", Value: "10.0.0.1"},
+		{ID: 2, Zone: 1, PrevSerial: 2, Serial: 3, Deleted: true, Name: "www", Type: "A", Ttl: nulls.NewUInt32(60), Value: "10.0.0.1"},
+	}, entries)
+	assert.Equal(t, []any{"example.com.", int64(1)}, f.queries[0].args)
+}
@@ -0,0 +1,6 @@
+DROP INDEX zone_journal_prev_serial ON zone_journal;
+
+DROP TABLE zone_journal;
+
+ALTER TABLE zones
+    DROP COLUMN serial;
@@ -0,0 +1,24 @@
+ALTER TABLE zones
+    ADD COLUMN serial INTEGER UNSIGNED NOT NULL DEFAULT 1;
+
+UPDATE zones
+SET serial = CAST(DATE_FORMAT(NOW(), '%Y%m%d01') AS UNSIGNED);
+
+CREATE TABLE zone_journal
+(
+    id          INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+    zone        INTEGER                            NOT NULL,
+    prev_serial INTEGER UNSIGNED                   NOT NULL,
+    serial      INTEGER UNSIGNED                   NOT NULL,
+    deleted     BOOLEAN                            NOT NULL,
+    name        TEXT                               NOT NULL,
+    type        TEXT                               NOT NULL,
+    ttl         INTEGER,
+    value       TEXT                               NOT NULL,
+
+    FOREIGN KEY (zone) REFERENCES zones (id)
+        ON DELETE RESTRICT
+        ON UPDATE RESTRICT
+);
+
+CREATE INDEX zone_journal_prev_serial ON zone_journal (zone, prev_serial);
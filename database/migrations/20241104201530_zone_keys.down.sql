@@ -0,0 +1 @@
+DROP TABLE zone_keys;
@@ -0,0 +1,13 @@
+CREATE TABLE zone_keys
+(
+    id          INTEGER PRIMARY KEY AUTO_INCREMENT NOT NULL,
+    zone        INTEGER                            NOT NULL,
+    flags       SMALLINT UNSIGNED                  NOT NULL,
+    algorithm   TINYINT UNSIGNED                   NOT NULL,
+    public_key  TEXT                               NOT NULL,
+    private_key TEXT                               NOT NULL,
+
+    FOREIGN KEY (zone) REFERENCES zones (id)
+        ON DELETE RESTRICT
+        ON UPDATE RESTRICT
+);
@@ -0,0 +1,3 @@
+ALTER TABLE zone_keys
+    DROP COLUMN state,
+    DROP COLUMN state_changed_at;
@@ -0,0 +1,3 @@
+ALTER TABLE zone_keys
+    ADD COLUMN state            VARCHAR(16) NOT NULL DEFAULT 'active',
+    ADD COLUMN state_changed_at BIGINT      NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE zones
+    DROP COLUMN default_ttl;
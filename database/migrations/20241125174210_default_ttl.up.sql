@@ -0,0 +1,2 @@
+ALTER TABLE zones
+    ADD COLUMN default_ttl INTEGER UNSIGNED NOT NULL DEFAULT 300;
@@ -0,0 +1,2 @@
+ALTER TABLE zones
+    DROP COLUMN serial_scheme;
@@ -0,0 +1,2 @@
+ALTER TABLE zones
+    ADD COLUMN serial_scheme VARCHAR(16) NOT NULL DEFAULT 'date';
@@ -0,0 +1,7 @@
+ALTER TABLE zones
+    DROP COLUMN nameservers,
+    DROP COLUMN mbox,
+    DROP COLUMN refresh,
+    DROP COLUMN retry,
+    DROP COLUMN expire,
+    DROP COLUMN minimum;
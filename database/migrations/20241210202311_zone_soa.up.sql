@@ -0,0 +1,7 @@
+ALTER TABLE zones
+    ADD COLUMN nameservers TEXT             NULL,
+    ADD COLUMN mbox        TEXT             NULL,
+    ADD COLUMN refresh     INTEGER UNSIGNED NULL,
+    ADD COLUMN retry       INTEGER UNSIGNED NULL,
+    ADD COLUMN expire      INTEGER UNSIGNED NULL,
+    ADD COLUMN minimum     INTEGER UNSIGNED NULL;
@@ -34,6 +34,38 @@ type ServiceRecord struct {
 }
 
 type Zone struct {
-	ID   int32  `json:"id"`
-	Name string `json:"name"`
+	ID           int32        `json:"id"`
+	Name         string       `json:"name"`
+	Serial       uint32       `json:"serial"`
+	DefaultTtl   uint32       `json:"default_ttl"`
+	SerialScheme string       `json:"serial_scheme"`
+	Nameservers  nulls.String `json:"nameservers"`
+	Mbox         nulls.String `json:"mbox"`
+	Refresh      nulls.UInt32 `json:"refresh"`
+	Retry        nulls.UInt32 `json:"retry"`
+	Expire       nulls.UInt32 `json:"expire"`
+	Minimum      nulls.UInt32 `json:"minimum"`
+}
+
+type ZoneKey struct {
+	ID             int32  `json:"id"`
+	Zone           int32  `json:"zone"`
+	Flags          uint16 `json:"flags"`
+	Algorithm      uint8  `json:"algorithm"`
+	PublicKey      string `json:"public_key"`
+	PrivateKey     string `json:"private_key"`
+	State          string `json:"state"`
+	StateChangedAt int64  `json:"state_changed_at"`
+}
+
+type ZoneJournal struct {
+	ID         int32        `json:"id"`
+	Zone       int32        `json:"zone"`
+	PrevSerial uint32       `json:"prev_serial"`
+	Serial     uint32       `json:"serial"`
+	Deleted    bool         `json:"deleted"`
+	Name       string       `json:"name"`
+	Type       string       `json:"type"`
+	Ttl        nulls.UInt32 `json:"ttl"`
+	Value      string       `json:"value"`
 }
@@ -0,0 +1,32 @@
+-- name: AddJournalEntry :exec
+INSERT INTO zone_journal (zone, prev_serial, serial, deleted, name, type, ttl, value)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetJournalEntries :many
+SELECT zone_journal.*
+FROM zone_journal
+         INNER JOIN zones z on z.id = zone_journal.zone
+WHERE z.name = ?
+  AND zone_journal.id >= (SELECT min(j.id)
+                          FROM zone_journal j
+                          WHERE j.zone = z.id
+                            AND j.prev_serial = ?)
+ORDER BY zone_journal.id;
+
+-- name: GetJournalPrunePoint :one
+SELECT id, serial
+FROM zone_journal
+WHERE zone = ?
+ORDER BY id DESC
+LIMIT 1 OFFSET ?;
+
+-- name: PruneJournal :exec
+DELETE
+FROM zone_journal
+WHERE zone = ?
+  AND (id < ? OR serial = ?);
+
+-- name: ClearJournal :exec
+DELETE
+FROM zone_journal
+WHERE zone = ?;
@@ -5,7 +5,7 @@ FROM records
 WHERE z.name = ?;
 
 -- name: LookupRecordsForType :many
-SELECT records.*, z.name as zone_name
+SELECT records.*, z.name as zone_name, z.default_ttl as zone_default_ttl
 FROM records
          INNER JOIN zones z on z.id = records.zone
 WHERE (type = ? or type = 'LOC_RES')
@@ -13,8 +13,8 @@ WHERE (type = ? or type = 'LOC_RES')
   and z.name = ?;
 
 -- name: AddZoneRecord :execlastid
-INSERT INTO records (zone, name, type, locked, value)
-VALUES (?, ?, ?, ?, ?);
+INSERT INTO records (zone, name, type, locked, ttl, value)
+VALUES (?, ?, ?, ?, ?, ?);
 
 -- name: GetZoneRecordById :one
 SELECT records.*
@@ -24,7 +24,8 @@ WHERE zone = ?
 
 -- name: PutZoneRecordById :exec
 UPDATE records
-SET value = ?
+SET ttl   = ?,
+    value = ?
 WHERE zone = ?
   AND id = ?;
 
@@ -33,3 +34,25 @@ DELETE
 FROM records
 WHERE zone = ?
   AND id = ?;
+
+-- name: LookupRecordTypes :many
+SELECT DISTINCT records.type
+FROM records
+         INNER JOIN zones z on z.id = records.zone
+WHERE records.name = ?
+  and z.name = ?;
+
+-- name: CountRecordsBelowName :one
+SELECT COUNT(*)
+FROM records
+         INNER JOIN zones z on z.id = records.zone
+WHERE RIGHT(records.name, CHAR_LENGTH(sqlc.arg(suffix))) = sqlc.arg(suffix)
+  and z.name = sqlc.arg(zone);
+
+-- name: CountDelegations :one
+SELECT COUNT(*)
+FROM records
+         INNER JOIN zones z on z.id = records.zone
+WHERE records.type = 'NS'
+  and records.name != '@'
+  and z.name = ?;
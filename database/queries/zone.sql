@@ -7,6 +7,13 @@ SELECT *
 FROM zones
 WHERE name = ?;
 
+-- name: GetZoneForSuffixes :one
+SELECT *
+FROM zones
+WHERE name IN (sqlc.slice(names))
+ORDER BY CHAR_LENGTH(zones.name) DESC
+LIMIT 1;
+
 -- name: GetOwnedZones :many
 SELECT *
 FROM zones
@@ -15,3 +22,33 @@ WHERE name IN(sqlc.slice(name));
 -- name: AddZone :execlastid
 INSERT INTO zones (name)
 VALUES (?);
+
+-- name: GetZoneSerialForUpdate :one
+SELECT serial, serial_scheme
+FROM zones
+WHERE id = ? FOR UPDATE;
+
+-- name: SetZoneSerial :exec
+UPDATE zones
+SET serial = ?
+WHERE id = ?;
+
+-- name: SetZoneDefaultTtl :exec
+UPDATE zones
+SET default_ttl = ?
+WHERE id = ?;
+
+-- name: SetZoneSerialScheme :exec
+UPDATE zones
+SET serial_scheme = ?
+WHERE id = ?;
+
+-- name: SetZoneSoa :exec
+UPDATE zones
+SET nameservers = ?,
+    mbox        = ?,
+    refresh     = ?,
+    retry       = ?,
+    expire      = ?,
+    minimum     = ?
+WHERE id = ?;
@@ -0,0 +1,25 @@
+-- name: GetZoneKeys :many
+SELECT zone_keys.*
+FROM zone_keys
+         INNER JOIN zones z on z.id = zone_keys.zone
+WHERE z.name = ?;
+
+-- name: AddZoneKey :execlastid
+INSERT INTO zone_keys (zone, flags, algorithm, public_key, private_key, state, state_changed_at)
+VALUES (?, ?, ?, ?, ?, ?, ?);
+
+-- name: SetZoneKeyState :exec
+UPDATE zone_keys
+SET state            = ?,
+    state_changed_at = ?
+WHERE id = ?;
+
+-- name: DeleteZoneKey :exec
+DELETE
+FROM zone_keys
+WHERE id = ?;
+
+-- name: GetSignedZones :many
+SELECT DISTINCT zones.*
+FROM zones
+         INNER JOIN zone_keys k on zones.id = k.zone;
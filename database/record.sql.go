@@ -12,16 +12,17 @@ import (
 )
 
 const addZoneRecord = `-- name: AddZoneRecord :execlastid
-INSERT INTO records (zone, name, type, locked, value)
-VALUES (?, ?, ?, ?, ?)
+INSERT INTO records (zone, name, type, locked, ttl, value)
+VALUES (?, ?, ?, ?, ?, ?)
 `
 
 type AddZoneRecordParams struct {
-	Zone   int32  `json:"zone"`
-	Name   string `json:"name"`
-	Type   string `json:"type"`
-	Locked bool   `json:"locked"`
-	Value  string `json:"value"`
+	Zone   int32        `json:"zone"`
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Locked bool         `json:"locked"`
+	Ttl    nulls.UInt32 `json:"ttl"`
+	Value  string       `json:"value"`
 }
 
 func (q *Queries) AddZoneRecord(ctx context.Context, arg AddZoneRecordParams) (int64, error) {
@@ -30,6 +31,7 @@ func (q *Queries) AddZoneRecord(ctx context.Context, arg AddZoneRecordParams) (i
 		arg.Name,
 		arg.Type,
 		arg.Locked,
+		arg.Ttl,
 		arg.Value,
 	)
 	if err != nil {
@@ -38,6 +40,42 @@ func (q *Queries) AddZoneRecord(ctx context.Context, arg AddZoneRecordParams) (i
 	return result.LastInsertId()
 }
 
+const countDelegations = `-- name: CountDelegations :one
+SELECT COUNT(*)
+FROM records
+         INNER JOIN zones z on z.id = records.zone
+WHERE records.type = 'NS'
+  and records.name != '@'
+  and z.name = ?
+`
+
+func (q *Queries) CountDelegations(ctx context.Context, name string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countDelegations, name)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countRecordsBelowName = `-- name: CountRecordsBelowName :one
+SELECT COUNT(*)
+FROM records
+         INNER JOIN zones z on z.id = records.zone
+WHERE RIGHT(records.name, CHAR_LENGTH(?)) = ?
+  and z.name = ?
+`
+
+type CountRecordsBelowNameParams struct {
+	Suffix string `json:"suffix"`
+	Zone   string `json:"zone"`
+}
+
+func (q *Queries) CountRecordsBelowName(ctx context.Context, arg CountRecordsBelowNameParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countRecordsBelowName, arg.Suffix, arg.Suffix, arg.Zone)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const deleteZoneRecordById = `-- name: DeleteZoneRecordById :exec
 DELETE
 FROM records
@@ -121,7 +159,7 @@ func (q *Queries) GetZoneRecords(ctx context.Context, name string) ([]Record, er
 }
 
 const lookupRecordsForType = `-- name: LookupRecordsForType :many
-SELECT records.id, records.zone, records.name, records.type, records.locked, records.ttl, records.value, z.name as zone_name
+SELECT records.id, records.zone, records.name, records.type, records.locked, records.ttl, records.value, z.name as zone_name, z.default_ttl as zone_default_ttl
 FROM records
          INNER JOIN zones z on z.id = records.zone
 WHERE (type = ? or type = 'LOC_RES')
@@ -136,14 +174,15 @@ type LookupRecordsForTypeParams struct {
 }
 
 type LookupRecordsForTypeRow struct {
-	ID       int32        `json:"id"`
-	Zone     int32        `json:"zone"`
-	Name     string       `json:"name"`
-	Type     string       `json:"type"`
-	Locked   bool         `json:"locked"`
-	Ttl      nulls.UInt32 `json:"ttl"`
-	Value    string       `json:"value"`
-	ZoneName string       `json:"zone_name"`
+	ID             int32        `json:"id"`
+	Zone           int32        `json:"zone"`
+	Name           string       `json:"name"`
+	Type           string       `json:"type"`
+	Locked         bool         `json:"locked"`
+	Ttl            nulls.UInt32 `json:"ttl"`
+	Value          string       `json:"value"`
+	ZoneName       string       `json:"zone_name"`
+	ZoneDefaultTtl uint32       `json:"zone_default_ttl"`
 }
 
 func (q *Queries) LookupRecordsForType(ctx context.Context, arg LookupRecordsForTypeParams) ([]LookupRecordsForTypeRow, error) {
@@ -164,6 +203,7 @@ func (q *Queries) LookupRecordsForType(ctx context.Context, arg LookupRecordsFor
 			&i.Ttl,
 			&i.Value,
 			&i.ZoneName,
+			&i.ZoneDefaultTtl,
 		); err != nil {
 			return nil, err
 		}
@@ -178,20 +218,63 @@ func (q *Queries) LookupRecordsForType(ctx context.Context, arg LookupRecordsFor
 	return items, nil
 }
 
+const lookupRecordTypes = `-- name: LookupRecordTypes :many
+SELECT DISTINCT records.type
+FROM records
+         INNER JOIN zones z on z.id = records.zone
+WHERE records.name = ?
+  and z.name = ?
+`
+
+type LookupRecordTypesParams struct {
+	Name   string `json:"name"`
+	Name_2 string `json:"name_2"`
+}
+
+func (q *Queries) LookupRecordTypes(ctx context.Context, arg LookupRecordTypesParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, lookupRecordTypes, arg.Name, arg.Name_2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var type_ string
+		if err := rows.Scan(&type_); err != nil {
+			return nil, err
+		}
+		items = append(items, type_)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const putZoneRecordById = `-- name: PutZoneRecordById :exec
 UPDATE records
-SET value = ?
+SET ttl   = ?,
+    value = ?
 WHERE zone = ?
   AND id = ?
 `
 
 type PutZoneRecordByIdParams struct {
-	Value string `json:"value"`
-	Zone  int32  `json:"zone"`
-	ID    int32  `json:"id"`
+	Ttl   nulls.UInt32 `json:"ttl"`
+	Value string       `json:"value"`
+	Zone  int32        `json:"zone"`
+	ID    int32        `json:"id"`
 }
 
 func (q *Queries) PutZoneRecordById(ctx context.Context, arg PutZoneRecordByIdParams) error {
-	_, err := q.db.ExecContext(ctx, putZoneRecordById, arg.Value, arg.Zone, arg.ID)
+	_, err := q.db.ExecContext(ctx, putZoneRecordById,
+		arg.Ttl,
+		arg.Value,
+		arg.Zone,
+		arg.ID,
+	)
 	return err
 }
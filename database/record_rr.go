@@ -14,7 +14,7 @@ func (r Record) ConvertRecord(zone string) (*models.Record, error) {
 	record := &models.Record{
 		Id:   int64(r.ID),
 		Name: name,
-		Type: dns.StringToType[r.Type],
+		Type: models.StringToType(r.Type),
 		Ttl:  r.Ttl,
 	}
 	if record.Type == dns.TypeNone {
@@ -27,6 +27,9 @@ func (r Record) ConvertRecord(zone string) (*models.Record, error) {
 		return nil, converters.ErrInvalidRecord{Name: name, Value: r.Value, AType: r.Type, Reason: converters.ErrInvalidSegmentCount}
 	}
 	convert, found := converters.Converters[record.Type]
+	if !found && converters.IsGeneric(record.Type) {
+		convert, found = converters.Generic(record.Type), true
+	}
 	if !found {
 		return nil, converters.ErrInvalidRecord{Name: name, Value: r.Value, AType: r.Type, Reason: fmt.Errorf("unsupported record type %s", r.Type)}
 	}
@@ -14,6 +14,20 @@ func TestRecord_ZoneFileLine(t *testing.T) {
 		{Record{Name: "@", Type: "AAAA", Value: "fd01::1"}, "example.com.\t300\tIN\tAAAA\tfd01::1"},
 		{Record{Name: "ns1", Type: "A", Value: "10.0.1.0"}, "ns1.example.com.\t300\tIN\tA\t10.0.1.0"},
 		{Record{Name: "ns1", Type: "AAAA", Value: "fd01::1:0"}, "ns1.example.com.\t300\tIN\tAAAA\tfd01::1:0"},
+		{Record{Name: "@", Type: "CAA", Value: "0\tissue\tletsencrypt.org"}, "example.com.\t300\tIN\tCAA\t0 issue \"letsencrypt.org\""},
+		{Record{Name: "1", Type: "PTR", Value: "host.example.com."}, "1.example.com.\t300\tIN\tPTR\thost.example.com."},
+		{Record{Name: "@", Type: "NAPTR", Value: "100\t10\tS\tSIP+D2U\t\t_sip._udp.example.com."}, "example.com.\t300\tIN\tNAPTR\t100 10 \"S\" \"SIP+D2U\" \"\" _sip._udp.example.com."},
+		{Record{Name: "host", Type: "SSHFP", Value: "4\t2\tabcd"}, "host.example.com.\t300\tIN\tSSHFP\t4 2 ABCD"},
+		{Record{Name: "_25._tcp.mail", Type: "TLSA", Value: "3\t1\t1\tabcd"}, "_25._tcp.mail.example.com.\t300\tIN\tTLSA\t3 1 1 abcd"},
+		{Record{Name: "child", Type: "DS", Value: "12345\t13\t2\tabcd"}, "child.example.com.\t300\tIN\tDS\t12345 13 2 ABCD"},
+		{Record{Name: "_sip._udp", Type: "URI", Value: "10\t1\tsip:info@example.com"}, "_sip._udp.example.com.\t300\tIN\tURI\t10 1 \"sip:info@example.com\""},
+		{Record{Name: "old", Type: "DNAME", Value: "example.net."}, "old.example.com.\t300\tIN\tDNAME\texample.net."},
+		{Record{Name: "@", Type: "HTTPS", Value: "0\tcdn.example.net.\t"}, "example.com.\t300\tIN\tHTTPS\t0 cdn.example.net."},
+		{Record{Name: "www", Type: "HTTPS", Value: "1\t.\tmandatory=alpn alpn=h2,h3 port=8443 ipv4hint=10.0.0.1 ipv6hint=fd00::1"}, "www.example.com.\t300\tIN\tHTTPS\t1 . mandatory=\"alpn\" alpn=\"h2,h3\" port=\"8443\" ipv4hint=\"10.0.0.1\" ipv6hint=\"fd00::1\""},
+		{Record{Name: "_dns", Type: "SVCB", Value: "1\tdns.example.com.\talpn=dot"}, "_dns.example.com.\t300\tIN\tSVCB\t1 dns.example.com. alpn=\"dot\""},
+		{Record{Name: "@", Type: "TYPE65000", Value: `\# 4 0a000001`}, "example.com.\t300\tCLASS1\tTYPE65000\t\\# 4 0a000001"},
+		{Record{Name: "host", Type: "HINFO", Value: `\# 0`}, "host.example.com.\t300\tCLASS1\tTYPE13\t\\# 0 "},
+		{Record{Name: "@", Type: "ALIAS", Value: "cdn.example.net."}, "example.com.\t300\tIN\tALIAS\tcdn.example.net."},
 	}
 	for _, i := range tests {
 		rr, err := i.record.ConvertRecord("example.com.")
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQueries_LookupRecordTypes(t *testing.T) {
+	db, f := newFakeDB(t, func(query string, args []any) ([]string, [][]driver.Value, error) {
+		return []string{"type"}, [][]driver.Value{{"A"}, {"TXT"}}, nil
+	})
+	types, err := db.LookupRecordTypes(context.Background(), LookupRecordTypesParams{Name: "www", Name_2: "example.com."})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A", "TXT"}, types)
+	if assert.Len(t, f.queries, 1) {
+		assert.Contains(t, f.queries[0].query, "SELECT DISTINCT records.type")
+		assert.Equal(t, []any{"www", "example.com."}, f.queries[0].args)
+	}
+}
+
+func TestQueries_CountRecordsBelowName(t *testing.T) {
+	db, f := newFakeDB(t, func(query string, args []any) ([]string, [][]driver.Value, error) {
+		return []string{"count"}, [][]driver.Value{{int64(2)}}, nil
+	})
+	count, err := db.CountRecordsBelowName(context.Background(), CountRecordsBelowNameParams{Suffix: ".b", Zone: "example.com."})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	// the suffix is used for the length and the comparison
+	if assert.Len(t, f.queries, 1) {
+		assert.Equal(t, []any{".b", ".b", "example.com."}, f.queries[0].args)
+	}
+}
+
+func TestQueries_CountDelegations(t *testing.T) {
+	db, f := newFakeDB(t, func(query string, args []any) ([]string, [][]driver.Value, error) {
+		return []string{"count"}, [][]driver.Value{{int64(1)}}, nil
+	})
+	count, err := db.CountDelegations(context.Background(), "example.com.")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	if assert.Len(t, f.queries, 1) {
+		assert.Contains(t, f.queries[0].query, "records.type = 'NS'")
+		assert.Equal(t, []any{"example.com."}, f.queries[0].args)
+	}
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Serial schemes control how the zone serial is incremented when the zone
+// changes, the serial always increases by at least one so secondaries detect
+// every change
+const (
+	// SerialSchemeDate uses the YYYYMMDDnn format from RFC 1912
+	SerialSchemeDate = "date"
+
+	// SerialSchemeUnixtime uses the number of seconds since the unix epoch
+	SerialSchemeUnixtime = "unixtime"
+
+	// SerialSchemeIncrement adds one to the serial
+	SerialSchemeIncrement = "increment"
+)
+
+// ValidSerialScheme returns true if the serial scheme is supported
+func ValidSerialScheme(scheme string) bool {
+	switch scheme {
+	case SerialSchemeDate, SerialSchemeUnixtime, SerialSchemeIncrement:
+		return true
+	}
+	return false
+}
+
+// NextSerial returns the serial after prev using the scheme, if prev is already
+// ahead of the scheme value then the serial is incremented instead
+func NextSerial(scheme string, prev uint32, now time.Time) uint32 {
+	next := prev + 1
+	var value uint32
+	switch scheme {
+	case SerialSchemeDate:
+		now = now.UTC()
+		value = uint32(now.Year()*1000000 + int(now.Month())*10000 + now.Day()*100)
+	case SerialSchemeUnixtime:
+		value = uint32(now.Unix())
+	}
+	return max(next, value)
+}
+
+// bumpSerial locks the zone row and increments the serial using the serial
+// scheme of the zone, this must be called inside a transaction
+func (q *Queries) bumpSerial(ctx context.Context, zone int32) (prevSerial, serial uint32, err error) {
+	row, err := q.GetZoneSerialForUpdate(ctx, zone)
+	if err != nil {
+		return 0, 0, err
+	}
+	serial = NextSerial(row.SerialScheme, row.Serial, time.Now())
+	err = q.SetZoneSerial(ctx, SetZoneSerialParams{Serial: serial, ID: zone})
+	if err != nil {
+		return 0, 0, err
+	}
+	return row.Serial, serial, nil
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNextSerial(t *testing.T) {
+	now := time.Date(2024, time.December, 3, 19, 15, 47, 0, time.UTC)
+	tests := []struct {
+		scheme string
+		prev   uint32
+		next   uint32
+	}{
+		{SerialSchemeDate, 1, 2024120300},
+		{SerialSchemeDate, 2024113005, 2024120300},
+		{SerialSchemeDate, 2024120300, 2024120301},
+		{SerialSchemeDate, 2024120399, 2024120400},
+		{SerialSchemeUnixtime, 1, 1733253347},
+		{SerialSchemeUnixtime, 2024120300, 2024120301},
+		{SerialSchemeUnixtime, 1733253347, 1733253348},
+		{SerialSchemeIncrement, 41, 42},
+		{SerialSchemeDate, 4294967295, 2024120300},
+	}
+	for _, i := range tests {
+		assert.Equal(t, i.next, NextSerial(i.scheme, i.prev, now), i.scheme)
+	}
+}
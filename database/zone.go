@@ -0,0 +1,17 @@
+package database
+
+import (
+	"context"
+	"strings"
+)
+
+// GetZoneForName returns the hosted zone with the longest name containing the
+// name, every parent of the name is passed to the query so it can use the
+// unique index on the zone name
+func (q *Queries) GetZoneForName(ctx context.Context, name string) (Zone, error) {
+	var suffixes []string
+	for n := name; n != ""; _, n, _ = strings.Cut(n, ".") {
+		suffixes = append(suffixes, n)
+	}
+	return q.GetZoneForSuffixes(ctx, suffixes)
+}
@@ -8,6 +8,8 @@ package database
 import (
 	"context"
 	"strings"
+
+	"github.com/gobuffalo/nulls"
 )
 
 const addZone = `-- name: AddZone :execlastid
@@ -24,7 +26,7 @@ func (q *Queries) AddZone(ctx context.Context, name string) (int64, error) {
 }
 
 const getOwnedZones = `-- name: GetOwnedZones :many
-SELECT id, name
+SELECT id, name, serial, default_ttl, serial_scheme, nameservers, mbox, refresh, retry, expire, minimum
 FROM zones
 WHERE name IN(/*SLICE:name*/?)
 `
@@ -48,7 +50,19 @@ func (q *Queries) GetOwnedZones(ctx context.Context, name []string) ([]Zone, err
 	var items []Zone
 	for rows.Next() {
 		var i Zone
-		if err := rows.Scan(&i.ID, &i.Name); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Serial,
+			&i.DefaultTtl,
+			&i.SerialScheme,
+			&i.Nameservers,
+			&i.Mbox,
+			&i.Refresh,
+			&i.Retry,
+			&i.Expire,
+			&i.Minimum,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -63,7 +77,7 @@ func (q *Queries) GetOwnedZones(ctx context.Context, name []string) ([]Zone, err
 }
 
 const getZone = `-- name: GetZone :one
-SELECT id, name
+SELECT id, name, serial, default_ttl, serial_scheme, nameservers, mbox, refresh, retry, expire, minimum
 FROM zones
 WHERE name = ?
 `
@@ -71,12 +85,79 @@ WHERE name = ?
 func (q *Queries) GetZone(ctx context.Context, name string) (Zone, error) {
 	row := q.db.QueryRowContext(ctx, getZone, name)
 	var i Zone
-	err := row.Scan(&i.ID, &i.Name)
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Serial,
+		&i.DefaultTtl,
+		&i.SerialScheme,
+		&i.Nameservers,
+		&i.Mbox,
+		&i.Refresh,
+		&i.Retry,
+		&i.Expire,
+		&i.Minimum,
+	)
+	return i, err
+}
+
+const getZoneForSuffixes = `-- name: GetZoneForSuffixes :one
+SELECT id, name, serial, default_ttl, serial_scheme, nameservers, mbox, refresh, retry, expire, minimum
+FROM zones
+WHERE name IN (/*SLICE:names*/?)
+ORDER BY CHAR_LENGTH(zones.name) DESC
+LIMIT 1
+`
+
+func (q *Queries) GetZoneForSuffixes(ctx context.Context, names []string) (Zone, error) {
+	query := getZoneForSuffixes
+	var queryParams []interface{}
+	if len(names) > 0 {
+		for _, v := range names {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:names*/?", strings.Repeat(",?", len(names))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:names*/?", "NULL", 1)
+	}
+	row := q.db.QueryRowContext(ctx, query, queryParams...)
+	var i Zone
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Serial,
+		&i.DefaultTtl,
+		&i.SerialScheme,
+		&i.Nameservers,
+		&i.Mbox,
+		&i.Refresh,
+		&i.Retry,
+		&i.Expire,
+		&i.Minimum,
+	)
+	return i, err
+}
+
+const getZoneSerialForUpdate = `-- name: GetZoneSerialForUpdate :one
+SELECT serial, serial_scheme
+FROM zones
+WHERE id = ? FOR UPDATE
+`
+
+type GetZoneSerialForUpdateRow struct {
+	Serial       uint32 `json:"serial"`
+	SerialScheme string `json:"serial_scheme"`
+}
+
+func (q *Queries) GetZoneSerialForUpdate(ctx context.Context, id int32) (GetZoneSerialForUpdateRow, error) {
+	row := q.db.QueryRowContext(ctx, getZoneSerialForUpdate, id)
+	var i GetZoneSerialForUpdateRow
+	err := row.Scan(&i.Serial, &i.SerialScheme)
 	return i, err
 }
 
 const getZones = `-- name: GetZones :many
-SELECT id, name
+SELECT id, name, serial, default_ttl, serial_scheme, nameservers, mbox, refresh, retry, expire, minimum
 FROM zones
 `
 
@@ -89,7 +170,19 @@ func (q *Queries) GetZones(ctx context.Context) ([]Zone, error) {
 	var items []Zone
 	for rows.Next() {
 		var i Zone
-		if err := rows.Scan(&i.ID, &i.Name); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Serial,
+			&i.DefaultTtl,
+			&i.SerialScheme,
+			&i.Nameservers,
+			&i.Mbox,
+			&i.Refresh,
+			&i.Retry,
+			&i.Expire,
+			&i.Minimum,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -102,3 +195,85 @@ func (q *Queries) GetZones(ctx context.Context) ([]Zone, error) {
 	}
 	return items, nil
 }
+
+const setZoneDefaultTtl = `-- name: SetZoneDefaultTtl :exec
+UPDATE zones
+SET default_ttl = ?
+WHERE id = ?
+`
+
+type SetZoneDefaultTtlParams struct {
+	DefaultTtl uint32 `json:"default_ttl"`
+	ID         int32  `json:"id"`
+}
+
+func (q *Queries) SetZoneDefaultTtl(ctx context.Context, arg SetZoneDefaultTtlParams) error {
+	_, err := q.db.ExecContext(ctx, setZoneDefaultTtl, arg.DefaultTtl, arg.ID)
+	return err
+}
+
+const setZoneSerial = `-- name: SetZoneSerial :exec
+UPDATE zones
+SET serial = ?
+WHERE id = ?
+`
+
+type SetZoneSerialParams struct {
+	Serial uint32 `json:"serial"`
+	ID     int32  `json:"id"`
+}
+
+func (q *Queries) SetZoneSerial(ctx context.Context, arg SetZoneSerialParams) error {
+	_, err := q.db.ExecContext(ctx, setZoneSerial, arg.Serial, arg.ID)
+	return err
+}
+
+const setZoneSerialScheme = `-- name: SetZoneSerialScheme :exec
+UPDATE zones
+SET serial_scheme = ?
+WHERE id = ?
+`
+
+type SetZoneSerialSchemeParams struct {
+	SerialScheme string `json:"serial_scheme"`
+	ID           int32  `json:"id"`
+}
+
+func (q *Queries) SetZoneSerialScheme(ctx context.Context, arg SetZoneSerialSchemeParams) error {
+	_, err := q.db.ExecContext(ctx, setZoneSerialScheme, arg.SerialScheme, arg.ID)
+	return err
+}
+
+const setZoneSoa = `-- name: SetZoneSoa :exec
+UPDATE zones
+SET nameservers = ?,
+    mbox        = ?,
+    refresh     = ?,
+    retry       = ?,
+    expire      = ?,
+    minimum     = ?
+WHERE id = ?
+`
+
+type SetZoneSoaParams struct {
+	Nameservers nulls.String `json:"nameservers"`
+	Mbox        nulls.String `json:"mbox"`
+	Refresh     nulls.UInt32 `json:"refresh"`
+	Retry       nulls.UInt32 `json:"retry"`
+	Expire      nulls.UInt32 `json:"expire"`
+	Minimum     nulls.UInt32 `json:"minimum"`
+	ID          int32        `json:"id"`
+}
+
+func (q *Queries) SetZoneSoa(ctx context.Context, arg SetZoneSoaParams) error {
+	_, err := q.db.ExecContext(ctx, setZoneSoa,
+		arg.Nameservers,
+		arg.Mbox,
+		arg.Refresh,
+		arg.Retry,
+		arg.Expire,
+		arg.Minimum,
+		arg.ID,
+	)
+	return err
+}
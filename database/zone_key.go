@@ -0,0 +1,42 @@
+package database
+
+import "context"
+
+// ZoneKeyChanges contains the changes made to the keys of a zone at once
+type ZoneKeyChanges struct {
+	Add      []AddZoneKeyParams
+	SetState []SetZoneKeyStateParams
+	Delete   []int32
+}
+
+// ChangeZoneKeys makes every change in a single transaction so a zone is never
+// left with only some of the changes, the IDs of the added keys are returned
+func (q *Queries) ChangeZoneKeys(ctx context.Context, changes ZoneKeyChanges) ([]int64, error) {
+	ids := make([]int64, 0, len(changes.Add))
+	err := q.Tx(ctx, nil, func(db *Queries) error {
+		for _, arg := range changes.Add {
+			id, err := db.AddZoneKey(ctx, arg)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		for _, arg := range changes.SetState {
+			err := db.SetZoneKeyState(ctx, arg)
+			if err != nil {
+				return err
+			}
+		}
+		for _, id := range changes.Delete {
+			err := db.DeleteZoneKey(ctx, id)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
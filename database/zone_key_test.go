@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQueries_ChangeZoneKeys(t *testing.T) {
+	db, f := newFakeDB(t, func(query string, args []any) ([]string, [][]driver.Value, error) {
+		return nil, nil, nil
+	})
+	ids, err := db.ChangeZoneKeys(context.Background(), ZoneKeyChanges{
+		Add: []AddZoneKeyParams{
+			{Zone: 1, Flags: 257, Algorithm: 13, State: "active"},
+			{Zone: 1, Flags: 256, Algorithm: 13, State: "active"},
+		},
+		SetState: []SetZoneKeyStateParams{{State: "retired", StateChangedAt: 100, ID: 3}},
+		Delete:   []int32{4},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, ids)
+	assert.Equal(t, []string{"AddZoneKey", "AddZoneKey", "SetZoneKeyState", "DeleteZoneKey"}, f.queryNames())
+	assert.Equal(t, []any{"retired", int64(100), int64(3)}, f.queries[2].args)
+	assert.Equal(t, []any{int64(4)}, f.queries[3].args)
+	assert.Equal(t, 1, f.commits)
+}
+
+func TestQueries_ChangeZoneKeys_rollback(t *testing.T) {
+	// the first key is removed if the second key can't be added
+	db, f := newFakeDB(t, func(query string, args []any) ([]string, [][]driver.Value, error) {
+		if args[1] == int64(256) {
+			return nil, nil, errors.New("insert failed")
+		}
+		return nil, nil, nil
+	})
+	ids, err := db.ChangeZoneKeys(context.Background(), ZoneKeyChanges{
+		Add: []AddZoneKeyParams{
+			{Zone: 1, Flags: 257, Algorithm: 13, State: "active"},
+			{Zone: 1, Flags: 256, Algorithm: 13, State: "active"},
+		},
+	})
+	assert.Error(t, err)
+	assert.Nil(t, ids)
+	assert.Zero(t, f.commits)
+	assert.Equal(t, 1, f.rollbacks)
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQueries_GetZoneForName(t *testing.T) {
+	db, f := newFakeDB(t, func(query string, args []any) ([]string, [][]driver.Value, error) {
+		for _, i := range args {
+			if i == "example.com." {
+				return zoneColumns, [][]driver.Value{fakeZoneRow(1, "example.com.")}, nil
+			}
+		}
+		return zoneColumns, nil, nil
+	})
+
+	zone, err := db.GetZoneForName(context.Background(), "www.example.com.")
+	assert.NoError(t, err)
+	assert.Equal(t, Zone{ID: 1, Name: "example.com.", Serial: 1, DefaultTtl: 300, SerialScheme: "date"}, zone)
+
+	// every suffix is matched against the zone name index
+	if assert.Len(t, f.queries, 1) {
+		assert.Contains(t, f.queries[0].query, "WHERE name IN (?,?,?)")
+		assert.Equal(t, []any{"www.example.com.", "example.com.", "com."}, f.queries[0].args)
+	}
+
+	_, err = db.GetZoneForName(context.Background(), "example.org.")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
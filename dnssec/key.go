@@ -0,0 +1,99 @@
+package dnssec
+
+import (
+	"github.com/1f349/azalea/database"
+	"github.com/miekg/dns"
+	"time"
+)
+
+// Key states stored in the zone_keys table
+//
+// A ZSK rollover pre-publishes the new key in the published state, once the
+// new DNSKEY has propagated it becomes active and the old key is retired until
+// the old signatures have expired from caches.
+//
+// A KSK rollover uses the double-DS method, the new key starts in the
+// ds-pending state where only the DS and CDS records are published. Once the
+// new DS record has been seen in the parent zone, either by the DS resolver or
+// confirmed with the ds-seen API, the key moves to the ds-published state,
+// then after the parent DS TTL the new key replaces the old key in the DNSKEY
+// RRset and the old key is retired until its DS record can be removed from the
+// parent zone.
+const (
+	StateDsPending   = "ds-pending"
+	StateDsPublished = "ds-published"
+	StatePublished   = "published"
+	StateActive      = "active"
+	StateRetired     = "retired"
+)
+
+// IsKsk returns true if the key has the secure entry point flag
+func IsKsk(key database.ZoneKey) bool {
+	return key.Flags&dns.SEP != 0
+}
+
+// InDnskeySet returns true if the key is published in the DNSKEY RRset
+func InDnskeySet(key database.ZoneKey) bool {
+	switch key.State {
+	case StatePublished, StateActive:
+		return true
+	case StateRetired:
+		return !IsKsk(key)
+	}
+	return false
+}
+
+// Signs returns true if the key is used to generate signatures
+func Signs(key database.ZoneKey) bool {
+	return key.State == StateActive
+}
+
+// InDsSet returns true if the key should have a DS record in the parent zone,
+// these keys are published as CDS and CDNSKEY records
+func InDsSet(key database.ZoneKey) bool {
+	return IsKsk(key) && key.State != StatePublished
+}
+
+// DNSKEY returns the DNSKEY record for the zone key
+func DNSKEY(zone string, key database.ZoneKey) *dns.DNSKEY {
+	return &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET},
+		Flags:     key.Flags,
+		Protocol:  3,
+		Algorithm: key.Algorithm,
+		PublicKey: key.PublicKey,
+	}
+}
+
+// DsRecords returns the SHA-256 DS records which should be published in the
+// parent zone
+func DsRecords(zone string, keys []database.ZoneKey) []*dns.DS {
+	var out []*dns.DS
+	for _, i := range keys {
+		if !InDsSet(i) {
+			continue
+		}
+		if ds := DNSKEY(zone, i).ToDS(dns.SHA256); ds != nil {
+			out = append(out, ds)
+		}
+	}
+	return out
+}
+
+// GenerateKey generates a new ECDSA P-256 key for the zone
+func GenerateKey(zone database.Zone, flags uint16, state string, now time.Time) (database.AddZoneKeyParams, error) {
+	dnskey := DNSKEY(zone.Name, database.ZoneKey{Flags: flags, Algorithm: dns.ECDSAP256SHA256})
+	priv, err := dnskey.Generate(256)
+	if err != nil {
+		return database.AddZoneKeyParams{}, err
+	}
+	return database.AddZoneKeyParams{
+		Zone:           zone.ID,
+		Flags:          dnskey.Flags,
+		Algorithm:      dnskey.Algorithm,
+		PublicKey:      dnskey.PublicKey,
+		PrivateKey:     dnskey.PrivateKeyString(priv),
+		State:          state,
+		StateChangedAt: now.Unix(),
+	}, nil
+}
@@ -0,0 +1,421 @@
+package dnssec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/logger"
+	"github.com/miekg/dns"
+	"github.com/rcrowley/go-metrics"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkInterval is how often the key states of every signed zone are checked
+const checkInterval = time.Minute
+
+var (
+	ErrAlreadyEnabled     = errors.New("dnssec is already enabled")
+	ErrNotEnabled         = errors.New("dnssec is not enabled")
+	ErrRolloverInProgress = errors.New("key rollover is already in progress")
+	ErrNoPendingDs        = errors.New("no key is waiting for a DS record")
+	ErrHasSecondaries     = errors.New("zones with secondaries cannot be signed")
+)
+
+type managerQueries interface {
+	GetZone(ctx context.Context, zone string) (database.Zone, error)
+	GetSignedZones(ctx context.Context) ([]database.Zone, error)
+	GetZoneKeys(ctx context.Context, name string) ([]database.ZoneKey, error)
+	ChangeZoneKeys(ctx context.Context, changes database.ZoneKeyChanges) ([]int64, error)
+}
+
+// Manager creates zone keys and moves them through the rollover states using
+// the policy from the config
+//
+// Zones with secondaries are never signed, the zone is signed when answering
+// queries and the NSEC3 records are generated for each query so there is no
+// signed zone which could be transferred to the secondaries.
+type Manager struct {
+	db          managerQueries
+	policy      conf.DnssecConf
+	secondaries map[string]bool
+
+	// dsResolver is the recursive resolver used to find the DS records in the
+	// parent zone, empty if the DS records are confirmed using the API
+	dsResolver string
+	dsClient   *dns.Client
+
+	// mu prevents the scheduler and the API changing keys at the same time
+	mu        *sync.Mutex
+	closeOnce sync.Once
+	stop      chan struct{}
+}
+
+func NewManager(db managerQueries, policy conf.DnssecConf, transfer map[string]conf.TransferConf) *Manager {
+	if policy.Propagation == 0 {
+		policy.Propagation = time.Hour
+	}
+	if policy.ParentDsTtl == 0 {
+		policy.ParentDsTtl = 24 * time.Hour
+	}
+	if policy.DsResolver != "" {
+		if _, _, err := net.SplitHostPort(policy.DsResolver); err != nil {
+			policy.DsResolver = net.JoinHostPort(policy.DsResolver, "53")
+		}
+	}
+	secondaries := make(map[string]bool, len(transfer))
+	for zone := range transfer {
+		secondaries[dns.Fqdn(strings.ToLower(zone))] = true
+	}
+	return &Manager{
+		db:          db,
+		policy:      policy,
+		secondaries: secondaries,
+		dsResolver:  policy.DsResolver,
+		dsClient:    &dns.Client{Timeout: 5 * time.Second},
+		mu:          new(sync.Mutex),
+		stop:        make(chan struct{}),
+	}
+}
+
+// CheckSecondaries returns an error if any signed zone has secondaries, the
+// secondaries would serve the zone unsigned which makes the answers bogus
+// once the DS record is published
+func (m *Manager) CheckSecondaries(ctx context.Context) error {
+	zones, err := m.db.GetSignedZones(ctx)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, zone := range zones {
+		if m.secondaries[zone.Name] {
+			names = append(names, zone.Name)
+		}
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("%w: %s", ErrHasSecondaries, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// Run starts checking the key states in the background
+func (m *Manager) Run() {
+	go func() {
+		t := time.NewTicker(checkInterval)
+		defer t.Stop()
+		for {
+			err := m.Check(context.Background(), time.Now())
+			if err != nil {
+				logger.Logger.Error("Failed to check DNSSEC keys", "err", err)
+			}
+			select {
+			case <-m.stop:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+func (m *Manager) Close() {
+	m.closeOnce.Do(func() {
+		close(m.stop)
+	})
+}
+
+// Enable creates an active KSK and ZSK for the zone
+func (m *Manager) Enable(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	zone, keys, err := m.zoneKeys(ctx, name)
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return ErrAlreadyEnabled
+	}
+	if m.secondaries[zone.Name] {
+		return ErrHasSecondaries
+	}
+	now := time.Now()
+	err = m.apply(ctx, zone, []keyAction{
+		{add: true, flags: dns.ZONE | dns.SEP, state: StateActive},
+		{add: true, flags: dns.ZONE, state: StateActive},
+	}, now)
+	if err != nil {
+		return err
+	}
+	logger.Logger.Info("Enabled DNSSEC", "zone", zone.Name)
+	return nil
+}
+
+// Rollover starts a ZSK or KSK rollover immediately
+func (m *Manager) Rollover(ctx context.Context, name string, ksk bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	zone, keys, err := m.zoneKeys(ctx, name)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return ErrNotEnabled
+	}
+	action, ok := startRollover(keys, ksk)
+	if !ok {
+		return ErrRolloverInProgress
+	}
+	return m.apply(ctx, zone, []keyAction{action}, time.Now())
+}
+
+// ConfirmDs marks the DS records of the pending KSKs as seen in the parent
+// zone, the new KSK becomes active once the parent DS TTL has passed
+func (m *Manager) ConfirmDs(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	zone, keys, err := m.zoneKeys(ctx, name)
+	if err != nil {
+		return err
+	}
+	var actions []keyAction
+	for _, i := range keys {
+		if i.State == StateDsPending {
+			actions = append(actions, keyAction{id: i.ID, state: StateDsPublished})
+		}
+	}
+	if len(actions) == 0 {
+		return ErrNoPendingDs
+	}
+	return m.apply(ctx, zone, actions, time.Now())
+}
+
+// Check moves the keys of every signed zone to the next state when the policy
+// timings have passed, KSKs waiting for a DS record are moved on once the DS
+// record is found using the DS resolver
+func (m *Manager) Check(ctx context.Context, now time.Time) error {
+	zones, err := m.db.GetSignedZones(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	var waiting int64
+	for _, zone := range zones {
+		keys, err := m.db.GetZoneKeys(ctx, zone.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		actions, err := m.confirmParentDs(ctx, zone.Name, keys, now)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		actions = append(actions, m.plan(keys, now)...)
+		err = m.apply(ctx, zone, actions, now)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, i := range keys {
+			if i.State == StateDsPending {
+				waiting++
+			}
+		}
+	}
+
+	// rollovers waiting for a DS record are blocked until the DS record is
+	// added to the parent zone
+	metrics.GetOrRegisterGauge("dnssec.key.waiting_ds", metrics.DefaultRegistry).Update(waiting)
+	return errors.Join(errs...)
+}
+
+// confirmParentDs returns the actions moving the pending KSKs to the
+// ds-published state if their DS record is in the parent zone, the keys are
+// changed to the new state so the plan uses the new state
+func (m *Manager) confirmParentDs(ctx context.Context, zone string, keys []database.ZoneKey, now time.Time) ([]keyAction, error) {
+	if m.dsResolver == "" || !slices.ContainsFunc(keys, func(key database.ZoneKey) bool {
+		return key.State == StateDsPending
+	}) {
+		return nil, nil
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion(zone, dns.TypeDS)
+	resp, _, err := m.dsClient.ExchangeContext(ctx, req, m.dsResolver)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("DS resolver returned %s for %s", dns.RcodeToString[resp.Rcode], zone)
+	}
+
+	var actions []keyAction
+	for n, i := range keys {
+		if i.State != StateDsPending || !parentHasDs(zone, i, resp.Answer) {
+			continue
+		}
+		keys[n].State = StateDsPublished
+		keys[n].StateChangedAt = now.Unix()
+		actions = append(actions, keyAction{id: i.ID, state: StateDsPublished})
+	}
+	return actions, nil
+}
+
+// parentHasDs returns true if the records contain a DS record for the key
+func parentHasDs(zone string, key database.ZoneKey, rrs []dns.RR) bool {
+	dnskey := DNSKEY(zone, key)
+	for _, rr := range rrs {
+		ds, ok := rr.(*dns.DS)
+		if !ok || !strings.EqualFold(ds.Hdr.Name, zone) {
+			continue
+		}
+		want := dnskey.ToDS(ds.DigestType)
+		if want != nil && want.KeyTag == ds.KeyTag && want.Algorithm == ds.Algorithm && strings.EqualFold(want.Digest, ds.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) zoneKeys(ctx context.Context, name string) (database.Zone, []database.ZoneKey, error) {
+	zone, err := m.db.GetZone(ctx, name)
+	if err != nil {
+		return database.Zone{}, nil, err
+	}
+	keys, err := m.db.GetZoneKeys(ctx, name)
+	return zone, keys, err
+}
+
+// keyAction is a single change to the zone keys, either adding a key, changing
+// the state of a key or deleting a key
+type keyAction struct {
+	add    bool
+	delete bool
+	id     int32
+	flags  uint16
+	state  string
+}
+
+// plan returns the actions needed to move the keys to their next state
+func (m *Manager) plan(keys []database.ZoneKey, now time.Time) []keyAction {
+	age := func(key database.ZoneKey) time.Duration {
+		return now.Sub(time.Unix(key.StateChangedAt, 0))
+	}
+	var actions []keyAction
+	retireActive := func(ksk bool) {
+		for _, i := range keys {
+			if IsKsk(i) == ksk && i.State == StateActive {
+				actions = append(actions, keyAction{id: i.ID, state: StateRetired})
+			}
+		}
+	}
+
+	rolling := map[bool]bool{}
+	for _, i := range keys {
+		switch {
+		case i.StateChangedAt == 0:
+			// keys from before the state timestamps were added have an unknown
+			// age, the age starts from now instead of the key being treated as
+			// infinitely old
+			actions = append(actions, keyAction{id: i.ID, state: i.State})
+		case i.State == StatePublished && !IsKsk(i) && age(i) >= m.policy.Propagation:
+			// the new ZSK has propagated so it replaces the old ZSK
+			actions = append(actions, keyAction{id: i.ID, state: StateActive})
+			retireActive(false)
+		case i.State == StateDsPublished && IsKsk(i) && age(i) >= m.policy.ParentDsTtl:
+			// the new DS record has reached every resolver so the new KSK
+			// replaces the old KSK
+			actions = append(actions, keyAction{id: i.ID, state: StateActive})
+			retireActive(true)
+		case i.State == StateRetired && age(i) >= m.policy.Propagation:
+			actions = append(actions, keyAction{delete: true, id: i.ID})
+		}
+		if i.State != StateActive && i.State != StateRetired {
+			rolling[IsKsk(i)] = true
+		}
+	}
+
+	// start a rollover when the newest active key has reached its lifetime
+	for _, ksk := range []bool{false, true} {
+		lifetime := m.policy.ZskLifetime
+		if ksk {
+			lifetime = m.policy.KskLifetime
+		}
+		if lifetime == 0 || rolling[ksk] {
+			continue
+		}
+		newest := time.Duration(-1)
+		for _, i := range keys {
+			if IsKsk(i) == ksk && i.State == StateActive && i.StateChangedAt != 0 && (newest < 0 || age(i) < newest) {
+				newest = age(i)
+			}
+		}
+		if newest >= lifetime {
+			action, _ := startRollover(keys, ksk)
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// startRollover returns the action which adds the new key for a rollover, the
+// return value is false if a rollover is already in progress
+func startRollover(keys []database.ZoneKey, ksk bool) (keyAction, bool) {
+	for _, i := range keys {
+		if IsKsk(i) == ksk && i.State != StateActive && i.State != StateRetired {
+			return keyAction{}, false
+		}
+	}
+	if ksk {
+		return keyAction{add: true, flags: dns.ZONE | dns.SEP, state: StateDsPending}, true
+	}
+	return keyAction{add: true, flags: dns.ZONE, state: StatePublished}, true
+}
+
+// apply makes the changes in a single transaction so a failed change leaves
+// the keys in their previous states
+func (m *Manager) apply(ctx context.Context, zone database.Zone, actions []keyAction, now time.Time) error {
+	if len(actions) == 0 {
+		return nil
+	}
+	var changes database.ZoneKeyChanges
+	for _, action := range actions {
+		switch {
+		case action.add:
+			key, err := GenerateKey(zone, action.flags, action.state, now)
+			if err != nil {
+				return err
+			}
+			changes.Add = append(changes.Add, key)
+		case action.delete:
+			changes.Delete = append(changes.Delete, action.id)
+		default:
+			changes.SetState = append(changes.SetState, database.SetZoneKeyStateParams{
+				State:          action.state,
+				StateChangedAt: now.Unix(),
+				ID:             action.id,
+			})
+		}
+	}
+	ids, err := m.db.ChangeZoneKeys(ctx, changes)
+	if err != nil {
+		metrics.GetOrRegisterCounter("dnssec.key.failed", metrics.DefaultRegistry).Inc(1)
+		return err
+	}
+	metrics.GetOrRegisterCounter("dnssec.key.changes", metrics.DefaultRegistry).Inc(int64(len(actions)))
+
+	for n, key := range changes.Add {
+		logger.Logger.Info("Added DNSSEC key", "zone", zone.Name, "id", ids[n], "flags", key.Flags, "state", key.State)
+	}
+	for _, i := range changes.SetState {
+		logger.Logger.Info("Changed DNSSEC key state", "zone", zone.Name, "id", i.ID, "state", i.State)
+	}
+	for _, id := range changes.Delete {
+		logger.Logger.Info("Removed DNSSEC key", "zone", zone.Name, "id", id)
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package dnssec
+
+import (
+	"context"
+	"database/sql"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/database"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestManager_plan(t *testing.T) {
+	m := NewManager(nil, conf.DnssecConf{
+		ZskLifetime: 30 * 24 * time.Hour,
+		KskLifetime: 365 * 24 * time.Hour,
+		Propagation: time.Hour,
+		ParentDsTtl: 24 * time.Hour,
+	}, nil)
+	now := time.Now()
+	ago := func(d time.Duration) int64 {
+		return now.Add(-d).Unix()
+	}
+	ksk := uint16(dns.ZONE | dns.SEP)
+
+	t.Run("no changes", func(t *testing.T) {
+		assert.Empty(t, m.plan([]database.ZoneKey{
+			{ID: 1, Flags: ksk, State: StateActive, StateChangedAt: ago(time.Hour)},
+			{ID: 2, Flags: dns.ZONE, State: StateActive, StateChangedAt: ago(time.Hour)},
+		}, now))
+	})
+	t.Run("zsk lifetime", func(t *testing.T) {
+		assert.Equal(t, []keyAction{
+			{add: true, flags: dns.ZONE, state: StatePublished},
+		}, m.plan([]database.ZoneKey{
+			{ID: 1, Flags: ksk, State: StateActive, StateChangedAt: ago(time.Hour)},
+			{ID: 2, Flags: dns.ZONE, State: StateActive, StateChangedAt: ago(31 * 24 * time.Hour)},
+		}, now))
+	})
+	t.Run("zsk published", func(t *testing.T) {
+		keys := []database.ZoneKey{
+			{ID: 1, Flags: ksk, State: StateActive, StateChangedAt: ago(time.Hour)},
+			{ID: 2, Flags: dns.ZONE, State: StateActive, StateChangedAt: ago(31 * 24 * time.Hour)},
+			{ID: 3, Flags: dns.ZONE, State: StatePublished, StateChangedAt: ago(time.Minute)},
+		}
+		assert.Empty(t, m.plan(keys, now))
+
+		keys[2].StateChangedAt = ago(2 * time.Hour)
+		assert.Equal(t, []keyAction{
+			{id: 3, state: StateActive},
+			{id: 2, state: StateRetired},
+		}, m.plan(keys, now))
+	})
+	t.Run("zsk retired", func(t *testing.T) {
+		assert.Equal(t, []keyAction{
+			{delete: true, id: 2},
+		}, m.plan([]database.ZoneKey{
+			{ID: 1, Flags: ksk, State: StateActive, StateChangedAt: ago(time.Hour)},
+			{ID: 2, Flags: dns.ZONE, State: StateRetired, StateChangedAt: ago(2 * time.Hour)},
+			{ID: 3, Flags: dns.ZONE, State: StateActive, StateChangedAt: ago(2 * time.Hour)},
+		}, now))
+	})
+	t.Run("ksk lifetime", func(t *testing.T) {
+		assert.Equal(t, []keyAction{
+			{add: true, flags: ksk, state: StateDsPending},
+		}, m.plan([]database.ZoneKey{
+			{ID: 1, Flags: ksk, State: StateActive, StateChangedAt: ago(366 * 24 * time.Hour)},
+			{ID: 2, Flags: dns.ZONE, State: StateActive, StateChangedAt: ago(time.Hour)},
+		}, now))
+	})
+	t.Run("ksk waits for ds", func(t *testing.T) {
+		keys := []database.ZoneKey{
+			{ID: 1, Flags: ksk, State: StateActive, StateChangedAt: ago(400 * 24 * time.Hour)},
+			{ID: 2, Flags: dns.ZONE, State: StateActive, StateChangedAt: ago(time.Hour)},
+			{ID: 3, Flags: ksk, State: StateDsPending, StateChangedAt: ago(30 * 24 * time.Hour)},
+		}
+		assert.Empty(t, m.plan(keys, now))
+
+		keys[2].State = StateDsPublished
+		keys[2].StateChangedAt = ago(time.Hour)
+		assert.Empty(t, m.plan(keys, now))
+
+		keys[2].StateChangedAt = ago(25 * time.Hour)
+		assert.Equal(t, []keyAction{
+			{id: 3, state: StateActive},
+			{id: 1, state: StateRetired},
+		}, m.plan(keys, now))
+	})
+	t.Run("legacy keys", func(t *testing.T) {
+		// keys without a timestamp get one instead of starting a rollover
+		keys := []database.ZoneKey{
+			{ID: 1, Flags: ksk, State: StateActive},
+			{ID: 2, Flags: dns.ZONE, State: StateActive},
+		}
+		assert.Equal(t, []keyAction{
+			{id: 1, state: StateActive},
+			{id: 2, state: StateActive},
+		}, m.plan(keys, now))
+
+		keys[1].State = StateRetired
+		assert.Equal(t, []keyAction{
+			{id: 1, state: StateActive},
+			{id: 2, state: StateRetired},
+		}, m.plan(keys, now))
+	})
+}
+
+func TestKeySets(t *testing.T) {
+	ksk := uint16(dns.ZONE | dns.SEP)
+	for _, i := range []struct {
+		key                    database.ZoneKey
+		dnskey, signs, inDsSet bool
+	}{
+		{database.ZoneKey{Flags: ksk, State: StateDsPending}, false, false, true},
+		{database.ZoneKey{Flags: ksk, State: StateDsPublished}, false, false, true},
+		{database.ZoneKey{Flags: ksk, State: StateActive}, true, true, true},
+		{database.ZoneKey{Flags: ksk, State: StateRetired}, false, false, true},
+		{database.ZoneKey{Flags: dns.ZONE, State: StatePublished}, true, false, false},
+		{database.ZoneKey{Flags: dns.ZONE, State: StateActive}, true, true, false},
+		{database.ZoneKey{Flags: dns.ZONE, State: StateRetired}, true, false, false},
+	} {
+		assert.Equal(t, i.dnskey, InDnskeySet(i.key), i.key)
+		assert.Equal(t, i.signs, Signs(i.key), i.key)
+		assert.Equal(t, i.inDsSet, InDsSet(i.key), i.key)
+	}
+}
+
+// fakeKeyStore keeps the zone keys in memory for a single zone
+type fakeKeyStore struct {
+	zone    database.Zone
+	signed  bool
+	keys    []database.ZoneKey
+	lastId  int32
+	changes int
+}
+
+func (f *fakeKeyStore) GetZone(_ context.Context, zone string) (database.Zone, error) {
+	if zone != f.zone.Name {
+		return database.Zone{}, sql.ErrNoRows
+	}
+	return f.zone, nil
+}
+
+func (f *fakeKeyStore) GetSignedZones(_ context.Context) ([]database.Zone, error) {
+	if len(f.keys) == 0 && !f.signed {
+		return nil, nil
+	}
+	return []database.Zone{f.zone}, nil
+}
+
+func (f *fakeKeyStore) GetZoneKeys(_ context.Context, name string) ([]database.ZoneKey, error) {
+	if name != f.zone.Name {
+		return nil, nil
+	}
+	return f.keys, nil
+}
+
+func (f *fakeKeyStore) ChangeZoneKeys(_ context.Context, changes database.ZoneKeyChanges) ([]int64, error) {
+	f.changes++
+	var ids []int64
+	for _, arg := range changes.Add {
+		f.lastId++
+		f.keys = append(f.keys, database.ZoneKey{
+			ID:             f.lastId,
+			Zone:           arg.Zone,
+			Flags:          arg.Flags,
+			Algorithm:      arg.Algorithm,
+			PublicKey:      arg.PublicKey,
+			PrivateKey:     arg.PrivateKey,
+			State:          arg.State,
+			StateChangedAt: arg.StateChangedAt,
+		})
+		ids = append(ids, int64(f.lastId))
+	}
+	for _, arg := range changes.SetState {
+		for n := range f.keys {
+			if f.keys[n].ID == arg.ID {
+				f.keys[n].State = arg.State
+				f.keys[n].StateChangedAt = arg.StateChangedAt
+			}
+		}
+	}
+	f.keys = slices.DeleteFunc(f.keys, func(key database.ZoneKey) bool {
+		return slices.Contains(changes.Delete, key.ID)
+	})
+	return ids, nil
+}
+
+func TestManager_Enable(t *testing.T) {
+	db := &fakeKeyStore{zone: database.Zone{ID: 1, Name: "example.com."}}
+	m := NewManager(db, conf.DnssecConf{}, map[string]conf.TransferConf{
+		"Example.org": {Allow: []string{"192.0.2.1"}},
+	})
+	assert.NoError(t, m.Enable(context.Background(), "example.com."))
+
+	// both keys are added in a single transaction
+	assert.Equal(t, 1, db.changes)
+	if assert.Len(t, db.keys, 2) {
+		assert.True(t, IsKsk(db.keys[0]))
+		assert.False(t, IsKsk(db.keys[1]))
+		assert.Equal(t, StateActive, db.keys[0].State)
+		assert.Equal(t, StateActive, db.keys[1].State)
+	}
+	assert.ErrorIs(t, m.Enable(context.Background(), "example.com."), ErrAlreadyEnabled)
+	assert.ErrorIs(t, m.Enable(context.Background(), "example.net."), sql.ErrNoRows)
+
+	// secondaries cannot serve signed zones
+	db = &fakeKeyStore{zone: database.Zone{ID: 2, Name: "example.org."}}
+	m.db = db
+	assert.ErrorIs(t, m.Enable(context.Background(), "example.org."), ErrHasSecondaries)
+	assert.Empty(t, db.keys)
+}
+
+func TestManager_CheckSecondaries(t *testing.T) {
+	db := &fakeKeyStore{zone: database.Zone{ID: 1, Name: "example.com."}, signed: true}
+	m := NewManager(db, conf.DnssecConf{}, map[string]conf.TransferConf{
+		"example.org": {Notify: []string{"192.0.2.1"}},
+	})
+	assert.NoError(t, m.CheckSecondaries(context.Background()))
+
+	m = NewManager(db, conf.DnssecConf{}, map[string]conf.TransferConf{
+		"example.com": {Notify: []string{"192.0.2.1"}},
+	})
+	err := m.CheckSecondaries(context.Background())
+	assert.ErrorIs(t, err, ErrHasSecondaries)
+	assert.ErrorContains(t, err, "example.com.")
+}
+
+func TestManager_Check(t *testing.T) {
+	now := time.Now()
+	db := &fakeKeyStore{zone: database.Zone{ID: 1, Name: "example.com."}, lastId: 2}
+	for _, flags := range []uint16{dns.ZONE | dns.SEP, dns.ZONE} {
+		params, err := GenerateKey(db.zone, flags, StateActive, now.Add(-time.Hour))
+		assert.NoError(t, err)
+		_, err = db.ChangeZoneKeys(context.Background(), database.ZoneKeyChanges{Add: []database.AddZoneKeyParams{params}})
+		assert.NoError(t, err)
+	}
+	params, err := GenerateKey(db.zone, dns.ZONE|dns.SEP, StateDsPending, now.Add(-time.Hour))
+	assert.NoError(t, err)
+	_, err = db.ChangeZoneKeys(context.Background(), database.ZoneKeyChanges{Add: []database.AddZoneKeyParams{params}})
+	assert.NoError(t, err)
+	pending := DNSKEY("example.com.", db.keys[2]).ToDS(dns.SHA256)
+
+	// the parent zone only has the DS record for the new key after the first
+	// check
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	published := make(chan bool, 1)
+	published <- false
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+		if <-published {
+			msg.Answer = append(msg.Answer, pending)
+		}
+		published <- true
+		_ = w.WriteMsg(msg)
+	})}
+	go func() { _ = srv.ActivateAndServe() }()
+	defer srv.Shutdown()
+
+	m := NewManager(db, conf.DnssecConf{ParentDsTtl: time.Hour, DsResolver: pc.LocalAddr().String()}, nil)
+	db.changes = 0
+	assert.NoError(t, m.Check(context.Background(), now))
+	assert.Equal(t, StateDsPending, db.keys[2].State)
+	assert.Zero(t, db.changes)
+
+	assert.NoError(t, m.Check(context.Background(), now))
+	assert.Equal(t, StateDsPublished, db.keys[2].State)
+	assert.Equal(t, 1, db.changes)
+
+	// the new KSK replaces the old KSK after the parent DS TTL in a single
+	// transaction
+	assert.NoError(t, m.Check(context.Background(), now.Add(2*time.Hour)))
+	assert.Equal(t, StateRetired, db.keys[0].State)
+	assert.Equal(t, StateActive, db.keys[2].State)
+	assert.Equal(t, 2, db.changes)
+}
+
+func TestManager_Check_noDsResolver(t *testing.T) {
+	db := &fakeKeyStore{zone: database.Zone{ID: 1, Name: "example.com."}, keys: []database.ZoneKey{
+		{ID: 1, Flags: dns.ZONE | dns.SEP, State: StateActive, StateChangedAt: 1},
+		{ID: 2, Flags: dns.ZONE, State: StateActive, StateChangedAt: 1},
+		{ID: 3, Flags: dns.ZONE | dns.SEP, State: StateDsPending, StateChangedAt: 1},
+	}}
+
+	// the rollover waits for the DS record to be confirmed with the API
+	m := NewManager(db, conf.DnssecConf{}, nil)
+	assert.NoError(t, m.Check(context.Background(), time.Now()))
+	assert.Equal(t, StateDsPending, db.keys[2].State)
+	assert.Zero(t, db.changes)
+
+	assert.NoError(t, m.ConfirmDs(context.Background(), "example.com."))
+	assert.Equal(t, StateDsPublished, db.keys[2].State)
+	assert.ErrorIs(t, m.ConfirmDs(context.Background(), "example.com."), ErrNoPendingDs)
+}
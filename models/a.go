@@ -28,10 +28,14 @@ func (a *A) UnmarshalJSON(bytes []byte) error {
 	if ip.Zone() != "" {
 		return errors.New("zones are not supported")
 	}
-	if !ip.Is4() {
+	a.IP = ip.AsSlice()
+	return a.Validate()
+}
+
+func (a A) Validate() error {
+	if a.IP.To4() == nil {
 		return errors.New("not an IPv4 address")
 	}
-	a.IP = ip.AsSlice()
 	return nil
 }
 
@@ -32,6 +32,13 @@ func (aaaa *AAAA) UnmarshalJSON(bytes []byte) error {
 		return errors.New("not an IPv6 address")
 	}
 	aaaa.IP = ip.AsSlice()
+	return aaaa.Validate()
+}
+
+func (aaaa AAAA) Validate() error {
+	if len(aaaa.IP) != net.IPv6len {
+		return errors.New("not an IPv6 address")
+	}
 	return nil
 }
 
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/miekg/dns"
+)
+
+// TypeALIAS is the private use type number of the ALIAS pseudo-type, this is
+// the same number used by PowerDNS
+const TypeALIAS uint16 = 65401
+
+func init() {
+	dns.PrivateHandle("ALIAS", TypeALIAS, func() dns.PrivateRdata { return new(ALIAS) })
+}
+
+var _ json.Marshaler = (*ALIAS)(nil)
+var _ json.Unmarshaler = (*ALIAS)(nil)
+var _ dns.PrivateRdata = (*ALIAS)(nil)
+
+// ALIAS points a name at the A and AAAA records of the target, unlike a CNAME
+// this is allowed at the zone apex as the address records are synthesised
+type ALIAS struct {
+	Target string
+}
+
+func (alias ALIAS) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dns.Fqdn(alias.Target))
+}
+
+func (alias *ALIAS) UnmarshalJSON(bytes []byte) error {
+	err := json.Unmarshal(bytes, &alias.Target)
+	if err != nil {
+		return err
+	}
+	if err := alias.Validate(); err != nil {
+		return err
+	}
+	alias.Target = dns.Fqdn(alias.Target)
+	return nil
+}
+
+func (alias ALIAS) Validate() error {
+	if _, ok := dns.IsDomainName(alias.Target); !ok {
+		return errors.New("invalid ALIAS value")
+	}
+	return nil
+}
+
+func (alias ALIAS) ValueRR(header dns.RR_Header) dns.RR {
+	rr := dns.TypeToRR[TypeALIAS]().(*dns.PrivateRR)
+	rr.Hdr = header
+	rr.Data = &ALIAS{Target: alias.Target}
+	return rr
+}
+
+func (alias ALIAS) ValueType() uint16 {
+	return TypeALIAS
+}
+
+func (alias ALIAS) EncodeValue() string {
+	return alias.Target
+}
+
+// String, Parse, Pack, Unpack, Copy and Len implement dns.PrivateRdata so
+// ALIAS records can be written to zone files and sent in zone transfers
+
+func (alias *ALIAS) String() string {
+	return dns.Fqdn(alias.Target)
+}
+
+func (alias *ALIAS) Parse(data []string) error {
+	if len(data) != 1 {
+		return errors.New("invalid ALIAS value")
+	}
+	if _, ok := dns.IsDomainName(data[0]); !ok {
+		return errors.New("invalid ALIAS value")
+	}
+	alias.Target = dns.Fqdn(data[0])
+	return nil
+}
+
+func (alias *ALIAS) Pack(buf []byte) (int, error) {
+	return dns.PackDomainName(dns.Fqdn(alias.Target), buf, 0, nil, false)
+}
+
+func (alias *ALIAS) Unpack(buf []byte) (int, error) {
+	target, off, err := dns.UnpackDomainName(buf, 0)
+	if err != nil {
+		return 0, err
+	}
+	alias.Target = target
+	return off, nil
+}
+
+func (alias *ALIAS) Copy(dest dns.PrivateRdata) error {
+	d, ok := dest.(*ALIAS)
+	if !ok {
+		return dns.ErrRdata
+	}
+	d.Target = alias.Target
+	return nil
+}
+
+func (alias *ALIAS) Len() int {
+	buf := make([]byte, 256)
+	n, err := alias.Pack(buf)
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"net/url"
+	"strings"
+)
+
+var _ json.Unmarshaler = (*CAA)(nil)
+
+// caaCritical is the issuer critical flag from RFC 8659
+const caaCritical = 128
+
+type CAA struct {
+	Flag  uint8  `json:"flag"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+func (caa *CAA) UnmarshalJSON(bytes []byte) error {
+	type inner CAA
+	var a inner
+	err := json.Unmarshal(bytes, &a)
+	if err != nil {
+		return err
+	}
+	*caa = CAA(a)
+	caa.Tag = strings.ToLower(caa.Tag)
+	return caa.Validate()
+}
+
+// Validate checks the flag, tag and value follow RFC 8659, the values of
+// properties other than issue, issuewild and iodef are not checked
+func (caa CAA) Validate() error {
+	if caa.Flag != 0 && caa.Flag != caaCritical {
+		return errors.New("invalid CAA flag")
+	}
+	if !isCaaTag(caa.Tag) {
+		return errors.New("invalid CAA tag")
+	}
+	if hasControlChars(caa.Value) {
+		return errors.New("invalid CAA value")
+	}
+	switch caa.Tag {
+	case "issue", "issuewild":
+		return validateCaaIssuer(caa.Value)
+	case "iodef":
+		u, err := url.Parse(caa.Value)
+		if err != nil {
+			return fmt.Errorf("invalid CAA iodef URL: %w", err)
+		}
+		switch u.Scheme {
+		case "mailto", "http", "https":
+			return nil
+		}
+		return errors.New("invalid CAA iodef URL scheme")
+	}
+	return nil
+}
+
+// isCaaTag checks the tag is 1 to 15 lowercase letters and digits
+func isCaaTag(tag string) bool {
+	if len(tag) < 1 || len(tag) > 15 {
+		return false
+	}
+	for _, r := range tag {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateCaaIssuer checks the value of an issue or issuewild property, this is
+// an optional issuer domain followed by semicolon separated parameters
+func validateCaaIssuer(value string) error {
+	issuer, params, _ := strings.Cut(value, ";")
+	issuer = strings.TrimSpace(issuer)
+	if issuer != "" {
+		for _, label := range strings.Split(issuer, ".") {
+			if label == "" || !isAlphanumeric(strings.ReplaceAll(label, "-", "")) {
+				return errors.New("invalid CAA issuer domain")
+			}
+		}
+	}
+	for _, param := range strings.Split(params, ";") {
+		param = strings.TrimSpace(param)
+		if param == "" {
+			continue
+		}
+		key, paramValue, ok := strings.Cut(param, "=")
+		if !ok || key == "" || !isAlphanumeric(key) || strings.ContainsAny(paramValue, " \t") {
+			return errors.New("invalid CAA issuer parameter")
+		}
+	}
+	return nil
+}
+
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func (caa CAA) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.CAA{
+		Hdr:   header,
+		Flag:  caa.Flag,
+		Tag:   caa.Tag,
+		Value: caa.Value,
+	}
+}
+
+func (caa CAA) ValueType() uint16 {
+	return dns.TypeCAA
+}
+
+func (caa CAA) EncodeValue() string {
+	return fmt.Sprintf("%d\t%s\t%s", caa.Flag, caa.Tag, caa.Value)
+}
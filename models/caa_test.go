@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCAA_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json  string
+		valid bool
+	}{
+		{`{"flag":0,"tag":"issue","value":"letsencrypt.org"}`, true},
+		{`{"flag":0,"tag":"ISSUE","value":"letsencrypt.org"}`, true},
+		{`{"flag":128,"tag":"issuewild","value":";"}`, true},
+		{`{"flag":0,"tag":"issue","value":""}`, true},
+		{`{"flag":0,"tag":"issue","value":"ca.example.net; account=230123; validationmethods=dns-01"}`, true},
+		{`{"flag":0,"tag":"iodef","value":"mailto:security@example.com"}`, true},
+		{`{"flag":0,"tag":"iodef","value":"https://iodef.example.com/"}`, true},
+		{`{"flag":0,"tag":"issuemail","value":"authority.example"}`, true},
+		{`{"flag":0,"tag":"issuevmc","value":"authority.example"}`, true},
+		{`{"flag":0,"tag":"contactemail","value":"domain@example.com"}`, true},
+		{`{"flag":0,"tag":"contactphone","value":"+1 (555) 123-4567"}`, true},
+		{`{"flag":128,"tag":"tbs1","value":"any value"}`, true},
+		{`{"flag":1,"tag":"issue","value":"letsencrypt.org"}`, false},
+		{`{"flag":0,"tag":"","value":"letsencrypt.org"}`, false},
+		{`{"flag":0,"tag":"bad-tag","value":"letsencrypt.org"}`, false},
+		{`{"flag":0,"tag":"unknownpropertyx","value":"letsencrypt.org"}`, false},
+		{`{"flag":0,"tag":"contactemail","value":"domain@example.com\n"}`, false},
+		{`{"flag":0,"tag":"issue","value":"letsencrypt.org."}`, false},
+		{`{"flag":0,"tag":"issue","value":"letsencrypt.org; account"}`, false},
+		{`{"flag":0,"tag":"issue","value":"lets encrypt"}`, false},
+		{`{"flag":0,"tag":"issue","value":"letsencrypt.org\t"}`, false},
+		{`{"flag":0,"tag":"iodef","value":"ftp://iodef.example.com/"}`, false},
+	}
+	for _, i := range tests {
+		var caa CAA
+		err := json.Unmarshal([]byte(i.json), &caa)
+		if i.valid {
+			assert.NoError(t, err, i.json)
+		} else {
+			assert.Error(t, err, i.json)
+		}
+	}
+}
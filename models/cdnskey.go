@@ -0,0 +1,38 @@
+package models
+
+import (
+	"fmt"
+	"github.com/miekg/dns"
+)
+
+type CDNSKEY struct {
+	Flags     uint16 `json:"flags"`
+	Protocol  uint8  `json:"protocol"`
+	Algorithm uint8  `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+}
+
+// Validate always succeeds as CDNSKEY records are generated by the server
+func (cdnskey CDNSKEY) Validate() error {
+	return nil
+}
+
+func (cdnskey CDNSKEY) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.CDNSKEY{
+		DNSKEY: dns.DNSKEY{
+			Hdr:       header,
+			Flags:     cdnskey.Flags,
+			Protocol:  cdnskey.Protocol,
+			Algorithm: cdnskey.Algorithm,
+			PublicKey: cdnskey.PublicKey,
+		},
+	}
+}
+
+func (cdnskey CDNSKEY) ValueType() uint16 {
+	return dns.TypeCDNSKEY
+}
+
+func (cdnskey CDNSKEY) EncodeValue() string {
+	return fmt.Sprintf("%d\t%d\t%d\t%s", cdnskey.Flags, cdnskey.Protocol, cdnskey.Algorithm, cdnskey.PublicKey)
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"fmt"
+	"github.com/miekg/dns"
+)
+
+type CDS struct {
+	KeyTag     uint16 `json:"key_tag"`
+	Algorithm  uint8  `json:"algorithm"`
+	DigestType uint8  `json:"digest_type"`
+	Digest     string `json:"digest"`
+}
+
+// Validate always succeeds as CDS records are generated by the server
+func (cds CDS) Validate() error {
+	return nil
+}
+
+func (cds CDS) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.CDS{
+		DS: dns.DS{
+			Hdr:        header,
+			KeyTag:     cds.KeyTag,
+			Algorithm:  cds.Algorithm,
+			DigestType: cds.DigestType,
+			Digest:     cds.Digest,
+		},
+	}
+}
+
+func (cds CDS) ValueType() uint16 {
+	return dns.TypeCDS
+}
+
+func (cds CDS) EncodeValue() string {
+	return fmt.Sprintf("%d\t%d\t%d\t%s", cds.KeyTag, cds.Algorithm, cds.DigestType, cds.Digest)
+}
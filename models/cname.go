@@ -22,13 +22,20 @@ func (cname *CNAME) UnmarshalJSON(bytes []byte) error {
 	if err != nil {
 		return err
 	}
-	if _, ok := dns.IsDomainName(cname.Target); !ok {
-		return errors.New("invalid MX value")
+	if err := cname.Validate(); err != nil {
+		return err
 	}
 	cname.Target = dns.Fqdn(cname.Target)
 	return nil
 }
 
+func (cname CNAME) Validate() error {
+	if _, ok := dns.IsDomainName(cname.Target); !ok {
+		return errors.New("invalid CNAME value")
+	}
+	return nil
+}
+
 func (cname CNAME) ValueRR(header dns.RR_Header) dns.RR {
 	return &dns.CNAME{
 		Hdr:    header,
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/miekg/dns"
+)
+
+var _ json.Marshaler = (*DNAME)(nil)
+var _ json.Unmarshaler = (*DNAME)(nil)
+
+// DNAME redirects every name below the owner name to the same name below the
+// target, the resolver synthesises CNAME records for these names
+type DNAME struct {
+	Target string
+}
+
+func (dname DNAME) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dns.Fqdn(dname.Target))
+}
+
+func (dname *DNAME) UnmarshalJSON(bytes []byte) error {
+	err := json.Unmarshal(bytes, &dname.Target)
+	if err != nil {
+		return err
+	}
+	if err := dname.Validate(); err != nil {
+		return err
+	}
+	dname.Target = dns.Fqdn(dname.Target)
+	return nil
+}
+
+func (dname DNAME) Validate() error {
+	if _, ok := dns.IsDomainName(dname.Target); !ok {
+		return errors.New("invalid DNAME value")
+	}
+	return nil
+}
+
+func (dname DNAME) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.DNAME{
+		Hdr:    header,
+		Target: dname.Target,
+	}
+}
+
+func (dname DNAME) ValueType() uint16 {
+	return dns.TypeDNAME
+}
+
+func (dname DNAME) EncodeValue() string {
+	return dname.Target
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"fmt"
+	"github.com/miekg/dns"
+)
+
+type DNSKEY struct {
+	Flags     uint16 `json:"flags"`
+	Protocol  uint8  `json:"protocol"`
+	Algorithm uint8  `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+}
+
+// Validate always succeeds as DNSKEY records are generated by the server
+func (dnskey DNSKEY) Validate() error {
+	return nil
+}
+
+func (dnskey DNSKEY) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.DNSKEY{
+		Hdr:       header,
+		Flags:     dnskey.Flags,
+		Protocol:  dnskey.Protocol,
+		Algorithm: dnskey.Algorithm,
+		PublicKey: dnskey.PublicKey,
+	}
+}
+
+func (dnskey DNSKEY) ValueType() uint16 {
+	return dns.TypeDNSKEY
+}
+
+func (dnskey DNSKEY) EncodeValue() string {
+	return fmt.Sprintf("%d\t%d\t%d\t%s", dnskey.Flags, dnskey.Protocol, dnskey.Algorithm, dnskey.PublicKey)
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+var _ json.Unmarshaler = (*DS)(nil)
+
+type DS struct {
+	KeyTag     uint16 `json:"key_tag"`
+	Algorithm  uint8  `json:"algorithm"`
+	DigestType uint8  `json:"digest_type"`
+	Digest     string `json:"digest"`
+}
+
+func (ds *DS) UnmarshalJSON(bytes []byte) error {
+	type inner DS
+	var a inner
+	err := json.Unmarshal(bytes, &a)
+	if err != nil {
+		return err
+	}
+	*ds = DS(a)
+	ds.Digest = strings.ToLower(ds.Digest)
+	return ds.Validate()
+}
+
+func (ds DS) Validate() error {
+	if _, ok := dns.AlgorithmToString[ds.Algorithm]; !ok {
+		return errors.New("invalid DS algorithm")
+	}
+
+	// SHA-1, SHA-256 and SHA-384
+	var length int
+	switch ds.DigestType {
+	case dns.SHA1:
+		length = 40
+	case dns.SHA256:
+		length = 64
+	case dns.SHA384:
+		length = 96
+	default:
+		return errors.New("invalid DS digest type")
+	}
+	if !validHex(ds.Digest, length) {
+		return errors.New("invalid DS digest")
+	}
+	return nil
+}
+
+func (ds DS) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.DS{
+		Hdr:        header,
+		KeyTag:     ds.KeyTag,
+		Algorithm:  ds.Algorithm,
+		DigestType: ds.DigestType,
+		Digest:     ds.Digest,
+	}
+}
+
+func (ds DS) ValueType() uint16 {
+	return dns.TypeDS
+}
+
+func (ds DS) EncodeValue() string {
+	return fmt.Sprintf("%d\t%d\t%d\t%s", ds.KeyTag, ds.Algorithm, ds.DigestType, ds.Digest)
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"strconv"
+	"strings"
+)
+
+var _ json.Marshaler = (*Generic)(nil)
+var _ json.Unmarshaler = (*Generic)(nil)
+
+// Generic holds the opaque RDATA of a record type without a model, the value
+// uses the RFC 3597 `\# <length> <hex>` representation
+type Generic struct {
+	Type uint16
+	Data []byte
+}
+
+// AllowsGeneric reports whether records of the type can be stored using the
+// RFC 3597 representation, meta types and the types generated by the server
+// are not allowed
+func AllowsGeneric(t uint16) bool {
+	switch t {
+	case dns.TypeNone, dns.TypeOPT, dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3,
+		dns.TypeNSEC3PARAM, dns.TypeDNSKEY, dns.TypeCDS, dns.TypeCDNSKEY, TypeALIAS:
+		return false
+	}
+	// RFC 6895 reserves 128-255 for meta types and QTYPEs
+	return t < 128 || t > 255
+}
+
+// ParseGeneric parses the RFC 3597 representation of the RDATA
+func ParseGeneric(t uint16, s string) (*Generic, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 || fields[0] != `\#` {
+		return nil, errors.New("invalid RFC 3597 value")
+	}
+	length, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return nil, errors.New("invalid RFC 3597 length")
+	}
+	data, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil {
+		return nil, errors.New("invalid RFC 3597 data")
+	}
+	if len(data) != int(length) {
+		return nil, errors.New("RFC 3597 length does not match data")
+	}
+	return &Generic{Type: t, Data: data}, nil
+}
+
+func (generic Generic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(generic.EncodeValue())
+}
+
+// UnmarshalJSON decodes the RFC 3597 representation, the Type field must be
+// set before decoding
+func (generic *Generic) UnmarshalJSON(bytes []byte) error {
+	var s string
+	err := json.Unmarshal(bytes, &s)
+	if err != nil {
+		return err
+	}
+	a, err := ParseGeneric(generic.Type, s)
+	if err != nil {
+		return err
+	}
+	*generic = *a
+	return nil
+}
+
+func (generic Generic) Validate() error {
+	if !AllowsGeneric(generic.Type) {
+		return errors.New("type can't use the RFC 3597 representation")
+	}
+	return nil
+}
+
+func (generic Generic) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.RFC3597{
+		Hdr:   header,
+		Rdata: hex.EncodeToString(generic.Data),
+	}
+}
+
+func (generic Generic) ValueType() uint16 {
+	return generic.Type
+}
+
+func (generic Generic) EncodeValue() string {
+	if len(generic.Data) == 0 {
+		return `\# 0`
+	}
+	return fmt.Sprintf(`\# %d %s`, len(generic.Data), hex.EncodeToString(generic.Data))
+}
+
+// TypeToString returns the name of the type, types without a name use the
+// RFC 3597 TYPE<n> representation
+func TypeToString(t uint16) string {
+	if s, ok := dns.TypeToString[t]; ok {
+		return s
+	}
+	return "TYPE" + strconv.FormatUint(uint64(t), 10)
+}
+
+// StringToType returns the type for the name, this accepts the RFC 3597
+// TYPE<n> representation
+func StringToType(s string) uint16 {
+	if t, ok := dns.StringToType[s]; ok {
+		return t
+	}
+	if n, ok := strings.CutPrefix(s, "TYPE"); ok {
+		t, err := strconv.ParseUint(n, 10, 16)
+		if err == nil {
+			return uint16(t)
+		}
+	}
+	return dns.TypeNone
+}
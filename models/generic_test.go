@@ -0,0 +1,31 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseGeneric(t *testing.T) {
+	generic, err := ParseGeneric(65000, `\# 4 0A00 0001`)
+	assert.NoError(t, err)
+	assert.Equal(t, &Generic{Type: 65000, Data: []byte{10, 0, 0, 1}}, generic)
+	assert.Equal(t, `\# 4 0a000001`, generic.EncodeValue())
+
+	generic, err = ParseGeneric(65000, `\# 0`)
+	assert.NoError(t, err)
+	assert.Equal(t, `\# 0`, generic.EncodeValue())
+
+	for _, i := range []string{"", `\#`, `# 1 00`, `\# 2 00`, `\# 1 0g`, `\# x 00`} {
+		_, err = ParseGeneric(65000, i)
+		assert.Error(t, err, i)
+	}
+}
+
+func TestStringToType(t *testing.T) {
+	assert.Equal(t, "TYPE65000", TypeToString(65000))
+	assert.Equal(t, "HINFO", TypeToString(13))
+	assert.Equal(t, uint16(65000), StringToType("TYPE65000"))
+	assert.Equal(t, uint16(13), StringToType("HINFO"))
+	assert.Equal(t, uint16(13), StringToType("TYPE13"))
+	assert.Equal(t, uint16(0), StringToType("TYPEx"))
+}
@@ -22,10 +22,17 @@ func (mx *MX) UnmarshalJSON(bytes []byte) error {
 		return err
 	}
 	*mx = MX(a)
+	if err := mx.Validate(); err != nil {
+		return err
+	}
+	mx.Mx = dns.Fqdn(mx.Mx)
+	return nil
+}
+
+func (mx MX) Validate() error {
 	if _, ok := dns.IsDomainName(mx.Mx); !ok {
 		return errors.New("invalid MX value")
 	}
-	mx.Mx = dns.Fqdn(mx.Mx)
 	return nil
 }
 
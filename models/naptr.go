@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+var _ json.Unmarshaler = (*NAPTR)(nil)
+
+type NAPTR struct {
+	Order       uint16 `json:"order"`
+	Preference  uint16 `json:"preference"`
+	Flags       string `json:"flags"`
+	Service     string `json:"service"`
+	Regexp      string `json:"regexp"`
+	Replacement string `json:"replacement"`
+}
+
+func (naptr *NAPTR) UnmarshalJSON(bytes []byte) error {
+	type inner NAPTR
+	var a inner
+	err := json.Unmarshal(bytes, &a)
+	if err != nil {
+		return err
+	}
+	*naptr = NAPTR(a)
+	if naptr.Replacement == "" {
+		naptr.Replacement = "."
+	}
+	naptr.Replacement = dns.Fqdn(naptr.Replacement)
+	return naptr.Validate()
+}
+
+func (naptr NAPTR) Validate() error {
+	if !isAlphanumeric(naptr.Flags) {
+		return errors.New("invalid NAPTR flags")
+	}
+	if hasControlChars(naptr.Service) || hasControlChars(naptr.Regexp) {
+		return errors.New("invalid NAPTR value")
+	}
+	if _, ok := dns.IsDomainName(naptr.Replacement); !ok {
+		return errors.New("invalid NAPTR replacement")
+	}
+
+	// RFC 3403 only allows one of the regexp and replacement fields
+	if naptr.Regexp != "" && naptr.Replacement != "." {
+		return errors.New("NAPTR regexp and replacement are mutually exclusive")
+	}
+	return nil
+}
+
+func (naptr NAPTR) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.NAPTR{
+		Hdr:         header,
+		Order:       naptr.Order,
+		Preference:  naptr.Preference,
+		Flags:       naptr.Flags,
+		Service:     naptr.Service,
+		Regexp:      naptr.Regexp,
+		Replacement: naptr.Replacement,
+	}
+}
+
+func (naptr NAPTR) ValueType() uint16 {
+	return dns.TypeNAPTR
+}
+
+func (naptr NAPTR) EncodeValue() string {
+	return fmt.Sprintf("%d\t%d\t%s\t%s\t%s\t%s", naptr.Order, naptr.Preference, naptr.Flags, naptr.Service, naptr.Regexp, naptr.Replacement)
+}
+
+// hasControlChars returns true if the string contains control characters which
+// can't be stored in the tab separated record value
+func hasControlChars(s string) bool {
+	return strings.ContainsFunc(s, func(r rune) bool { return r < 0x20 || r == 0x7f })
+}
@@ -22,13 +22,20 @@ func (ns *NS) UnmarshalJSON(bytes []byte) error {
 	if err != nil {
 		return err
 	}
-	if _, ok := dns.IsDomainName(ns.Ns); !ok {
-		return errors.New("invalid MX value")
+	if err := ns.Validate(); err != nil {
+		return err
 	}
 	ns.Ns = dns.Fqdn(ns.Ns)
 	return nil
 }
 
+func (ns NS) Validate() error {
+	if _, ok := dns.IsDomainName(ns.Ns); !ok {
+		return errors.New("invalid NS value")
+	}
+	return nil
+}
+
 func (ns NS) ValueRR(header dns.RR_Header) dns.RR {
 	return &dns.NS{
 		Hdr: header,
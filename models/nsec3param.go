@@ -0,0 +1,41 @@
+package models
+
+import (
+	"fmt"
+	"github.com/miekg/dns"
+)
+
+type NSEC3PARAM struct {
+	Hash       uint8  `json:"hash"`
+	Flags      uint8  `json:"flags"`
+	Iterations uint16 `json:"iterations"`
+	Salt       string `json:"salt"`
+}
+
+// Validate always succeeds as NSEC3PARAM records are generated by the server
+func (param NSEC3PARAM) Validate() error {
+	return nil
+}
+
+func (param NSEC3PARAM) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.NSEC3PARAM{
+		Hdr:        header,
+		Hash:       param.Hash,
+		Flags:      param.Flags,
+		Iterations: param.Iterations,
+		SaltLength: uint8(len(param.Salt) / 2),
+		Salt:       param.Salt,
+	}
+}
+
+func (param NSEC3PARAM) ValueType() uint16 {
+	return dns.TypeNSEC3PARAM
+}
+
+func (param NSEC3PARAM) EncodeValue() string {
+	salt := param.Salt
+	if salt == "" {
+		salt = "-"
+	}
+	return fmt.Sprintf("%d\t%d\t%d\t%s", param.Hash, param.Flags, param.Iterations, salt)
+}
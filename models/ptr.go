@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/miekg/dns"
+)
+
+var _ json.Marshaler = (*PTR)(nil)
+var _ json.Unmarshaler = (*PTR)(nil)
+
+type PTR struct {
+	Ptr string
+}
+
+func (ptr PTR) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dns.Fqdn(ptr.Ptr))
+}
+
+func (ptr *PTR) UnmarshalJSON(bytes []byte) error {
+	err := json.Unmarshal(bytes, &ptr.Ptr)
+	if err != nil {
+		return err
+	}
+	if err := ptr.Validate(); err != nil {
+		return err
+	}
+	ptr.Ptr = dns.Fqdn(ptr.Ptr)
+	return nil
+}
+
+func (ptr PTR) Validate() error {
+	if _, ok := dns.IsDomainName(ptr.Ptr); !ok {
+		return errors.New("invalid PTR value")
+	}
+	return nil
+}
+
+func (ptr PTR) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.PTR{
+		Hdr: header,
+		Ptr: ptr.Ptr,
+	}
+}
+
+func (ptr PTR) ValueType() uint16 {
+	return dns.TypePTR
+}
+
+func (ptr PTR) EncodeValue() string {
+	return ptr.Ptr
+}
@@ -8,6 +8,10 @@ import (
 const StaticSoaRecord = -1
 const StaticNsRecord = -2
 const DynamicRecords = -3
+const StaticDnssecRecord = -4
+
+// DefaultTtl is used for records without a TTL in zones without a default TTL
+const DefaultTtl = 300
 
 type Record struct {
 	Id    int64        `json:"id"`
@@ -26,8 +30,20 @@ func (r Record) RR(ttl uint32) dns.RR {
 	})
 }
 
+// TtlOr returns the record TTL or the default TTL if the record TTL is not set
+func (r Record) TtlOr(defaultTtl uint32) uint32 {
+	if r.Ttl.Valid {
+		return r.Ttl.UInt32
+	}
+	return defaultTtl
+}
+
 type RecordValue interface {
 	ValueRR(header dns.RR_Header) dns.RR
 	ValueType() uint16
 	EncodeValue() string
+
+	// Validate checks the value can be stored, this applies the same rules as
+	// decoding the value from the API
+	Validate() error
 }
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestRecordValue_UnmarshalJSON(t *testing.T) {
+	sha256 := strings.Repeat("ab", 32)
+	tests := []struct {
+		value RecordValue
+		json  string
+		valid bool
+	}{
+		{new(PTR), `"host.example.com"`, true},
+		{new(PTR), `"host..example.com"`, false},
+		{new(DNAME), `"example.net."`, true},
+		{new(NAPTR), `{"order":100,"preference":10,"flags":"S","service":"SIP+D2U","regexp":"","replacement":"_sip._udp.example.com."}`, true},
+		{new(NAPTR), `{"order":100,"preference":10,"flags":"U","service":"E2U+sip","regexp":"!^.*$!sip:info@example.com!","replacement":""}`, true},
+		{new(NAPTR), `{"order":100,"preference":10,"flags":"U","service":"E2U+sip","regexp":"!^.*$!sip:info@example.com!","replacement":"example.com."}`, false},
+		{new(NAPTR), `{"order":100,"preference":10,"flags":"S!","service":"SIP+D2U","regexp":"","replacement":"_sip._udp.example.com."}`, false},
+		{new(SSHFP), `{"algorithm":4,"type":2,"fingerprint":"` + sha256 + `"}`, true},
+		{new(SSHFP), `{"algorithm":4,"type":1,"fingerprint":"` + sha256 + `"}`, false},
+		{new(SSHFP), `{"algorithm":5,"type":2,"fingerprint":"` + sha256 + `"}`, false},
+		{new(TLSA), `{"usage":3,"selector":1,"matching_type":1,"certificate":"` + sha256 + `"}`, true},
+		{new(TLSA), `{"usage":3,"selector":1,"matching_type":0,"certificate":"3082"}`, true},
+		{new(TLSA), `{"usage":4,"selector":1,"matching_type":1,"certificate":"` + sha256 + `"}`, false},
+		{new(TLSA), `{"usage":3,"selector":1,"matching_type":2,"certificate":"` + sha256 + `"}`, false},
+		{new(DS), `{"key_tag":12345,"algorithm":13,"digest_type":2,"digest":"` + sha256 + `"}`, true},
+		{new(DS), `{"key_tag":12345,"algorithm":13,"digest_type":2,"digest":"xyz"}`, false},
+		{new(DS), `{"key_tag":12345,"algorithm":13,"digest_type":3,"digest":"` + sha256 + `"}`, false},
+		{new(URI), `{"priority":10,"weight":1,"target":"sip:info@example.com"}`, true},
+		{new(URI), `{"priority":10,"weight":1,"target":"example.com"}`, false},
+		{new(HTTPS), `{"priority":0,"target":"cdn.example.net"}`, true},
+		{new(HTTPS), `{"priority":0,"target":"cdn.example.net","params":{"alpn":["h2"]}}`, false},
+		{new(HTTPS), `{"priority":1,"target":".","params":{"mandatory":["alpn"],"alpn":["h2","h3"],"port":443,"ipv4hint":["10.0.0.1"],"ipv6hint":["fd00::1"],"ech":"AEX+DQBB"}}`, true},
+		{new(HTTPS), `{"priority":1,"target":".","params":{"mandatory":["port"],"alpn":["h2"]}}`, false},
+		{new(HTTPS), `{"priority":1,"target":".","params":{"mandatory":["mandatory"],"alpn":["h2"]}}`, false},
+		{new(HTTPS), `{"priority":1,"target":".","params":{"alpn":["h2,h3"]}}`, false},
+		{new(HTTPS), `{"priority":1,"target":".","params":{"alpn":[""]}}`, false},
+		{new(SVCB), `{"priority":1,"target":"svc.example.com","params":{"ipv4hint":["fd00::1"]}}`, false},
+		{new(SVCB), `{"priority":1,"target":"svc.example.com","params":{"ipv6hint":["10.0.0.1"]}}`, false},
+		{new(SVCB), `{"priority":1,"target":"svc.example.com","params":{"ech":"not base64!"}}`, false},
+		{new(SVCB), `{"priority":1,"target":"svc..example.com"}`, false},
+	}
+	for _, i := range tests {
+		err := json.Unmarshal([]byte(i.json), i.value)
+		if i.valid {
+			assert.NoError(t, err, i.json)
+		} else {
+			assert.Error(t, err, i.json)
+		}
+	}
+}
+
+func TestRecordValue_Validate(t *testing.T) {
+	tests := []struct {
+		value RecordValue
+		valid bool
+	}{
+		{A{IP: net.IPv4(10, 0, 0, 1)}, true},
+		{A{IP: net.ParseIP("fd00::1")}, false},
+		{AAAA{IP: net.ParseIP("fd00::1")}, true},
+		{AAAA{IP: net.IP{10, 0, 0, 1}}, false},
+		{CNAME{Target: "host..example.com."}, false},
+		{MX{Preference: 10, Mx: "mail.example.com."}, true},
+		{CAA{Flag: 0, Tag: "issue", Value: "letsencrypt.org"}, true},
+		{CAA{Flag: 0, Tag: "issue", Value: "letsencrypt.org\t"}, false},
+		{CAA{Flag: 0, Tag: "issuemail", Value: "authority.example"}, true},
+		{CAA{Flag: 0, Tag: "Issue", Value: "letsencrypt.org"}, false},
+		{NAPTR{Flags: "U", Service: "E2U+sip\t", Replacement: "."}, false},
+		{URI{Priority: 10, Weight: 1, Target: "sip:info@example.com\n"}, false},
+		{Generic{Type: 65280, Data: []byte{1}}, true},
+		{Generic{Type: 46, Data: []byte{1}}, false},
+	}
+	for _, i := range tests {
+		err := i.value.Validate()
+		if i.valid {
+			assert.NoError(t, err, i.value.EncodeValue())
+		} else {
+			assert.Error(t, err, i.value.EncodeValue())
+		}
+	}
+}
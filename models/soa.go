@@ -15,6 +15,11 @@ type SOA struct {
 	Minttl  uint32 `json:"minttl"`
 }
 
+// Validate always succeeds as SOA records are generated by the server
+func (soa SOA) Validate() error {
+	return nil
+}
+
 func (soa SOA) ValueRR(header dns.RR_Header) dns.RR {
 	return &dns.SOA{
 		Hdr:     header,
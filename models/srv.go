@@ -24,13 +24,20 @@ func (srv *SRV) UnmarshalJSON(bytes []byte) error {
 		return err
 	}
 	*srv = SRV(a)
-	if _, ok := dns.IsDomainName(srv.Target); !ok {
-		return errors.New("invalid MX value")
+	if err := srv.Validate(); err != nil {
+		return err
 	}
 	srv.Target = dns.Fqdn(srv.Target)
 	return nil
 }
 
+func (srv SRV) Validate() error {
+	if _, ok := dns.IsDomainName(srv.Target); !ok {
+		return errors.New("invalid SRV value")
+	}
+	return nil
+}
+
 func (srv SRV) ValueRR(header dns.RR_Header) dns.RR {
 	return &dns.SRV{
 		Hdr:      header,
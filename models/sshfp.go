@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+var _ json.Unmarshaler = (*SSHFP)(nil)
+
+type SSHFP struct {
+	Algorithm   uint8  `json:"algorithm"`
+	Type        uint8  `json:"type"`
+	FingerPrint string `json:"fingerprint"`
+}
+
+func (sshfp *SSHFP) UnmarshalJSON(bytes []byte) error {
+	type inner SSHFP
+	var a inner
+	err := json.Unmarshal(bytes, &a)
+	if err != nil {
+		return err
+	}
+	*sshfp = SSHFP(a)
+	sshfp.FingerPrint = strings.ToLower(sshfp.FingerPrint)
+	return sshfp.Validate()
+}
+
+func (sshfp SSHFP) Validate() error {
+	// RSA, DSA, ECDSA, Ed25519 and Ed448
+	switch sshfp.Algorithm {
+	case 1, 2, 3, 4, 6:
+	default:
+		return errors.New("invalid SSHFP algorithm")
+	}
+
+	// SHA-1 and SHA-256
+	switch sshfp.Type {
+	case 1:
+		if !validHex(sshfp.FingerPrint, 40) {
+			return errors.New("invalid SSHFP fingerprint")
+		}
+	case 2:
+		if !validHex(sshfp.FingerPrint, 64) {
+			return errors.New("invalid SSHFP fingerprint")
+		}
+	default:
+		return errors.New("invalid SSHFP type")
+	}
+	return nil
+}
+
+func (sshfp SSHFP) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.SSHFP{
+		Hdr:         header,
+		Algorithm:   sshfp.Algorithm,
+		Type:        sshfp.Type,
+		FingerPrint: sshfp.FingerPrint,
+	}
+}
+
+func (sshfp SSHFP) ValueType() uint16 {
+	return dns.TypeSSHFP
+}
+
+func (sshfp SSHFP) EncodeValue() string {
+	return fmt.Sprintf("%d\t%d\t%s", sshfp.Algorithm, sshfp.Type, sshfp.FingerPrint)
+}
+
+// validHex returns true if the string is hexadecimal with the length, a zero
+// length allows any non-empty string with an even length
+func validHex(s string, length int) bool {
+	if length == 0 && (s == "" || len(s)%2 != 0) {
+		return false
+	}
+	if length != 0 && len(s) != length {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') && (r < 'A' || r > 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,333 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var _ json.Unmarshaler = (*SVCB)(nil)
+var _ json.Unmarshaler = (*HTTPS)(nil)
+
+// SvcParams contains the supported SvcParams from RFC 9460, ECH is the base64
+// encoded ECHConfigList
+type SvcParams struct {
+	Mandatory []string     `json:"mandatory,omitempty"`
+	Alpn      []string     `json:"alpn,omitempty"`
+	Port      *uint16      `json:"port,omitempty"`
+	Ipv4Hint  []netip.Addr `json:"ipv4hint,omitempty"`
+	Ech       string       `json:"ech,omitempty"`
+	Ipv6Hint  []netip.Addr `json:"ipv6hint,omitempty"`
+}
+
+// svcParamKeys contains the supported keys in the order of their key numbers
+var svcParamKeys = []string{"mandatory", "alpn", "port", "ipv4hint", "ech", "ipv6hint"}
+
+// keys returns the keys of the SvcParams which are set
+func (p SvcParams) keys() []string {
+	var keys []string
+	if len(p.Mandatory) > 0 {
+		keys = append(keys, "mandatory")
+	}
+	if len(p.Alpn) > 0 {
+		keys = append(keys, "alpn")
+	}
+	if p.Port != nil {
+		keys = append(keys, "port")
+	}
+	if len(p.Ipv4Hint) > 0 {
+		keys = append(keys, "ipv4hint")
+	}
+	if p.Ech != "" {
+		keys = append(keys, "ech")
+	}
+	if len(p.Ipv6Hint) > 0 {
+		keys = append(keys, "ipv6hint")
+	}
+	return keys
+}
+
+func (p SvcParams) validate() error {
+	for _, i := range p.Alpn {
+		if i == "" || len(i) > 255 || strings.Contains(i, ",") || hasControlChars(i) || strings.Contains(i, " ") {
+			return errors.New("invalid SVCB alpn")
+		}
+	}
+	for _, i := range p.Ipv4Hint {
+		if !i.Is4() {
+			return errors.New("invalid SVCB ipv4hint")
+		}
+	}
+	for _, i := range p.Ipv6Hint {
+		if !i.Is6() || i.Is4In6() || i.Zone() != "" {
+			return errors.New("invalid SVCB ipv6hint")
+		}
+	}
+	if p.Ech != "" {
+		if _, err := base64.StdEncoding.DecodeString(p.Ech); err != nil {
+			return errors.New("invalid SVCB ech")
+		}
+	}
+
+	// mandatory keys must be present and can't include mandatory itself
+	keys := p.keys()
+	for n, i := range p.Mandatory {
+		if i == "mandatory" || !slices.Contains(keys, i) || slices.Contains(p.Mandatory[:n], i) {
+			return errors.New("invalid SVCB mandatory")
+		}
+	}
+	return nil
+}
+
+// String returns the SvcParams in presentation format, this is used for the
+// storage encoding
+func (p SvcParams) String() string {
+	parts := make([]string, 0, len(svcParamKeys))
+	for _, key := range p.keys() {
+		var value string
+		switch key {
+		case "mandatory":
+			mandatory := slices.Clone(p.Mandatory)
+			slices.SortFunc(mandatory, func(a, b string) int {
+				return slices.Index(svcParamKeys, a) - slices.Index(svcParamKeys, b)
+			})
+			value = strings.Join(mandatory, ",")
+		case "alpn":
+			value = strings.Join(p.Alpn, ",")
+		case "port":
+			value = strconv.FormatUint(uint64(*p.Port), 10)
+		case "ipv4hint":
+			value = joinAddrs(p.Ipv4Hint)
+		case "ech":
+			value = p.Ech
+		case "ipv6hint":
+			value = joinAddrs(p.Ipv6Hint)
+		}
+		parts = append(parts, key+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func joinAddrs(addrs []netip.Addr) string {
+	s := make([]string, 0, len(addrs))
+	for _, i := range addrs {
+		s = append(s, i.String())
+	}
+	return strings.Join(s, ",")
+}
+
+// ParseSvcParams parses SvcParams in the presentation format used for storage
+func ParseSvcParams(s string) (SvcParams, error) {
+	var p SvcParams
+	for _, part := range strings.Fields(s) {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return SvcParams{}, fmt.Errorf("invalid SvcParam %s", part)
+		}
+		values := strings.Split(value, ",")
+		switch key {
+		case "mandatory":
+			p.Mandatory = values
+		case "alpn":
+			p.Alpn = values
+		case "port":
+			port, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				return SvcParams{}, err
+			}
+			p.Port = new(uint16)
+			*p.Port = uint16(port)
+		case "ipv4hint", "ipv6hint":
+			addrs := make([]netip.Addr, 0, len(values))
+			for _, i := range values {
+				addr, err := netip.ParseAddr(i)
+				if err != nil {
+					return SvcParams{}, err
+				}
+				addrs = append(addrs, addr)
+			}
+			if key == "ipv4hint" {
+				p.Ipv4Hint = addrs
+			} else {
+				p.Ipv6Hint = addrs
+			}
+		case "ech":
+			p.Ech = value
+		default:
+			return SvcParams{}, fmt.Errorf("unsupported SvcParam %s", key)
+		}
+	}
+	return p, p.validate()
+}
+
+// svcParamsFromRR converts the SvcParams from a dns.SVCB record
+func svcParamsFromRR(values []dns.SVCBKeyValue) (SvcParams, error) {
+	var p SvcParams
+	for _, kv := range values {
+		switch v := kv.(type) {
+		case *dns.SVCBMandatory:
+			for _, i := range v.Code {
+				p.Mandatory = append(p.Mandatory, i.String())
+			}
+		case *dns.SVCBAlpn:
+			p.Alpn = slices.Clone(v.Alpn)
+		case *dns.SVCBPort:
+			p.Port = new(uint16)
+			*p.Port = v.Port
+		case *dns.SVCBIPv4Hint:
+			for _, i := range v.Hint {
+				addr, ok := netip.AddrFromSlice(i.To4())
+				if !ok {
+					return SvcParams{}, errors.New("invalid SVCB ipv4hint")
+				}
+				p.Ipv4Hint = append(p.Ipv4Hint, addr)
+			}
+		case *dns.SVCBECHConfig:
+			p.Ech = base64.StdEncoding.EncodeToString(v.ECH)
+		case *dns.SVCBIPv6Hint:
+			for _, i := range v.Hint {
+				addr, ok := netip.AddrFromSlice(i.To16())
+				if !ok {
+					return SvcParams{}, errors.New("invalid SVCB ipv6hint")
+				}
+				p.Ipv6Hint = append(p.Ipv6Hint, addr)
+			}
+		default:
+			return SvcParams{}, fmt.Errorf("unsupported SvcParam %s", kv.Key())
+		}
+	}
+	return p, p.validate()
+}
+
+// rrValues converts the SvcParams into the values for a dns.SVCB record
+func (p SvcParams) rrValues() []dns.SVCBKeyValue {
+	var values []dns.SVCBKeyValue
+	if len(p.Mandatory) > 0 {
+		codes := make([]dns.SVCBKey, 0, len(p.Mandatory))
+		for _, i := range p.Mandatory {
+			switch i {
+			case "alpn":
+				codes = append(codes, dns.SVCB_ALPN)
+			case "port":
+				codes = append(codes, dns.SVCB_PORT)
+			case "ipv4hint":
+				codes = append(codes, dns.SVCB_IPV4HINT)
+			case "ech":
+				codes = append(codes, dns.SVCB_ECHCONFIG)
+			case "ipv6hint":
+				codes = append(codes, dns.SVCB_IPV6HINT)
+			}
+		}
+		slices.Sort(codes)
+		values = append(values, &dns.SVCBMandatory{Code: codes})
+	}
+	if len(p.Alpn) > 0 {
+		values = append(values, &dns.SVCBAlpn{Alpn: slices.Clone(p.Alpn)})
+	}
+	if p.Port != nil {
+		values = append(values, &dns.SVCBPort{Port: *p.Port})
+	}
+	if len(p.Ipv4Hint) > 0 {
+		hints := make([]net.IP, 0, len(p.Ipv4Hint))
+		for _, i := range p.Ipv4Hint {
+			hints = append(hints, i.AsSlice())
+		}
+		values = append(values, &dns.SVCBIPv4Hint{Hint: hints})
+	}
+	if p.Ech != "" {
+		ech, _ := base64.StdEncoding.DecodeString(p.Ech)
+		values = append(values, &dns.SVCBECHConfig{ECH: ech})
+	}
+	if len(p.Ipv6Hint) > 0 {
+		hints := make([]net.IP, 0, len(p.Ipv6Hint))
+		for _, i := range p.Ipv6Hint {
+			hints = append(hints, i.AsSlice())
+		}
+		values = append(values, &dns.SVCBIPv6Hint{Hint: hints})
+	}
+	return values
+}
+
+// SVCB is a service binding record, a priority of zero is AliasMode which
+// points the owner name at the target and can't have any SvcParams
+type SVCB struct {
+	Priority uint16    `json:"priority"`
+	Target   string    `json:"target"`
+	Params   SvcParams `json:"params"`
+}
+
+func (svcb *SVCB) UnmarshalJSON(bytes []byte) error {
+	type inner SVCB
+	var a inner
+	err := json.Unmarshal(bytes, &a)
+	if err != nil {
+		return err
+	}
+	*svcb = SVCB(a)
+	if err := svcb.Validate(); err != nil {
+		return err
+	}
+	svcb.Target = dns.Fqdn(svcb.Target)
+	return nil
+}
+
+func (svcb SVCB) Validate() error {
+	if _, ok := dns.IsDomainName(svcb.Target); !ok {
+		return errors.New("invalid SVCB target")
+	}
+	if svcb.Priority == 0 && len(svcb.Params.keys()) > 0 {
+		return errors.New("SVCB AliasMode can't have SvcParams")
+	}
+	return svcb.Params.validate()
+}
+
+// SvcbFromRR converts a dns.SVCB record into the model
+func SvcbFromRR(rr *dns.SVCB) (*SVCB, error) {
+	params, err := svcParamsFromRR(rr.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &SVCB{Priority: rr.Priority, Target: rr.Target, Params: params}, nil
+}
+
+func (svcb SVCB) svcbRR(header dns.RR_Header) dns.SVCB {
+	return dns.SVCB{
+		Hdr:      header,
+		Priority: svcb.Priority,
+		Target:   svcb.Target,
+		Value:    svcb.Params.rrValues(),
+	}
+}
+
+func (svcb SVCB) ValueRR(header dns.RR_Header) dns.RR {
+	rr := svcb.svcbRR(header)
+	return &rr
+}
+
+func (svcb SVCB) ValueType() uint16 {
+	return dns.TypeSVCB
+}
+
+func (svcb SVCB) EncodeValue() string {
+	return fmt.Sprintf("%d\t%s\t%s", svcb.Priority, svcb.Target, svcb.Params)
+}
+
+// HTTPS is the SVCB record for HTTP origins
+type HTTPS struct {
+	SVCB
+}
+
+func (https HTTPS) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.HTTPS{SVCB: https.svcbRR(header)}
+}
+
+func (https HTTPS) ValueType() uint16 {
+	return dns.TypeHTTPS
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+var _ json.Unmarshaler = (*TLSA)(nil)
+
+type TLSA struct {
+	Usage        uint8  `json:"usage"`
+	Selector     uint8  `json:"selector"`
+	MatchingType uint8  `json:"matching_type"`
+	Certificate  string `json:"certificate"`
+}
+
+func (tlsa *TLSA) UnmarshalJSON(bytes []byte) error {
+	type inner TLSA
+	var a inner
+	err := json.Unmarshal(bytes, &a)
+	if err != nil {
+		return err
+	}
+	*tlsa = TLSA(a)
+	tlsa.Certificate = strings.ToLower(tlsa.Certificate)
+	return tlsa.Validate()
+}
+
+func (tlsa TLSA) Validate() error {
+	if tlsa.Usage > 3 {
+		return errors.New("invalid TLSA usage")
+	}
+	if tlsa.Selector > 1 {
+		return errors.New("invalid TLSA selector")
+	}
+
+	// full data, SHA2-256 and SHA2-512
+	var length int
+	switch tlsa.MatchingType {
+	case 0:
+		length = 0
+	case 1:
+		length = 64
+	case 2:
+		length = 128
+	default:
+		return errors.New("invalid TLSA matching type")
+	}
+	if !validHex(tlsa.Certificate, length) {
+		return errors.New("invalid TLSA certificate data")
+	}
+	return nil
+}
+
+func (tlsa TLSA) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.TLSA{
+		Hdr:          header,
+		Usage:        tlsa.Usage,
+		Selector:     tlsa.Selector,
+		MatchingType: tlsa.MatchingType,
+		Certificate:  tlsa.Certificate,
+	}
+}
+
+func (tlsa TLSA) ValueType() uint16 {
+	return dns.TypeTLSA
+}
+
+func (tlsa TLSA) EncodeValue() string {
+	return fmt.Sprintf("%d\t%d\t%d\t%s", tlsa.Usage, tlsa.Selector, tlsa.MatchingType, tlsa.Certificate)
+}
@@ -20,15 +20,21 @@ func (txt *TXT) UnmarshalJSON(bytes []byte) error {
 	return json.Unmarshal(bytes, &txt.Value)
 }
 
+func (txt TXT) Validate() error {
+	return nil
+}
+
+// ValueRR splits the value into character-strings of up to 255 bytes, longer
+// values such as DKIM keys cannot be sent as a single character-string
 func (txt TXT) ValueRR(header dns.RR_Header) dns.RR {
 	return &dns.TXT{
 		Hdr: header,
-		Txt: []string{txt.Value},
+		Txt: splitTxtValue(txt.Value),
 	}
 }
 
 func (txt TXT) ValueType() uint16 {
-	return dns.TypeAAAA
+	return dns.TypeTXT
 }
 
 func (txt TXT) EncodeValue() string {
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"github.com/miekg/dns"
 	"strings"
 	"testing"
 )
@@ -37,3 +38,15 @@ func TestSplitTxtValue(t *testing.T) {
 		}
 	}
 }
+
+func TestTXT_ValueRR(t *testing.T) {
+	rr := TXT{Value: strings.Repeat("A", 300)}.ValueRR(dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET})
+	txt := rr.(*dns.TXT)
+	if len(txt.Txt) != 2 || len(txt.Txt[0]) != 255 || len(txt.Txt[1]) != 45 {
+		t.Fatalf("Invalid TXT character-strings: %d", len(txt.Txt))
+	}
+	buf := make([]byte, dns.Len(rr))
+	if _, err := dns.PackRR(rr, buf, 0, nil, false); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"net/url"
+)
+
+var _ json.Unmarshaler = (*URI)(nil)
+
+type URI struct {
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+	Target   string `json:"target"`
+}
+
+func (uri *URI) UnmarshalJSON(bytes []byte) error {
+	type inner URI
+	var a inner
+	err := json.Unmarshal(bytes, &a)
+	if err != nil {
+		return err
+	}
+	*uri = URI(a)
+	return uri.Validate()
+}
+
+func (uri URI) Validate() error {
+	u, err := url.Parse(uri.Target)
+	if err != nil || u.Scheme == "" || hasControlChars(uri.Target) {
+		return errors.New("invalid URI target")
+	}
+	return nil
+}
+
+func (uri URI) ValueRR(header dns.RR_Header) dns.RR {
+	return &dns.URI{
+		Hdr:      header,
+		Priority: uri.Priority,
+		Weight:   uri.Weight,
+		Target:   uri.Target,
+	}
+}
+
+func (uri URI) ValueType() uint16 {
+	return dns.TypeURI
+}
+
+func (uri URI) EncodeValue() string {
+	return fmt.Sprintf("%d\t%d\t%s", uri.Priority, uri.Weight, uri.Target)
+}
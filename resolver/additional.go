@@ -0,0 +1,79 @@
+package resolver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/1f349/azalea/models"
+	"github.com/miekg/dns"
+	"net"
+	"slices"
+	"strings"
+)
+
+// additionalTargets returns the unique target names of the MX, SRV, NS, SVCB
+// and HTTPS records which should have address records in the additional section
+func additionalTargets(rrs []dns.RR) []string {
+	var targets []string
+	for _, rr := range rrs {
+		var target string
+		switch rr := rr.(type) {
+		case *dns.MX:
+			target = rr.Mx
+		case *dns.SRV:
+			target = rr.Target
+		case *dns.NS:
+			target = rr.Ns
+		case *dns.SVCB:
+			target = svcbTarget(rr)
+		case *dns.HTTPS:
+			target = svcbTarget(&rr.SVCB)
+		default:
+			continue
+		}
+		target = strings.ToLower(dns.Fqdn(target))
+		if target == "." || slices.Contains(targets, target) {
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// svcbTarget returns the target of the SVCB record, in ServiceMode a target of
+// "." means the owner name
+func svcbTarget(rr *dns.SVCB) string {
+	if rr.Target == "." && rr.Priority != 0 {
+		return rr.Hdr.Name
+	}
+	return rr.Target
+}
+
+// additionalRecords returns the A and AAAA records for the MX, SRV, NS, SVCB
+// and HTTPS targets in the answer which are inside a hosted zone, this includes
+// the glue for the zone nameservers
+func (r *Resolver) additionalRecords(ctx context.Context, answer []dns.RR, addr net.Addr) ([]dns.RR, error) {
+	var extra []dns.RR
+	for _, target := range additionalTargets(answer) {
+		_, err := r.zoneForName(ctx, target)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rrType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			records, err := r.LookupAnswersForType(ctx, target, rrType, addr)
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				rr := record.RR(record.TtlOr(models.DefaultTtl))
+				rr.Header().Name = target
+				extra = append(extra, rr)
+			}
+		}
+	}
+	return extra, nil
+}
@@ -0,0 +1,214 @@
+package resolver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/1f349/azalea/converters"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/models"
+	"github.com/gobuffalo/nulls"
+	"github.com/miekg/dns"
+	"github.com/rcrowley/go-metrics"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAliasDepth is the number of ALIAS records followed when resolving the
+// target of an ALIAS record inside the hosted zones
+const maxAliasDepth = 8
+
+type aliasDepthKey struct{}
+
+var errNoAliasUpstream = errors.New("no upstream resolver for ALIAS targets outside the hosted zones")
+
+type aliasKey struct {
+	name   string
+	rrType uint16
+}
+
+type aliasEntry struct {
+	rrs     []dns.RR
+	expires time.Time
+}
+
+// AliasResolver resolves the targets of ALIAS records which are outside the
+// hosted zones using an upstream recursive resolver, the results are cached
+// for the TTL of the target records
+type AliasResolver struct {
+	upstream string
+	client   *dns.Client
+
+	mu    *sync.Mutex
+	cache map[aliasKey]aliasEntry
+}
+
+// NewAliasResolver creates an AliasResolver using the upstream resolver, an
+// empty upstream disables resolving targets outside the hosted zones
+func NewAliasResolver(upstream string) *AliasResolver {
+	if upstream != "" {
+		if _, _, err := net.SplitHostPort(upstream); err != nil {
+			upstream = net.JoinHostPort(upstream, "53")
+		}
+	}
+	return &AliasResolver{
+		upstream: upstream,
+		client:   &dns.Client{Timeout: 5 * time.Second},
+		mu:       new(sync.Mutex),
+		cache:    make(map[aliasKey]aliasEntry),
+	}
+}
+
+// Resolve returns the records of the type for the target, the TTL of each
+// record is the time remaining in the cache
+func (a *AliasResolver) Resolve(ctx context.Context, target string, rrType uint16) ([]dns.RR, error) {
+	if a == nil || a.upstream == "" {
+		return nil, errNoAliasUpstream
+	}
+	key := aliasKey{strings.ToLower(dns.Fqdn(target)), rrType}
+	now := time.Now()
+
+	a.mu.Lock()
+	entry, ok := a.cache[key]
+	if ok && !now.Before(entry.expires) {
+		delete(a.cache, key)
+		ok = false
+	}
+	a.mu.Unlock()
+
+	if ok {
+		metrics.GetOrRegisterCounter("resolver.alias.cache.hit", metrics.DefaultRegistry).Inc(1)
+		return withRemainingTtl(entry.rrs, uint32(entry.expires.Sub(now).Seconds())), nil
+	}
+	metrics.GetOrRegisterCounter("resolver.alias.cache.miss", metrics.DefaultRegistry).Inc(1)
+
+	req := new(dns.Msg)
+	req.SetQuestion(key.name, rrType)
+	resp, _, err := a.client.ExchangeContext(ctx, req, a.upstream)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("upstream resolver returned %s for %s", dns.RcodeToString[resp.Rcode], key.name)
+	}
+
+	// the answer may contain a CNAME chain so only the requested type is kept,
+	// negative answers are cached for the SOA minimum
+	var rrs []dns.RR
+	var ttl uint32
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype != rrType {
+			continue
+		}
+		if len(rrs) == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+		rrs = append(rrs, rr)
+	}
+	if len(rrs) == 0 {
+		for _, rr := range resp.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl = min(soa.Hdr.Ttl, soa.Minttl)
+			}
+		}
+	}
+
+	if ttl > 0 {
+		a.mu.Lock()
+		a.cache[key] = aliasEntry{rrs: rrs, expires: now.Add(time.Duration(ttl) * time.Second)}
+		a.mu.Unlock()
+	}
+	return withRemainingTtl(rrs, ttl), nil
+}
+
+// withRemainingTtl returns copies of the records with the TTL set
+func withRemainingTtl(rrs []dns.RR, ttl uint32) []dns.RR {
+	out := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		rr = dns.Copy(rr)
+		rr.Header().Ttl = ttl
+		out = append(out, rr)
+	}
+	return out
+}
+
+// lookupAlias synthesises the address records for the name from the target of
+// the ALIAS record at the name, targets inside the hosted zones are resolved
+// internally and other targets use the upstream resolver
+func (r *Resolver) lookupAlias(ctx context.Context, name, zone, shortName string, rrType uint16, addr net.Addr) ([]*models.Record, error) {
+	rows, err := r.db.LookupRecordsForType(ctx, database.LookupRecordsForTypeParams{Type: "ALIAS", Name: shortName, Name_2: zone})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.Type != "ALIAS" {
+			continue
+		}
+		record, err := row.ConvertRecord()
+		if err != nil {
+			return nil, err
+		}
+		alias, ok := record.Value.(*models.ALIAS)
+		if !ok {
+			continue
+		}
+		rrs, err := r.resolveAliasTarget(ctx, alias.Target, rrType, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		// the TTL is the lowest of the ALIAS record and the target records
+		aliasTtl := record.TtlOr(row.ZoneDefaultTtl)
+		records := make([]*models.Record, 0, len(rrs))
+		for _, rr := range rrs {
+			value, err := converters.FromRR(rr)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, &models.Record{
+				Id:    record.Id,
+				Name:  name,
+				Type:  rrType,
+				Ttl:   nulls.NewUInt32(min(aliasTtl, rr.Header().Ttl)),
+				Value: value,
+			})
+		}
+		return records, nil
+	}
+	return nil, nil
+}
+
+// resolveAliasTarget returns the records of the type for the ALIAS target
+func (r *Resolver) resolveAliasTarget(ctx context.Context, target string, rrType uint16, addr net.Addr) ([]dns.RR, error) {
+	target = strings.ToLower(dns.Fqdn(target))
+	_, err := r.zoneForName(ctx, target)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r.alias.Resolve(ctx, target, rrType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// ALIAS records pointing at other ALIAS records are followed internally so
+	// the depth is limited to prevent loops
+	depth, _ := ctx.Value(aliasDepthKey{}).(int)
+	if depth >= maxAliasDepth {
+		return nil, fmt.Errorf("ALIAS chain too long at %s", target)
+	}
+	ctx = context.WithValue(ctx, aliasDepthKey{}, depth+1)
+
+	answers, _, _, _, err := r.answerChain(ctx, dns.Question{Name: target, Qtype: rrType, Qclass: dns.ClassINET}, addr)
+	if err != nil {
+		return nil, err
+	}
+	var rrs []dns.RR
+	for _, record := range answers {
+		if record.Type == rrType {
+			rrs = append(rrs, record.RR(record.TtlOr(models.DefaultTtl)))
+		}
+	}
+	return rrs, nil
+}
@@ -0,0 +1,97 @@
+package resolver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/models"
+	"github.com/miekg/dns"
+	"slices"
+	"strings"
+)
+
+// delegatedZone remembers if a zone has any delegations, every record change
+// updates the zone serial so the result is reused until the serial changes
+type delegatedZone struct {
+	id        int32
+	serial    uint32
+	delegated bool
+}
+
+// hasDelegations returns true if the zone has NS records below the apex
+func (r *Resolver) hasDelegations(ctx context.Context, zone database.Zone) (bool, error) {
+	r.cutMu.RLock()
+	cached, ok := r.cutCache[zone.Name]
+	r.cutMu.RUnlock()
+	if ok && cached.id == zone.ID && cached.serial == zone.Serial {
+		return cached.delegated, nil
+	}
+
+	count, err := r.db.CountDelegations(ctx, zone.Name)
+	if err != nil {
+		return false, err
+	}
+	r.cutMu.Lock()
+	r.cutCache[zone.Name] = delegatedZone{id: zone.ID, serial: zone.Serial, delegated: count > 0}
+	r.cutMu.Unlock()
+	return count > 0, nil
+}
+
+// zoneCut returns the NS records of the delegation containing the name, this
+// is the highest name below the zone apex with NS records as everything below
+// it belongs to the child zone
+func (r *Resolver) zoneCut(ctx context.Context, name string) ([]*models.Record, error) {
+	name = strings.ToLower(name)
+	zoneRow, err := r.zoneRowForName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil || name == zoneRow.Name {
+		return nil, err
+	}
+	zone := zoneRow.Name
+
+	// most zones have no delegations so the ancestors don't need checking
+	delegated, err := r.hasDelegations(ctx, zoneRow)
+	if err != nil || !delegated {
+		return nil, err
+	}
+
+	var ancestors []string
+	for n := name; n != zone; _, n, _ = strings.Cut(n, ".") {
+		ancestors = append(ancestors, n)
+	}
+	for _, n := range slices.Backward(ancestors) {
+		records, err := r.LookupAnswersForType(ctx, n, dns.TypeNS, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 {
+			for _, record := range records {
+				record.Name = n
+			}
+			return records, nil
+		}
+	}
+	return nil, nil
+}
+
+// delegation returns the NS records for a referral if the question is at or
+// below a zone cut, DS records are answered by the parent zone so DS questions
+// at the zone cut are not referred
+func (r *Resolver) delegation(ctx context.Context, q dns.Question) ([]*models.Record, error) {
+	records, err := r.zoneCut(ctx, q.Name)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	if q.Qtype == dns.TypeDS && strings.EqualFold(records[0].Name, q.Name) {
+		return nil, nil
+	}
+	return records, nil
+}
+
+// isReferral returns true if the response refers the client to a child zone
+func isReferral(msg *dns.Msg) bool {
+	return !msg.Authoritative && len(msg.Answer) == 0 && len(msg.Ns) > 0 && msg.Ns[0].Header().Rrtype == dns.TypeNS
+}
@@ -0,0 +1,59 @@
+package resolver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/1f349/azalea/models"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+// synthesiseDname returns the DNAME record at the closest ancestor of the name
+// followed by the CNAME record synthesised from it as described in RFC 6672, no
+// records are returned if there is no DNAME record above the name
+func (r *Resolver) synthesiseDname(ctx context.Context, qname string) ([]*models.Record, error) {
+	name := strings.ToLower(qname)
+	zone, err := r.zoneForName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil || name == zone {
+		return nil, err
+	}
+
+	owner := name
+	for owner != zone {
+		_, owner, _ = strings.Cut(owner, ".")
+		records, err := r.LookupAnswersForType(ctx, owner, dns.TypeDNAME, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			continue
+		}
+		dname, ok := records[0].Value.(*models.DNAME)
+		if !ok {
+			continue
+		}
+
+		// replace the owner name suffix with the target, the prefix keeps the
+		// case used in the question
+		target := qname[:len(qname)-len(owner)] + dns.Fqdn(dname.Target)
+		if len(target) > 255 {
+			return nil, fmt.Errorf("DNAME substitution for %s is too long", qname)
+		}
+		return []*models.Record{
+			records[0],
+			{
+				Id:    records[0].Id,
+				Name:  qname,
+				Type:  dns.TypeCNAME,
+				Ttl:   records[0].Ttl,
+				Value: &models.CNAME{Target: target},
+			},
+		}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,519 @@
+package resolver
+
+import (
+	"context"
+	"crypto"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/dnssec"
+	"github.com/1f349/azalea/models"
+	"github.com/1f349/azalea/utils"
+	"github.com/miekg/dns"
+	"slices"
+	"strings"
+	"time"
+)
+
+// signatureValidity is how long generated signatures are valid for, the
+// inception is backdated by an hour to allow for clock skew
+const signatureValidity = 7 * 24 * time.Hour
+
+// keyCacheTtl is how long zone keys are cached before reloading them
+const keyCacheTtl = time.Minute
+
+var nsec3HashEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+type signingKey struct {
+	dnskey *dns.DNSKEY
+	signer crypto.Signer
+}
+
+// zoneKeys contains the DNSSEC keys for a zone
+type zoneKeys struct {
+	dnskeys  []*dns.DNSKEY
+	cdnskeys []*dns.DNSKEY
+	cds      []*dns.DS
+	ksks     []signingKey
+	zsks     []signingKey
+	loaded   time.Time
+}
+
+// getZoneKeys returns the cached zone keys or loads them from the database, nil
+// is returned if the zone is not signed
+func (r *Resolver) getZoneKeys(ctx context.Context, zone string) (*zoneKeys, error) {
+	r.keyMu.RLock()
+	keys, ok := r.keyCache[zone]
+	r.keyMu.RUnlock()
+	if ok && time.Since(keys.loaded) < keyCacheTtl {
+		return keys.orNil(), nil
+	}
+
+	rows, err := r.db.GetZoneKeys(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	keys = &zoneKeys{loaded: time.Now()}
+	for _, i := range rows {
+		if dnssec.InDnskeySet(i) {
+			keys.dnskeys = append(keys.dnskeys, dnssec.DNSKEY(zone, i))
+		}
+		if dnssec.InDsSet(i) {
+			keys.cdnskeys = append(keys.cdnskeys, dnssec.DNSKEY(zone, i))
+		}
+		if !dnssec.Signs(i) {
+			continue
+		}
+		key, err := parseZoneKey(zone, i)
+		if err != nil {
+			return nil, err
+		}
+		if dnssec.IsKsk(i) {
+			keys.ksks = append(keys.ksks, key)
+		} else {
+			keys.zsks = append(keys.zsks, key)
+		}
+	}
+	keys.cds = dnssec.DsRecords(zone, rows)
+
+	r.keyMu.Lock()
+	r.keyCache[zone] = keys
+	r.keyMu.Unlock()
+	return keys.orNil(), nil
+}
+
+// orNil returns nil if the zone has no keys
+func (k *zoneKeys) orNil() *zoneKeys {
+	if len(k.dnskeys) == 0 {
+		return nil
+	}
+	return k
+}
+
+func parseZoneKey(zone string, row database.ZoneKey) (signingKey, error) {
+	dnskey := dnssec.DNSKEY(zone, row)
+	priv, err := dnskey.NewPrivateKey(row.PrivateKey)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("invalid private key %d for %s: %w", row.ID, zone, err)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return signingKey{}, fmt.Errorf("private key %d for %s cannot sign", row.ID, zone)
+	}
+	return signingKey{dnskey: dnskey, signer: signer}, nil
+}
+
+// getDnssecRecords returns the DNSKEY, CDNSKEY, CDS or NSEC3PARAM records at the
+// zone apex
+func (r *Resolver) getDnssecRecords(ctx context.Context, name string, rrType uint16) ([]*models.Record, error) {
+	zone, err := r.zoneForName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil || zone != name {
+		return nil, err
+	}
+	keys, err := r.getZoneKeys(ctx, zone)
+	if err != nil || keys == nil {
+		return nil, err
+	}
+
+	switch rrType {
+	case dns.TypeDNSKEY:
+		records := make([]*models.Record, 0, len(keys.dnskeys))
+		for _, i := range keys.dnskeys {
+			records = append(records, &models.Record{
+				Id:   models.StaticDnssecRecord,
+				Name: zone,
+				Type: dns.TypeDNSKEY,
+				Value: &models.DNSKEY{
+					Flags:     i.Flags,
+					Protocol:  i.Protocol,
+					Algorithm: i.Algorithm,
+					PublicKey: i.PublicKey,
+				},
+			})
+		}
+		return records, nil
+	case dns.TypeCDNSKEY:
+		records := make([]*models.Record, 0, len(keys.cdnskeys))
+		for _, i := range keys.cdnskeys {
+			records = append(records, &models.Record{
+				Id:   models.StaticDnssecRecord,
+				Name: zone,
+				Type: dns.TypeCDNSKEY,
+				Value: &models.CDNSKEY{
+					Flags:     i.Flags,
+					Protocol:  i.Protocol,
+					Algorithm: i.Algorithm,
+					PublicKey: i.PublicKey,
+				},
+			})
+		}
+		return records, nil
+	case dns.TypeCDS:
+		records := make([]*models.Record, 0, len(keys.cds))
+		for _, i := range keys.cds {
+			records = append(records, &models.Record{
+				Id:   models.StaticDnssecRecord,
+				Name: zone,
+				Type: dns.TypeCDS,
+				Value: &models.CDS{
+					KeyTag:     i.KeyTag,
+					Algorithm:  i.Algorithm,
+					DigestType: i.DigestType,
+					Digest:     i.Digest,
+				},
+			})
+		}
+		return records, nil
+	case dns.TypeNSEC3PARAM:
+		return []*models.Record{{
+			Id:    models.StaticDnssecRecord,
+			Name:  zone,
+			Type:  dns.TypeNSEC3PARAM,
+			Value: &models.NSEC3PARAM{Hash: dns.SHA1},
+		}}, nil
+	}
+	return nil, nil
+}
+
+// signResponse adds signatures and NSEC3 denial of existence proofs to the
+// response if the client set the DO bit and the zone is signed
+func (r *Resolver) signResponse(ctx context.Context, req, msg *dns.Msg) error {
+	opt := req.IsEdns0()
+	if opt == nil || !opt.Do() || msg.Rcode == dns.RcodeServerFailure {
+		return nil
+	}
+	q := req.Question[0]
+	name := strings.ToLower(q.Name)
+	now := time.Now()
+
+	// referrals prove the delegation is signed with the DS records or unsigned
+	// with an NSEC3 record for the zone cut, the NS records and glue belong to
+	// the child zone so they are not signed
+	if isReferral(msg) {
+		zone, keys, err := r.zoneKeysForName(ctx, name)
+		if err != nil || keys == nil {
+			return err
+		}
+		cut := strings.ToLower(msg.Ns[0].Header().Name)
+		ds, err := r.LookupAnswersForType(ctx, cut, dns.TypeDS, nil)
+		if err != nil {
+			return err
+		}
+		var proof []dns.RR
+		for _, record := range ds {
+			proof = append(proof, record.RR(record.TtlOr(models.DefaultTtl)))
+		}
+		if len(proof) == 0 {
+			ttl, err := r.negativeTtl(ctx, zone)
+			if err != nil {
+				return err
+			}
+			proof, err = r.denialOfExistence(ctx, keys, zone, cut, dns.TypeDS, true, ttl)
+			if err != nil {
+				return err
+			}
+		}
+		proof, err = keys.sign(zone, proof, now)
+		if err != nil {
+			return err
+		}
+		msg.Ns = append(msg.Ns, proof...)
+		return nil
+	}
+
+	// negative answers prove the name or type does not exist, the proof is for
+	// the last name in a CNAME chain which can be in another zone
+	if len(msg.Ns) > 0 && msg.Ns[0].Header().Rrtype == dns.TypeSOA {
+		denied := name
+		for _, rr := range msg.Answer {
+			if cname, ok := rr.(*dns.CNAME); ok {
+				denied = strings.ToLower(cname.Target)
+			}
+		}
+		zone, keys, err := r.zoneKeysForName(ctx, denied)
+		if err != nil {
+			return err
+		}
+		if keys != nil {
+			ttl, err := r.negativeTtl(ctx, zone)
+			if err != nil {
+				return err
+			}
+			nodata := msg.Rcode == dns.RcodeSuccess
+			nsec3s, err := r.denialOfExistence(ctx, keys, zone, denied, q.Qtype, nodata, ttl)
+			if err != nil {
+				return err
+			}
+			msg.Ns = append(msg.Ns, nsec3s...)
+		}
+	}
+
+	// CNAME chains and additional records can contain records from several
+	// zones, each is signed with the keys for its own zone
+	var err error
+	msg.Answer, err = r.signByZone(ctx, msg.Answer, now)
+	if err != nil {
+		return err
+	}
+	msg.Ns, err = r.signByZone(ctx, msg.Ns, now)
+	if err != nil {
+		return err
+	}
+	msg.Extra, err = r.signByZone(ctx, msg.Extra, now)
+	return err
+}
+
+// zoneKeysForName returns the hosted zone containing the name and its keys, the
+// keys are nil if the zone is not signed or not hosted
+func (r *Resolver) zoneKeysForName(ctx context.Context, name string) (string, *zoneKeys, error) {
+	zone, err := r.zoneForName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	keys, err := r.getZoneKeys(ctx, zone)
+	return zone, keys, err
+}
+
+// signByZone signs each run of records from the same zone with the keys for
+// that zone, records from unsigned zones or names which are not hosted are
+// left unsigned
+func (r *Resolver) signByZone(ctx context.Context, rrs []dns.RR, now time.Time) ([]dns.RR, error) {
+	out := make([]dns.RR, 0, len(rrs))
+	for len(rrs) > 0 {
+		zone, keys, err := r.zoneKeysForName(ctx, strings.ToLower(rrs[0].Header().Name))
+		if err != nil {
+			return nil, err
+		}
+		n := 1
+		for n < len(rrs) {
+			next, err := r.zoneForName(ctx, strings.ToLower(rrs[n].Header().Name))
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+			if next != zone {
+				break
+			}
+			n++
+		}
+		run := rrs[:n]
+		rrs = rrs[n:]
+		if keys == nil {
+			out = append(out, run...)
+			continue
+		}
+		signed, err := keys.sign(zone, run, now)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, signed...)
+	}
+	return out, nil
+}
+
+// sign returns the records with the signatures for each RRset added after the
+// RRset, DNSKEY, CDNSKEY and CDS records are signed by the KSKs and other
+// records by the ZSKs
+func (k *zoneKeys) sign(zone string, rrs []dns.RR, now time.Time) ([]dns.RR, error) {
+	type rrsetKey struct {
+		name   string
+		rrType uint16
+	}
+	var order []rrsetKey
+	rrsets := make(map[rrsetKey][]dns.RR)
+	for _, rr := range rrs {
+		key := rrsetKey{strings.ToLower(rr.Header().Name), rr.Header().Rrtype}
+		if _, ok := rrsets[key]; !ok {
+			order = append(order, key)
+		}
+		rrsets[key] = append(rrsets[key], rr)
+	}
+
+	out := make([]dns.RR, 0, len(rrs)+len(order))
+	for _, key := range order {
+		rrset := rrsets[key]
+		signers := k.zsks
+		if isKeySigned(key.rrType) || len(signers) == 0 {
+			signers = k.ksks
+		}
+		out = append(out, rrset...)
+		for _, i := range signers {
+			sig := &dns.RRSIG{
+				Hdr:        dns.RR_Header{Ttl: rrset[0].Header().Ttl},
+				Algorithm:  i.dnskey.Algorithm,
+				Expiration: uint32(now.Add(signatureValidity).Unix()),
+				Inception:  uint32(now.Add(-time.Hour).Unix()),
+				KeyTag:     i.dnskey.KeyTag(),
+				SignerName: zone,
+			}
+			err := sig.Sign(i.signer, rrset)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, sig)
+		}
+	}
+	return out, nil
+}
+
+// isKeySigned returns true for record types signed by the KSKs, RFC 7344
+// requires CDS and CDNSKEY to be signed by a key in the current DS RRset
+func isKeySigned(rrType uint16) bool {
+	switch rrType {
+	case dns.TypeDNSKEY, dns.TypeCDNSKEY, dns.TypeCDS:
+		return true
+	}
+	return false
+}
+
+// denialOfExistence generates minimally covering NSEC3 records proving the name
+// or the requested type does not exist
+func (r *Resolver) denialOfExistence(ctx context.Context, keys *zoneKeys, zone, name string, qtype uint16, nodata bool, ttl uint32) ([]dns.RR, error) {
+	// the name exists without the requested type, empty non-terminals match
+	// with an empty type bitmap
+	if nodata {
+		types, err := r.typesAtName(ctx, keys, zone, name)
+		if err != nil {
+			return nil, err
+		}
+		// ALIAS and location resolving records may not have an address of
+		// the requested family, the bitmap must not claim the type exists
+		types = slices.DeleteFunc(types, func(t uint16) bool { return t == qtype })
+		return []dns.RR{nsec3Match(zone, name, types, ttl)}, nil
+	}
+
+	// find the closest encloser which exists
+	encloser := name
+	nextCloser := name
+	var encloserTypes []uint16
+	for encloser != zone {
+		nextCloser = encloser
+		_, encloser, _ = strings.Cut(encloser, ".")
+		if !dns.IsSubDomain(zone, encloser) {
+			return nil, errors.New("name is outside the zone")
+		}
+		exists, err := r.nameExists(ctx, encloser)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			encloserTypes, err = r.typesAtName(ctx, keys, zone, encloser)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	return []dns.RR{
+		nsec3Match(zone, encloser, encloserTypes, ttl),
+		nsec3Cover(zone, nextCloser, ttl),
+		nsec3Cover(zone, "*."+encloser, ttl),
+	}, nil
+}
+
+// typesAtName returns the sorted record types which exist at the name
+func (r *Resolver) typesAtName(ctx context.Context, keys *zoneKeys, zone, name string) ([]uint16, error) {
+	rows, err := r.db.LookupRecordTypes(ctx, database.LookupRecordTypesParams{
+		Name:   utils.SimplifyRecordName(name, zone),
+		Name_2: zone,
+	})
+	if err != nil {
+		return nil, err
+	}
+	types := make([]uint16, 0, len(rows)+5)
+	for _, i := range rows {
+		if i == "LOC_RES" || i == "ALIAS" {
+			types = append(types, dns.TypeA, dns.TypeAAAA)
+			continue
+		}
+		if t := models.StringToType(i); t != dns.TypeNone {
+			types = append(types, t)
+		}
+	}
+	// only the NS and DS records at a zone cut belong to this zone and the NS
+	// records are not signed, see RFC 4035 section 2.3
+	if name != zone && slices.Contains(types, dns.TypeNS) {
+		types = slices.DeleteFunc(types, func(t uint16) bool {
+			return t != dns.TypeNS && t != dns.TypeDS
+		})
+		if !slices.Contains(types, dns.TypeDS) {
+			slices.Sort(types)
+			return slices.Compact(types), nil
+		}
+	}
+	if name == zone {
+		types = append(types, dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY, dns.TypeNSEC3PARAM)
+		if len(keys.cds) > 0 {
+			types = append(types, dns.TypeCDS, dns.TypeCDNSKEY)
+		}
+	}
+	if len(types) > 0 {
+		types = append(types, dns.TypeRRSIG)
+	}
+	slices.Sort(types)
+	return slices.Compact(types), nil
+}
+
+// nsec3Match returns an NSEC3 record matching the name with the type bitmap
+func nsec3Match(zone, name string, types []uint16, ttl uint32) dns.RR {
+	hash := nsec3HashName(name)
+	return newNsec3(zone, hash, incrementHash(hash), types, ttl)
+}
+
+// nsec3Cover returns an NSEC3 record covering only the hash of the name
+func nsec3Cover(zone, name string, ttl uint32) dns.RR {
+	hash := nsec3HashName(name)
+	return newNsec3(zone, decrementHash(hash), incrementHash(hash), nil, ttl)
+}
+
+func newNsec3(zone string, owner, next []byte, types []uint16, ttl uint32) dns.RR {
+	return &dns.NSEC3{
+		Hdr: dns.RR_Header{
+			Name:   nsec3HashEncoding.EncodeToString(owner) + "." + zone,
+			Rrtype: dns.TypeNSEC3,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Hash:       dns.SHA1,
+		HashLength: uint8(len(next)),
+		NextDomain: nsec3HashEncoding.EncodeToString(next),
+		TypeBitMap: types,
+	}
+}
+
+// nsec3HashName hashes the name with no salt or extra iterations as
+// recommended by RFC 9276
+func nsec3HashName(name string) []byte {
+	b, _ := nsec3HashEncoding.DecodeString(dns.HashName(name, dns.SHA1, 0, ""))
+	return b
+}
+
+func incrementHash(hash []byte) []byte {
+	out := slices.Clone(hash)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i]++
+		if out[i] != 0 {
+			break
+		}
+	}
+	return out
+}
+
+func decrementHash(hash []byte) []byte {
+	out := slices.Clone(hash)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i]--
+		if out[i] != 0xff {
+			break
+		}
+	}
+	return out
+}
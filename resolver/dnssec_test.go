@@ -0,0 +1,328 @@
+package resolver
+
+import (
+	"context"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/dnssec"
+	"github.com/1f349/azalea/secondary"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// keyStore adds zone keys to the in-memory store
+type keyStore struct {
+	*secondary.Store
+	keys map[string][]database.ZoneKey
+}
+
+func (k *keyStore) GetZoneKeys(_ context.Context, name string) ([]database.ZoneKey, error) {
+	return k.keys[name], nil
+}
+
+// newSignedResolver creates a resolver serving each zone from the records, the
+// zones in signed have an active KSK and ZSK
+func newSignedResolver(t *testing.T, zones map[string][]string, signed ...string) (*Resolver, *keyStore) {
+	t.Helper()
+	store := &keyStore{Store: secondary.NewStore(), keys: make(map[string][]database.ZoneKey)}
+	for zone, records := range zones {
+		soa, err := dns.NewRR(zone + " 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 300")
+		assert.NoError(t, err)
+		rrs := make([]dns.RR, 0, len(records))
+		for _, i := range records {
+			rr, err := dns.NewRR(i)
+			assert.NoError(t, err)
+			rrs = append(rrs, rr)
+		}
+		store.Set(secondary.NewZone(zone, soa.(*dns.SOA), rrs))
+	}
+	var id int32
+	for _, zone := range signed {
+		for _, flags := range []uint16{dns.ZONE | dns.SEP, dns.ZONE} {
+			params, err := dnssec.GenerateKey(database.Zone{Name: zone}, flags, dnssec.StateActive, time.Now())
+			assert.NoError(t, err)
+			id++
+			store.keys[zone] = append(store.keys[zone], database.ZoneKey{
+				ID:             id,
+				Flags:          params.Flags,
+				Algorithm:      params.Algorithm,
+				PublicKey:      params.PublicKey,
+				PrivateKey:     params.PrivateKey,
+				State:          params.State,
+				StateChangedAt: params.StateChangedAt,
+			})
+		}
+	}
+	return NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}, Mbox: "hostmaster.example.com."}, store, nil, nil), store
+}
+
+func testSignedLookup(res *Resolver, name string, qtype uint16) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	req.SetEdns0(MaxUdpSize, true)
+	return res.Lookup(context.Background(), req, nil)
+}
+
+// verifySignatures checks every RRSIG in the records is valid for the RRset it
+// covers using the DNSKEY of the signing zone, the signer names are returned
+func verifySignatures(t *testing.T, store *keyStore, rrs []dns.RR) []string {
+	t.Helper()
+	var signers []string
+	for _, rr := range rrs {
+		sig, ok := rr.(*dns.RRSIG)
+		if !ok {
+			continue
+		}
+		var rrset []dns.RR
+		for _, i := range rrs {
+			if i.Header().Rrtype == sig.TypeCovered && strings.EqualFold(i.Header().Name, sig.Hdr.Name) {
+				rrset = append(rrset, i)
+			}
+		}
+		var key *dns.DNSKEY
+		for _, i := range store.keys[sig.SignerName] {
+			if k := dnssec.DNSKEY(sig.SignerName, i); k.KeyTag() == sig.KeyTag {
+				key = k
+			}
+		}
+		if assert.NotNil(t, key, sig.String()) {
+			assert.NoError(t, sig.Verify(key, rrset), sig.String())
+			assert.True(t, sig.ValidityPeriod(time.Now()), sig.String())
+		}
+		signers = append(signers, sig.SignerName)
+	}
+	return signers
+}
+
+func TestResolver_Lookup_signedCnameChain(t *testing.T) {
+	res, store := newSignedResolver(t, map[string][]string{
+		"example.com.": {"www.example.com. 300 IN CNAME www.example.org."},
+		"example.org.": {"www.example.org. 300 IN A 10.0.0.1"},
+		"example.net.": {"www.example.net. 300 IN A 10.0.0.2"},
+	}, "example.com.", "example.org.")
+
+	// each record in the chain is signed by its own zone
+	msg := testSignedLookup(res, "www.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 4)
+	assert.Equal(t, []string{"example.com.", "example.org."}, verifySignatures(t, store, msg.Answer))
+
+	// the denial of existence is from the zone of the last name
+	msg = testSignedLookup(res, "www.example.com.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Equal(t, "example.org.", msg.Ns[0].Header().Name)
+	for _, signer := range verifySignatures(t, store, msg.Ns) {
+		assert.Equal(t, "example.org.", signer)
+	}
+
+	// unsigned zones are left unsigned
+	msg = testSignedLookup(res, "www.example.net.", dns.TypeA)
+	assert.Len(t, msg.Answer, 1)
+}
+
+// nsec3s returns the NSEC3 records in the section
+func nsec3s(rrs []dns.RR) []*dns.NSEC3 {
+	var out []*dns.NSEC3
+	for _, rr := range rrs {
+		if nsec3, ok := rr.(*dns.NSEC3); ok {
+			out = append(out, nsec3)
+		}
+	}
+	return out
+}
+
+func TestResolver_signResponse(t *testing.T) {
+	res, store := newSignedResolver(t, map[string][]string{
+		"example.com.": {
+			"www.example.com. 300 IN A 10.0.0.1",
+			"www.example.com. 300 IN A 10.0.0.2",
+			"mail.example.com. 300 IN MX 10 mx.example.com.",
+			"mx.example.com. 300 IN A 10.0.0.3",
+		},
+	}, "example.com.")
+	ksk := dnssec.DNSKEY("example.com.", store.keys["example.com."][0]).KeyTag()
+	zsk := dnssec.DNSKEY("example.com.", store.keys["example.com."][1]).KeyTag()
+
+	// each RRset has a single valid signature from the ZSK
+	msg := testSignedLookup(res, "www.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 3)
+	verifySignatures(t, store, msg.Answer)
+	assert.Equal(t, zsk, msg.Answer[2].(*dns.RRSIG).KeyTag)
+
+	// the DNSKEY RRset is signed by the KSK
+	msg = testSignedLookup(res, "example.com.", dns.TypeDNSKEY)
+	assert.Len(t, msg.Answer, 3)
+	verifySignatures(t, store, msg.Answer)
+	assert.Equal(t, ksk, msg.Answer[2].(*dns.RRSIG).KeyTag)
+
+	// additional records in the zone are signed
+	msg = testSignedLookup(res, "mail.example.com.", dns.TypeMX)
+	assert.Len(t, msg.Answer, 2)
+	verifySignatures(t, store, msg.Answer)
+	var extra []dns.RR
+	for _, rr := range msg.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+	assert.Len(t, extra, 2)
+	verifySignatures(t, store, extra)
+
+	// clients which don't set the DO bit get unsigned answers
+	msg = testLookup(res, "www.example.com.", dns.TypeA)
+	assert.Len(t, msg.Answer, 2)
+}
+
+func TestResolver_denialOfExistence(t *testing.T) {
+	res, store := newSignedResolver(t, map[string][]string{
+		"example.com.": {
+			"www.example.com. 300 IN A 10.0.0.1",
+			"a.b.example.com. 300 IN A 10.0.0.2",
+		},
+	}, "example.com.")
+
+	t.Run("nxdomain", func(t *testing.T) {
+		msg := testSignedLookup(res, "missing.www.example.com.", dns.TypeA)
+		assert.Equal(t, dns.RcodeNameError, msg.Rcode)
+		assert.NotEmpty(t, verifySignatures(t, store, msg.Ns))
+
+		// the closest encloser matches, the next closer name and the wildcard
+		// at the closest encloser are covered
+		proof := nsec3s(msg.Ns)
+		if assert.Len(t, proof, 3) {
+			assert.True(t, proof[0].Match("www.example.com."))
+			assert.True(t, proof[1].Cover("missing.www.example.com."))
+			assert.True(t, proof[2].Cover("*.www.example.com."))
+			assert.False(t, proof[1].Match("missing.www.example.com."))
+		}
+	})
+	t.Run("nodata", func(t *testing.T) {
+		msg := testSignedLookup(res, "www.example.com.", dns.TypeTXT)
+		assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+		assert.Empty(t, msg.Answer)
+		assert.NotEmpty(t, verifySignatures(t, store, msg.Ns))
+
+		// the name matches without the requested type in the bitmap
+		proof := nsec3s(msg.Ns)
+		if assert.Len(t, proof, 1) {
+			assert.True(t, proof[0].Match("www.example.com."))
+			assert.Contains(t, proof[0].TypeBitMap, dns.TypeA)
+			assert.NotContains(t, proof[0].TypeBitMap, dns.TypeTXT)
+		}
+	})
+	t.Run("empty non-terminal", func(t *testing.T) {
+		msg := testSignedLookup(res, "b.example.com.", dns.TypeA)
+		assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+		proof := nsec3s(msg.Ns)
+		if assert.Len(t, proof, 1) {
+			assert.True(t, proof[0].Match("b.example.com."))
+			assert.Empty(t, proof[0].TypeBitMap)
+		}
+	})
+}
+
+func TestResolver_denialOfExistence_alias(t *testing.T) {
+	res, store := newSignedResolver(t, map[string][]string{
+		"example.com.": {
+			"example.com. 300 IN ALIAS www.example.com.",
+			"www.example.com. 300 IN A 10.0.0.1",
+		},
+	}, "example.com.")
+
+	// the ALIAS target only has an A record so the AAAA type is not in the
+	// bitmap of the NODATA proof
+	msg := testSignedLookup(res, "example.com.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Empty(t, msg.Answer)
+	assert.NotEmpty(t, verifySignatures(t, store, msg.Ns))
+	proof := nsec3s(msg.Ns)
+	if assert.Len(t, proof, 1) {
+		assert.True(t, proof[0].Match("example.com."))
+		assert.Contains(t, proof[0].TypeBitMap, dns.TypeA)
+		assert.NotContains(t, proof[0].TypeBitMap, dns.TypeAAAA)
+	}
+
+	msg = testSignedLookup(res, "example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 2)
+	verifySignatures(t, store, msg.Answer)
+}
+
+// locStore adds a location resolving record at geo.example.com. to the store
+type locStore struct {
+	*keyStore
+}
+
+func (l *locStore) LookupRecordsForType(ctx context.Context, arg database.LookupRecordsForTypeParams) ([]database.LookupRecordsForTypeRow, error) {
+	rows, err := l.keyStore.LookupRecordsForType(ctx, arg)
+	if arg.Name == "geo" && arg.Name_2 == "example.com." {
+		rows = append(rows, database.LookupRecordsForTypeRow{ID: 100, Zone: 1, Name: "geo", Type: "LOC_RES", Value: "service", ZoneName: "example.com.", ZoneDefaultTtl: 300})
+	}
+	return rows, err
+}
+
+func (l *locStore) LookupRecordTypes(ctx context.Context, arg database.LookupRecordTypesParams) ([]string, error) {
+	types, err := l.keyStore.LookupRecordTypes(ctx, arg)
+	if arg.Name == "geo" && arg.Name_2 == "example.com." {
+		types = append(types, "LOC_RES")
+	}
+	return types, err
+}
+
+func TestResolver_denialOfExistence_locationResolving(t *testing.T) {
+	res, store := newSignedResolver(t, map[string][]string{
+		"example.com.": {"geo.example.com. 300 IN TXT \"info\""},
+	}, "example.com.")
+	res.db = &locStore{keyStore: store}
+
+	// the chosen location has no address for the client so the queried type
+	// is not in the bitmap of the NODATA proof
+	msg := testSignedLookup(res, "geo.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Empty(t, msg.Answer)
+	assert.NotEmpty(t, verifySignatures(t, store, msg.Ns))
+	proof := nsec3s(msg.Ns)
+	if assert.Len(t, proof, 1) {
+		assert.True(t, proof[0].Match("geo.example.com."))
+		assert.NotContains(t, proof[0].TypeBitMap, dns.TypeA)
+		assert.Contains(t, proof[0].TypeBitMap, dns.TypeAAAA)
+		assert.Contains(t, proof[0].TypeBitMap, dns.TypeTXT)
+	}
+}
+
+func TestResolver_denialOfExistence_ttl(t *testing.T) {
+	res, store := newSignedResolver(t, nil, "example.com.")
+	soa, err := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 60")
+	assert.NoError(t, err)
+	var rrs []dns.RR
+	for _, i := range []string{
+		"www.example.com. 300 IN A 10.0.0.1",
+		"sub.example.com. 3600 IN NS ns1.example.org.",
+	} {
+		rr, err := dns.NewRR(i)
+		assert.NoError(t, err)
+		rrs = append(rrs, rr)
+	}
+	store.Set(secondary.NewZone("example.com.", soa.(*dns.SOA), rrs))
+
+	// the NSEC3 records use the lower of the SOA TTL and the SOA minimum
+	msg := testSignedLookup(res, "missing.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, msg.Rcode)
+	proof := nsec3s(msg.Ns)
+	assert.NotEmpty(t, proof)
+	for _, i := range proof {
+		assert.Equal(t, uint32(60), i.Hdr.Ttl)
+	}
+
+	// the proof of an unsigned delegation does not use the NS record TTL
+	msg = testSignedLookup(res, "www.sub.example.com.", dns.TypeA)
+	proof = nsec3s(msg.Ns)
+	if assert.Len(t, proof, 1) {
+		assert.True(t, proof[0].Match("sub.example.com."))
+		assert.Equal(t, uint32(60), proof[0].Hdr.Ttl)
+	}
+}
@@ -0,0 +1,73 @@
+package resolver
+
+import (
+	"errors"
+	"github.com/miekg/dns"
+	"net"
+	"net/netip"
+)
+
+// clientSubnet returns the EDNS Client Subnet option from the request, nil is
+// returned if the option is missing, an error is returned if the option is
+// invalid as required by RFC 7871
+func clientSubnet(req *dns.Msg) (*dns.EDNS0_SUBNET, error) {
+	opt := req.IsEdns0()
+	if opt == nil {
+		return nil, nil
+	}
+	for _, i := range opt.Option {
+		subnet, ok := i.(*dns.EDNS0_SUBNET)
+		if !ok {
+			continue
+		}
+		var bits int
+		switch subnet.Family {
+		case 1:
+			bits = 32
+		case 2:
+			bits = 128
+		default:
+			return nil, errors.New("invalid client subnet family")
+		}
+		if subnet.SourceScope != 0 || int(subnet.SourceNetmask) > bits {
+			return nil, errors.New("invalid client subnet prefix")
+		}
+		addr, ok := netip.AddrFromSlice(subnet.Address)
+		if !ok {
+			return nil, errors.New("invalid client subnet address")
+		}
+		if bits == 32 {
+			addr = addr.Unmap()
+		}
+
+		// the address must not contain bits beyond the source prefix
+		prefix, err := addr.Prefix(int(subnet.SourceNetmask))
+		if err != nil || prefix.Addr() != addr {
+			return nil, errors.New("invalid client subnet address")
+		}
+		return subnet, nil
+	}
+	return nil, nil
+}
+
+// subnetAddr returns an address in the client subnet to use for location
+// resolving records
+func subnetAddr(subnet *dns.EDNS0_SUBNET) net.Addr {
+	return &net.UDPAddr{IP: subnet.Address}
+}
+
+// subnetResponse returns the client subnet option for the response, the scope
+// prefix is zero if the answer does not depend on the client subnet
+func subnetResponse(subnet *dns.EDNS0_SUBNET, usedSubnet bool) *dns.EDNS0_SUBNET {
+	var scope uint8
+	if usedSubnet {
+		scope = subnet.SourceNetmask
+	}
+	return &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        subnet.Family,
+		SourceNetmask: subnet.SourceNetmask,
+		SourceScope:   scope,
+		Address:       subnet.Address,
+	}
+}
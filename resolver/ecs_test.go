@@ -0,0 +1,59 @@
+package resolver
+
+import (
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestClientSubnet(t *testing.T) {
+	for _, i := range []struct {
+		family uint16
+		prefix uint8
+		scope  uint8
+		addr   string
+		valid  bool
+	}{
+		{1, 24, 0, "192.0.2.0", true},
+		{1, 0, 0, "0.0.0.0", true},
+		{2, 56, 0, "2001:db8:0:100::", true},
+		{1, 24, 0, "192.0.2.1", false},
+		{1, 33, 0, "192.0.2.0", false},
+		{1, 24, 24, "192.0.2.0", false},
+		{2, 48, 0, "2001:db8:0:100::", false},
+		{3, 24, 0, "192.0.2.0", false},
+	} {
+		req := new(dns.Msg)
+		req.SetQuestion("example.com.", dns.TypeA)
+		req.SetEdns0(1232, false)
+		req.IsEdns0().Option = append(req.IsEdns0().Option, &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        i.family,
+			SourceNetmask: i.prefix,
+			SourceScope:   i.scope,
+			Address:       net.ParseIP(i.addr),
+		})
+		subnet, err := clientSubnet(req)
+		if i.valid {
+			assert.NoError(t, err, i.addr)
+			assert.NotNil(t, subnet, i.addr)
+		} else {
+			assert.Error(t, err, i.addr)
+		}
+	}
+
+	// requests without the option are allowed
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	subnet, err := clientSubnet(req)
+	assert.NoError(t, err)
+	assert.Nil(t, subnet)
+}
+
+func TestSubnetResponse(t *testing.T) {
+	subnet := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("192.0.2.0")}
+	assert.Equal(t, uint8(24), subnetResponse(subnet, true).SourceScope)
+	assert.Equal(t, uint8(0), subnetResponse(subnet, false).SourceScope)
+	assert.Equal(t, "192.0.2.0:0", subnetAddr(subnet).String())
+}
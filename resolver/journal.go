@@ -0,0 +1,104 @@
+package resolver
+
+import (
+	"context"
+	"database/sql"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/models"
+	"github.com/gobuffalo/nulls"
+)
+
+// GetZoneChanges returns the records for an IXFR response which takes a
+// secondary from the provided serial to the current zone serial. The boolean
+// is false when the journal no longer covers the serial and a full zone
+// transfer is required instead, only the current SOA record is returned in
+// this case.
+func (r *Resolver) GetZoneChanges(ctx context.Context, zone string, serial uint32) ([]*models.Record, bool, error) {
+	soa, err := r.getSoaRecord(ctx, zone)
+	if err != nil {
+		return nil, false, err
+	}
+	if soa == nil {
+		return nil, false, sql.ErrNoRows
+	}
+	currentSerial := soa.Value.(*models.SOA).Serial
+
+	// the secondary is already up-to-date
+	if serial == currentSerial {
+		return []*models.Record{soa}, true, nil
+	}
+
+	entries, err := r.db.GetJournalEntries(ctx, database.GetJournalEntriesParams{
+		Name:       zone,
+		PrevSerial: serial,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if len(entries) == 0 || entries[len(entries)-1].Serial != currentSerial {
+		return []*models.Record{soa}, false, nil
+	}
+
+	// the SOA record uses the zone default TTL
+	defaultTtl := soa.TtlOr(models.DefaultTtl)
+
+	rrs := make([]*models.Record, 0, len(entries)+2)
+	rrs = append(rrs, soa)
+
+	// each change is the old SOA, deleted records, new SOA and added records
+	for start := 0; start < len(entries); {
+		end := start
+		for end < len(entries) && entries[end].Serial == entries[start].Serial {
+			end++
+		}
+		change := entries[start:end]
+
+		rrs = append(rrs, soaWithSerial(soa, change[0].PrevSerial))
+		rrs, err = appendJournalRecords(rrs, change, zone, defaultTtl, true)
+		if err != nil {
+			return nil, false, err
+		}
+		rrs = append(rrs, soaWithSerial(soa, change[0].Serial))
+		rrs, err = appendJournalRecords(rrs, change, zone, defaultTtl, false)
+		if err != nil {
+			return nil, false, err
+		}
+
+		start = end
+	}
+
+	rrs = append(rrs, soa)
+	return rrs, true, nil
+}
+
+// appendJournalRecords converts the journal entries which match the deleted
+// flag and appends them to rrs, records without a TTL use the default TTL
+func appendJournalRecords(rrs []*models.Record, entries []database.ZoneJournal, zone string, defaultTtl uint32, deleted bool) ([]*models.Record, error) {
+	for _, i := range entries {
+		if i.Deleted != deleted {
+			continue
+		}
+		rr, err := convertZoneRecord(database.Record{
+			Zone:  i.Zone,
+			Name:  i.Name,
+			Type:  i.Type,
+			Ttl:   i.Ttl,
+			Value: i.Value,
+		}, zone)
+		if err != nil {
+			return nil, err
+		}
+		rr.Ttl = nulls.NewUInt32(rr.TtlOr(defaultTtl))
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
+
+// soaWithSerial returns a copy of the SOA record with a different serial
+func soaWithSerial(soa *models.Record, serial uint32) *models.Record {
+	value := *soa.Value.(*models.SOA)
+	value.Serial = serial
+	record := *soa
+	record.Value = &value
+	return &record
+}
@@ -0,0 +1,102 @@
+package resolver
+
+import (
+	"context"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/models"
+	"github.com/1f349/azalea/secondary"
+	"github.com/gobuffalo/nulls"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// journalStore adds a journal to the in-memory store, entries are returned from
+// the first entry with the requested previous serial like the database query
+type journalStore struct {
+	*secondary.Store
+	journal []database.ZoneJournal
+}
+
+func (j *journalStore) GetJournalEntries(_ context.Context, arg database.GetJournalEntriesParams) ([]database.ZoneJournal, error) {
+	for n, i := range j.journal {
+		if i.PrevSerial == arg.PrevSerial {
+			return j.journal[n:], nil
+		}
+	}
+	return nil, nil
+}
+
+func newJournalResolver(t *testing.T, journal []database.ZoneJournal) *Resolver {
+	t.Helper()
+	soa, err := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 3 300 300 300 300")
+	assert.NoError(t, err)
+	rr, err := dns.NewRR("www.example.com. 300 IN A 10.0.0.3")
+	assert.NoError(t, err)
+	store := &journalStore{Store: secondary.NewStore(), journal: journal}
+	store.Set(secondary.NewZone("example.com.", soa.(*dns.SOA), []dns.RR{rr}))
+	return NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}, Mbox: "hostmaster.example.com."}, store, nil, nil)
+}
+
+func recordStrings(records []*models.Record) []string {
+	s := make([]string, 0, len(records))
+	for _, i := range records {
+		s = append(s, i.RR(i.TtlOr(models.DefaultTtl)).String())
+	}
+	return s
+}
+
+func TestResolver_GetZoneChanges(t *testing.T) {
+	res := newJournalResolver(t, []database.ZoneJournal{
+		{ID: 1, Zone: 1, PrevSerial: 1, Serial: 2, Name: "www", Type: "A", Value: "10.0.0.1"},
+		{ID: 2, Zone: 1, PrevSerial: 2, Serial: 3, Deleted: true, Name: "www", Type: "A", Value: "10.0.0.1"},
+		{ID: 3, Zone: 1, PrevSerial: 2, Serial: 3, Name: "www", Type: "A", Ttl: nulls.NewUInt32(60), Value: "10.0.0.3"},
+	})
+	soa := func(serial string) string {
+		return "example.com.\t300\tIN\tSOA\tns1.example.com. hostmaster.example.com. " + serial + " 300 300 300 300"
+	}
+
+	// each step is the old SOA, deleted records, new SOA and added records
+	changes, covered, err := res.GetZoneChanges(context.Background(), "example.com.", 1)
+	assert.NoError(t, err)
+	assert.True(t, covered)
+	assert.Equal(t, []string{
+		soa("3"),
+		soa("1"),
+		soa("2"),
+		"www.example.com.\t300\tIN\tA\t10.0.0.1",
+		soa("2"),
+		"www.example.com.\t300\tIN\tA\t10.0.0.1",
+		soa("3"),
+		"www.example.com.\t60\tIN\tA\t10.0.0.3",
+		soa("3"),
+	}, recordStrings(changes))
+
+	// a secondary which is up-to-date only gets the current SOA
+	changes, covered, err = res.GetZoneChanges(context.Background(), "example.com.", 3)
+	assert.NoError(t, err)
+	assert.True(t, covered)
+	assert.Equal(t, []string{soa("3")}, recordStrings(changes))
+
+	// serials missing from the journal need a full zone transfer
+	changes, covered, err = res.GetZoneChanges(context.Background(), "example.com.", 0)
+	assert.NoError(t, err)
+	assert.False(t, covered)
+	assert.Equal(t, []string{soa("3")}, recordStrings(changes))
+}
+
+func TestResolver_GetZoneChanges_gap(t *testing.T) {
+	// the journal does not reach the current serial, this happens when the
+	// journal is cleared by a change to the zone settings
+	res := newJournalResolver(t, []database.ZoneJournal{
+		{ID: 1, Zone: 1, PrevSerial: 1, Serial: 2, Name: "www", Type: "A", Value: "10.0.0.1"},
+	})
+	changes, covered, err := res.GetZoneChanges(context.Background(), "example.com.", 1)
+	assert.NoError(t, err)
+	assert.False(t, covered)
+	assert.Len(t, changes, 1)
+
+	_, _, err = res.GetZoneChanges(context.Background(), "example.org.", 1)
+	assert.Error(t, err)
+}
@@ -2,6 +2,8 @@ package resolver
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/1f349/azalea/conf"
 	"github.com/1f349/azalea/converters"
@@ -9,49 +11,68 @@ import (
 	"github.com/1f349/azalea/logger"
 	"github.com/1f349/azalea/models"
 	"github.com/1f349/azalea/utils"
+	"github.com/gobuffalo/nulls"
 	"github.com/miekg/dns"
 	"github.com/rcrowley/go-metrics"
-	"golang.org/x/net/publicsuffix"
 	"math/rand/v2"
 	"net"
 	"net/netip"
+	"slices"
 	"strings"
 	"sync"
-	"time"
 )
 
+// resolverQueries contains the queries used by the resolver, this is provided
+// by database.Queries or by the in-memory store of a secondary nameserver
+type resolverQueries interface {
+	LookupRecordsForType(ctx context.Context, arg database.LookupRecordsForTypeParams) ([]database.LookupRecordsForTypeRow, error)
+	GetZones(ctx context.Context) ([]database.Zone, error)
+	GetZone(ctx context.Context, name string) (database.Zone, error)
+	GetZoneForName(ctx context.Context, name string) (database.Zone, error)
+	GetZoneRecords(ctx context.Context, name string) ([]database.Record, error)
+	GetJournalEntries(ctx context.Context, arg database.GetJournalEntriesParams) ([]database.ZoneJournal, error)
+	GetZoneKeys(ctx context.Context, name string) ([]database.ZoneKey, error)
+	LookupRecordTypes(ctx context.Context, arg database.LookupRecordTypesParams) ([]string, error)
+	CountRecordsBelowName(ctx context.Context, arg database.CountRecordsBelowNameParams) (int64, error)
+	CountDelegations(ctx context.Context, name string) (int64, error)
+}
+
 type Resolver struct {
-	soa     conf.SoaConf
-	db      *database.Queries
-	zoneMu  *sync.RWMutex
-	zoneMap map[int64]string
-	geo     *GeoResolver
+	soa   conf.SoaConf
+	db    resolverQueries
+	geo   *GeoResolver
+	alias *AliasResolver
+
+	keyMu    *sync.RWMutex
+	keyCache map[string]*zoneKeys
+
+	cutMu    *sync.RWMutex
+	cutCache map[string]delegatedZone
 }
 
-func NewResolver(soa conf.SoaConf, db *database.Queries, geo *GeoResolver) *Resolver {
+func NewResolver(soa conf.SoaConf, db resolverQueries, geo *GeoResolver, alias *AliasResolver) *Resolver {
 	return &Resolver{
-		soa:     soa,
-		db:      db,
-		zoneMu:  new(sync.RWMutex),
-		zoneMap: make(map[int64]string),
-		geo:     geo,
+		soa:   soa,
+		db:    db,
+		geo:   geo,
+		alias: alias,
+
+		keyMu:    new(sync.RWMutex),
+		keyCache: make(map[string]*zoneKeys),
+
+		cutMu:    new(sync.RWMutex),
+		cutCache: make(map[string]delegatedZone),
 	}
 }
 
+// Authority returns the SOA record of the hosted zone containing the domain
 func (r *Resolver) Authority(ctx context.Context, domain string) (soa *models.Record) {
-	tree := strings.Split(domain, ".")
-	for i := range tree {
-		subdomain := strings.Join(tree[i:], ".")
-
-		answers, err := r.LookupAnswersForType(ctx, subdomain, dns.TypeSOA, nil)
-		if err != nil {
-			return
-		}
-
-		if len(answers) == 1 {
-			soa = answers[0]
-			return
-		}
+	soa, err := r.getSoaRecord(ctx, strings.ToLower(domain))
+	if err != nil {
+		return nil
+	}
+	if soa != nil {
+		return soa
 	}
 
 	missingCounter := metrics.GetOrRegisterCounter("resolver.authority.missing_soa", metrics.DefaultRegistry)
@@ -59,79 +80,256 @@ func (r *Resolver) Authority(ctx context.Context, domain string) (soa *models.Re
 	return
 }
 
+// MaxUdpSize is the EDNS UDP payload size advertised in responses, this is the
+// size recommended by DNS flag day 2020 to avoid IP fragmentation
+const MaxUdpSize = 1232
+
 func (r *Resolver) Lookup(ctx context.Context, req *dns.Msg, addr net.Addr) (msg *dns.Msg) {
 	q := req.Question[0]
+	ctx = withZoneCache(ctx)
 
 	msg = new(dns.Msg)
 	msg.SetReply(req)
 	msg.Authoritative = true
 	msg.RecursionAvailable = false
 
-	var answers []*models.Record
-	var errors []error
-	errored := false
+	// only EDNS version 0 is supported
+	if opt := req.IsEdns0(); opt != nil && opt.Version() != 0 {
+		msg.SetEdns0(MaxUdpSize, opt.Do())
+		msg.Rcode = dns.RcodeBadVers
+		return
+	}
 
-	var aChan chan *models.Record
-	var eChan chan error
+	// use the client subnet for location resolving records instead of the
+	// address of the recursive resolver
+	subnet, err := clientSubnet(req)
+	if err != nil {
+		msg.SetRcode(req, dns.RcodeFormatError)
+		msg.SetEdns0(MaxUdpSize, req.IsEdns0().Do())
+		return
+	}
+	if subnet != nil && subnet.SourceNetmask > 0 {
+		addr = subnetAddr(subnet)
+	}
+
+	var answers, delegation []*models.Record
+	last := strings.ToLower(q.Name)
+	found := false
+	exists := false
+	errored := false
 
 	if q.Qclass == dns.ClassINET {
-		aChan, eChan = r.AnswerQuestion(ctx, q, addr)
-		answers, errors = gatherFromChannels(aChan, eChan)
-	}
-
-	errored = len(errors) > 0
-	if len(answers) == 0 {
-		// If we failed to find any answers, let's keep looking up the tree for
-		// any wildcard domain entries.
-		parts := strings.Split(q.Name, ".")
-		for level := 1; level < len(parts); level++ {
-			domain := strings.Join(parts[level:], ".")
-			if len(domain) > 1 {
-				question := dns.Question{
-					Name:   "*." + dns.Fqdn(domain),
-					Qtype:  q.Qtype,
-					Qclass: q.Qclass}
-
-				aChan, eChan = r.AnswerQuestion(ctx, question, addr)
-				answers, errors = gatherFromChannels(aChan, eChan)
-
-				errored = errored || len(errors) > 0
-				if len(answers) > 0 {
-					break
-				}
-			}
+		delegation, err = r.delegation(ctx, q)
+		if err == nil && len(delegation) == 0 {
+			answers, last, found, exists, err = r.answerChain(ctx, q, addr)
+		}
+		if err != nil {
+			logger.Logger.Error("Failed to answer question", "q", q, "err", err)
+			errored = true
 		}
 	}
 
 	missCounter := metrics.GetOrRegisterCounter("resolver.answers.miss", metrics.DefaultRegistry)
 	hitCounter := metrics.GetOrRegisterCounter("resolver.answers.hit", metrics.DefaultRegistry)
 	errorCounter := metrics.GetOrRegisterCounter("resolver.answers.error", metrics.DefaultRegistry)
+	referralCounter := metrics.GetOrRegisterCounter("resolver.answers.referral", metrics.DefaultRegistry)
 
 	if errored {
 		// TODO(tarnfeld): Send special TXT records with a server error response code
 		errorCounter.Inc(1)
 		msg.SetRcode(req, dns.RcodeServerFailure)
-	} else if len(answers) == 0 {
-		soa := r.Authority(ctx, q.Name)
-		missCounter.Inc(1)
-		msg.SetRcode(req, dns.RcodeNameError)
-		if soa != nil {
-			msg.Ns = []dns.RR{soa.RR(300)} // TODO(melon): per domain default ttl
-		} else {
-			msg.Authoritative = false // No SOA? We're not authoritative
+	} else if len(delegation) > 0 {
+		// the child zone is authoritative for names at or below the zone cut
+		referralCounter.Inc(1)
+		msg.Authoritative = false
+		for _, record := range delegation {
+			msg.Ns = append(msg.Ns, record.RR(record.TtlOr(models.DefaultTtl)))
 		}
+		extra, err := r.additionalRecords(ctx, msg.Ns, addr)
+		if err != nil {
+			logger.Logger.Warn("Failed to find glue records", "err", err)
+		}
+		msg.Extra = extra
 	} else {
-		hitCounter.Inc(1)
 		for _, record := range answers {
-			rr := record.RR(300)
-			rr.Header().Name = q.Name
-			msg.Answer = append(msg.Answer, rr) // TODO(melon): per domain default ttl
+			msg.Answer = append(msg.Answer, record.RR(record.TtlOr(models.DefaultTtl)))
+		}
+
+		if found {
+			hitCounter.Inc(1)
+			extra, err := r.additionalRecords(ctx, msg.Answer, addr)
+			if err != nil {
+				// the additional section is optional so the answer is still sent
+				logger.Logger.Warn("Failed to find additional records", "err", err)
+			}
+			msg.Extra = extra
+		} else {
+			// the rcode and SOA record are for the last name in a CNAME chain
+			soa := r.Authority(ctx, last)
+			missCounter.Inc(1)
+			if !exists {
+				msg.SetRcode(req, dns.RcodeNameError)
+			}
+			if soa != nil {
+				msg.Ns = []dns.RR{soa.RR(soa.TtlOr(models.DefaultTtl))}
+			} else {
+				msg.Authoritative = false // No SOA? We're not authoritative
+			}
 		}
 	}
 
+	err = r.signResponse(ctx, req, msg)
+	if err != nil {
+		logger.Logger.Error("Failed to sign response", "err", err)
+		errorCounter.Inc(1)
+		msg.SetRcode(req, dns.RcodeServerFailure)
+		msg.Answer = nil
+		msg.Ns = nil
+		msg.Extra = nil
+	}
+
+	if opt := req.IsEdns0(); opt != nil {
+		msg.SetEdns0(MaxUdpSize, opt.Do())
+		if subnet != nil {
+			// the scope is only set if a location resolving record was used
+			usedSubnet := subnet.SourceNetmask > 0 && slices.ContainsFunc(answers, func(record *models.Record) bool {
+				return record.Id == models.DynamicRecords
+			})
+			msgOpt := msg.IsEdns0()
+			msgOpt.Option = append(msgOpt.Option, subnetResponse(subnet, usedSubnet))
+		}
+	}
 	return
 }
 
+// maxCnameChain is the number of CNAME records followed in a single response
+const maxCnameChain = 8
+
+// answerChain answers the question and follows CNAME chains through the hosted
+// zones, the records for every name in the chain are
+// returned and last is the final name in the chain, found is true if the final
+// name had answers and exists is false if the final name does not exist
+func (r *Resolver) answerChain(ctx context.Context, q dns.Question, addr net.Addr) (answers []*models.Record, last string, found, exists bool, err error) {
+	last = strings.ToLower(q.Name)
+	hop, exists, err := r.answerName(ctx, q, addr)
+	if err != nil {
+		return nil, last, false, false, err
+	}
+	answers = hop
+	if q.Qtype == dns.TypeCNAME {
+		return answers, last, len(hop) > 0, exists, nil
+	}
+
+	seen := []string{last}
+	for {
+		cname := hopCname(hop)
+		if cname == nil {
+			break
+		}
+		// names outside the hosted zones are left for the client to follow
+		target := strings.ToLower(dns.Fqdn(cname.Target))
+		_, err := r.zoneForName(ctx, target)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, last, false, false, err
+		}
+		// names below a zone cut are left for the client to follow
+		cut, err := r.zoneCut(ctx, target)
+		if err != nil {
+			return nil, last, false, false, err
+		}
+		if len(cut) > 0 {
+			break
+		}
+		if slices.Contains(seen, target) {
+			return nil, last, false, false, fmt.Errorf("CNAME loop detected: %s", strings.Join(append(seen, target), " -> "))
+		}
+		if len(seen) > maxCnameChain {
+			// leave the rest of the chain for the client to follow
+			break
+		}
+		seen = append(seen, target)
+		last = target
+
+		hop, exists, err = r.answerName(ctx, dns.Question{Name: cname.Target, Qtype: q.Qtype, Qclass: q.Qclass}, addr)
+		if err != nil {
+			return nil, last, false, false, err
+		}
+		answers = append(answers, hop...)
+	}
+	return answers, last, len(hop) > 0, exists, nil
+}
+
+// hopCname returns the CNAME at the end of the answers for a name in a chain,
+// this is a single CNAME record or a CNAME synthesised from a DNAME record
+func hopCname(hop []*models.Record) *models.CNAME {
+	switch {
+	case len(hop) == 1 && hop[0].Type == dns.TypeCNAME:
+	case len(hop) == 2 && hop[0].Type == dns.TypeDNAME && hop[1].Type == dns.TypeCNAME:
+	default:
+		return nil
+	}
+	cname, _ := hop[len(hop)-1].Value.(*models.CNAME)
+	return cname
+}
+
+// answerName answers the question for a single name, answers for names which
+// don't exist are synthesised from the wildcard at the closest encloser, the
+// records are renamed to the question name and exists is false if the name
+// does not exist
+func (r *Resolver) answerName(ctx context.Context, q dns.Question, addr net.Addr) (answers []*models.Record, exists bool, err error) {
+	aChan, eChan := r.AnswerQuestion(ctx, q, addr)
+	answers, errs := gatherFromChannels(aChan, eChan)
+	if len(errs) > 0 {
+		return nil, false, errors.Join(errs...)
+	}
+
+	// a name without answers may still exist with other types or as an empty
+	// non-terminal, which must be answered with NODATA instead of NXDOMAIN
+	name := strings.ToLower(q.Name)
+	exists = len(answers) > 0
+	if !exists {
+		exists, err = r.nameExists(ctx, name)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// names below a DNAME record are answered with a synthesised CNAME
+	if !exists {
+		dname, err := r.synthesiseDname(ctx, q.Name)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(dname) > 0 {
+			return dname, true, nil
+		}
+	}
+
+	// wildcards never match names which exist
+	if !exists {
+		wildcard, err := r.closestWildcard(ctx, name)
+		if err != nil {
+			return nil, false, err
+		}
+		if wildcard != "" {
+			exists = true
+			aChan, eChan = r.AnswerQuestion(ctx, dns.Question{Name: wildcard, Qtype: q.Qtype, Qclass: q.Qclass}, addr)
+			answers, errs = gatherFromChannels(aChan, eChan)
+			if len(errs) > 0 {
+				return nil, false, errors.Join(errs...)
+			}
+		}
+	}
+
+	for _, record := range answers {
+		record.Name = q.Name
+	}
+	return answers, exists, nil
+}
+
 func gatherFromChannels(rrsIn chan *models.Record, errsIn chan error) (rrs []*models.Record, errs []error) {
 	rrs = []*models.Record{}
 	errs = []error{}
@@ -165,7 +363,7 @@ func (r *Resolver) AnswerQuestion(ctx context.Context, q dns.Question, addr net.
 	answers = make(chan *models.Record)
 	errors = make(chan error)
 
-	typeStr := dns.TypeToString[q.Qtype]
+	typeStr := models.TypeToString(q.Qtype)
 	typeCounter := metrics.GetOrRegisterCounter("resolver.answers.type."+typeStr, metrics.DefaultRegistry)
 	typeCounter.Inc(1)
 	questionCounter := metrics.GetOrRegisterCounter("resolver.answers.question."+typeStr+"."+q.Name, metrics.DefaultRegistry)
@@ -173,7 +371,8 @@ func (r *Resolver) AnswerQuestion(ctx context.Context, q dns.Question, addr net.
 
 	logger.Logger.Debug("Answering question ", "q", q)
 
-	if _, ok := converters.Converters[q.Qtype]; ok {
+	// SOA and DNSSEC records are generated instead of using a converter
+	if _, ok := converters.Converters[q.Qtype]; ok || isGeneratedType(q.Qtype) || converters.IsGeneric(q.Qtype) {
 		go func() {
 			defer func() {
 				close(answers)
@@ -213,12 +412,38 @@ func (r *Resolver) AnswerQuestion(ctx context.Context, q dns.Question, addr net.
 func (r *Resolver) LookupAnswersForType(ctx context.Context, name string, rrType uint16, addr net.Addr) (answers []*models.Record, err error) {
 	name = strings.ToLower(name)
 
+	zone, err := r.zoneForName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	switch rrType {
 	case dns.TypeSOA:
-		record := r.getSoaRecord(name)
+		// the SOA record only exists at the zone apex
+		if name != zone {
+			return nil, nil
+		}
+		record, err := r.getSoaRecord(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			return nil, nil
+		}
 		return []*models.Record{record}, nil
 	case dns.TypeNS:
-		records := r.getNsRecords(name)
+		// NS records below the zone apex are delegations stored in the database
+		if name != zone {
+			break
+		}
+		zoneRow, err := r.zoneRowForName(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+		records := r.getNsRecords(zoneRow)
 		if len(records) == 0 {
 			return records, nil
 		}
@@ -226,16 +451,21 @@ func (r *Resolver) LookupAnswersForType(ctx context.Context, name string, rrType
 		// randomise which NS record shows first
 		n := rand.IntN(len(records))
 		records[0], records[n] = records[n], records[0]
+		for _, i := range records {
+			i.Ttl = nulls.NewUInt32(zoneRow.DefaultTtl)
+		}
 		return records, nil
+	case dns.TypeDNSKEY, dns.TypeCDNSKEY, dns.TypeCDS, dns.TypeNSEC3PARAM:
+		records, err := r.getDnssecRecords(ctx, name, rrType)
+		if err != nil {
+			return nil, err
+		}
+		return r.withZoneDefaultTtl(ctx, name, records)
 	}
 
-	rootZone, err := publicsuffix.EffectiveTLDPlusOne(strings.TrimSuffix(name, "."))
-	if err != nil {
-		return nil, err
-	}
-	shortName := utils.SimplifyRecordName(name, dns.Fqdn(rootZone))
+	shortName := utils.SimplifyRecordName(name, zone)
 
-	records, err := r.db.LookupRecordsForType(ctx, database.LookupRecordsForTypeParams{Type: dns.TypeToString[rrType], Name: shortName, Name_2: dns.Fqdn(rootZone)})
+	records, err := r.db.LookupRecordsForType(ctx, database.LookupRecordsForTypeParams{Type: models.TypeToString(rrType), Name: shortName, Name_2: zone})
 	if err != nil {
 		return nil, err
 	}
@@ -254,6 +484,13 @@ func (r *Resolver) LookupAnswersForType(ctx context.Context, name string, rrType
 				if err != nil {
 					return nil, err
 				}
+				ttl := record.ZoneDefaultTtl
+				if record.Ttl.Valid {
+					ttl = record.Ttl.UInt32
+				}
+				for _, i := range resolvedRecords {
+					i.Ttl = nulls.NewUInt32(ttl)
+				}
 				rrs = append(rrs, resolvedRecords...)
 			}
 			continue
@@ -263,9 +500,14 @@ func (r *Resolver) LookupAnswersForType(ctx context.Context, name string, rrType
 		if err != nil {
 			return nil, err
 		}
+		rr.Ttl = nulls.NewUInt32(rr.TtlOr(record.ZoneDefaultTtl))
 		rrs = append(rrs, rr)
 	}
 
+	// ALIAS records are only used when there are no address records
+	if len(rrs) == 0 && (rrType == dns.TypeA || rrType == dns.TypeAAAA) {
+		return r.lookupAlias(ctx, name, zone, shortName, rrType, addr)
+	}
 	return rrs, nil
 }
 
@@ -287,8 +529,10 @@ func (r *Resolver) GetAllRecords(ctx context.Context) ([]*models.Record, error)
 	return rrs, nil
 }
 
+// GetZoneRecords returns every record in the zone including the generated SOA
+// and NS records, records without a TTL are given the zone default TTL
 func (r *Resolver) GetZoneRecords(ctx context.Context, zone string) ([]*models.Record, error) {
-	_, err := r.db.GetZone(ctx, zone)
+	zoneRow, err := r.db.GetZone(ctx, zone)
 	if err != nil {
 		return nil, err
 	}
@@ -298,65 +542,141 @@ func (r *Resolver) GetZoneRecords(ctx context.Context, zone string) ([]*models.R
 		return nil, err
 	}
 
-	rrs := make([]*models.Record, 0, len(records)+1+len(r.soa.Ns)) // preallocate for all records
-	rrs = append(rrs, r.getSoaRecord(zone))
-	rrs = append(rrs, r.getNsRecords(zone)...)
+	soa := r.soaRecord(zoneRow)
+	nsRecords := r.getNsRecords(zoneRow)
+	rrs := make([]*models.Record, 0, len(records)+1+len(nsRecords)) // preallocate for all records
+	rrs = append(rrs, soa)
+	rrs = append(rrs, nsRecords...)
 
 	for _, i := range records {
-		if i.IsLocationResolving() {
-			name := utils.ResolveRecordName(i.Name, zone)
-			rrs = append(rrs, &models.Record{
-				Id:   models.DynamicRecords,
-				Name: "_loc_res." + name,
-				Type: dns.TypeTXT,
-				Value: &models.TXT{
-					Value: i.Value,
-				},
-			})
-			continue
-		}
-		rr, err := i.ConvertRecord(zone)
+		rr, err := convertZoneRecord(i, zone)
 		if err != nil {
 			return nil, err
 		}
 		rrs = append(rrs, rr)
 	}
 
+	for _, i := range rrs {
+		i.Ttl = nulls.NewUInt32(i.TtlOr(zoneRow.DefaultTtl))
+	}
 	return rrs, nil
 }
 
-func (r *Resolver) getSoaRecord(zone string) *models.Record {
-	n := time.Now()
-	year, month, day := n.Date()
-	n2 := uint32(year*1e6 + int(month*1e4) + day*1e2 + 01)
+// withZoneDefaultTtl sets the TTL of the generated records to the default TTL
+// of the zone containing the name
+func (r *Resolver) withZoneDefaultTtl(ctx context.Context, name string, records []*models.Record) ([]*models.Record, error) {
+	if len(records) == 0 {
+		return records, nil
+	}
+	defaultTtl := uint32(models.DefaultTtl)
+	zoneRow, err := r.zoneRowForName(ctx, name)
+	switch {
+	case err == nil:
+		defaultTtl = zoneRow.DefaultTtl
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+	for _, i := range records {
+		i.Ttl = nulls.NewUInt32(i.TtlOr(defaultTtl))
+	}
+	return records, nil
+}
+
+// convertZoneRecord converts a database record for a zone listing, location
+// resolving records are represented as TXT records
+func convertZoneRecord(record database.Record, zone string) (*models.Record, error) {
+	if record.IsLocationResolving() {
+		name := utils.ResolveRecordName(record.Name, zone)
+		return &models.Record{
+			Id:   models.DynamicRecords,
+			Name: "_loc_res." + name,
+			Type: dns.TypeTXT,
+			Value: &models.TXT{
+				Value: record.Value,
+			},
+		}, nil
+	}
+	return record.ConvertRecord(zone)
+}
 
-	rootZone, err := publicsuffix.EffectiveTLDPlusOne(strings.TrimSuffix(zone, "."))
+// getSoaRecord returns the SOA record for the zone containing the name, or nil
+// if the zone is not found
+func (r *Resolver) getSoaRecord(ctx context.Context, name string) (*models.Record, error) {
+	zoneRow, err := r.zoneRowForName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
 	if err != nil {
-		return nil
+		return nil, err
 	}
+	return r.soaRecord(zoneRow), nil
+}
 
+// soaRecord returns the SOA record generated from the zone settings
+func (r *Resolver) soaRecord(zoneRow database.Zone) *models.Record {
+	soa := r.ZoneSoa(zoneRow)
 	return &models.Record{
 		Id:   models.StaticSoaRecord,
-		Name: dns.Fqdn(rootZone),
+		Name: zoneRow.Name,
 		Type: dns.TypeSOA,
+		Ttl:  nulls.NewUInt32(zoneRow.DefaultTtl),
 		Value: &models.SOA{
-			Ns:      dns.Fqdn(r.soa.Ns[0]),
-			Mbox:    dns.Fqdn(r.soa.Mbox),
-			Serial:  n2,
-			Refresh: r.soa.Refresh,
-			Retry:   r.soa.Retry,
-			Expire:  r.soa.Expire,
-			Minttl:  r.soa.Ttl,
+			Ns:      dns.Fqdn(soa.Ns[0]),
+			Mbox:    dns.Fqdn(soa.Mbox),
+			Serial:  zoneRow.Serial,
+			Refresh: soa.Refresh,
+			Retry:   soa.Retry,
+			Expire:  soa.Expire,
+			Minttl:  soa.Ttl,
 		},
 	}
 }
 
-func (r *Resolver) getNsRecords(zone string) []*models.Record {
-	rrs := make([]*models.Record, 0, len(r.soa.Ns))
-	for _, ns := range r.soa.Ns {
+// ZoneSoa returns the SOA settings for the zone, settings which are not set for
+// the zone use the values from the config
+func (r *Resolver) ZoneSoa(zoneRow database.Zone) conf.SoaConf {
+	soa := r.soa
+	if zoneRow.Nameservers.Valid {
+		if ns := strings.Fields(zoneRow.Nameservers.String); len(ns) > 0 {
+			soa.Ns = ns
+		}
+	}
+	if zoneRow.Mbox.Valid {
+		soa.Mbox = zoneRow.Mbox.String
+	}
+	if zoneRow.Refresh.Valid {
+		soa.Refresh = zoneRow.Refresh.UInt32
+	}
+	if zoneRow.Retry.Valid {
+		soa.Retry = zoneRow.Retry.UInt32
+	}
+	if zoneRow.Expire.Valid {
+		soa.Expire = zoneRow.Expire.UInt32
+	}
+	if zoneRow.Minimum.Valid {
+		soa.Ttl = zoneRow.Minimum.UInt32
+	}
+	return soa
+}
+
+// negativeTtl returns the TTL for NSEC3 records in the zone, RFC 9077 uses the
+// lower of the SOA TTL and the SOA minimum field
+func (r *Resolver) negativeTtl(ctx context.Context, zone string) (uint32, error) {
+	zoneRow, err := r.zoneRowForName(ctx, zone)
+	if err != nil {
+		return 0, err
+	}
+	return min(zoneRow.DefaultTtl, r.ZoneSoa(zoneRow).Ttl), nil
+}
+
+// getNsRecords returns the NS records at the zone apex
+func (r *Resolver) getNsRecords(zoneRow database.Zone) []*models.Record {
+	nameservers := r.ZoneSoa(zoneRow).Ns
+	rrs := make([]*models.Record, 0, len(nameservers))
+	for _, ns := range nameservers {
 		rrs = append(rrs, &models.Record{
 			Id:   models.StaticNsRecord,
-			Name: zone,
+			Name: zoneRow.Name,
 			Type: dns.TypeNS,
 			Value: &models.NS{
 				Ns: dns.Fqdn(ns),
@@ -365,3 +685,86 @@ func (r *Resolver) getNsRecords(zone string) []*models.Record {
 	}
 	return rrs
 }
+
+// nameExists returns true if the name has records of any type or is an empty
+// non-terminal with records below it
+func (r *Resolver) nameExists(ctx context.Context, name string) (bool, error) {
+	zone, err := r.zoneForName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if name == zone {
+		return true, nil
+	}
+	shortName := utils.SimplifyRecordName(name, zone)
+	types, err := r.db.LookupRecordTypes(ctx, database.LookupRecordTypesParams{Name: shortName, Name_2: zone})
+	if err != nil {
+		return false, err
+	}
+	if len(types) > 0 {
+		return true, nil
+	}
+	count, err := r.db.CountRecordsBelowName(ctx, database.CountRecordsBelowNameParams{Suffix: "." + shortName, Zone: zone})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// closestWildcard returns the wildcard name at the closest encloser of the name
+// as described in RFC 4592, an empty string is returned if the wildcard does not
+// exist, the search never leaves the zone containing the name
+func (r *Resolver) closestWildcard(ctx context.Context, name string) (string, error) {
+	zone, err := r.zoneForName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// the closest encloser is the longest existing ancestor of the name
+	encloser := name
+	for encloser != zone {
+		_, encloser, _ = strings.Cut(encloser, ".")
+		exists, err := r.nameExists(ctx, encloser)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			break
+		}
+	}
+
+	wildcard := "*." + encloser
+	exists, err := r.nameExists(ctx, wildcard)
+	if err != nil || !exists {
+		return "", err
+	}
+	return wildcard, nil
+}
+
+// zoneForName returns the name of the hosted zone which contains the name, this
+// is the zone with the longest matching name so child zones can be hosted
+// separately from the parent, sql.ErrNoRows is returned if no hosted zone
+// contains the name
+func (r *Resolver) zoneForName(ctx context.Context, name string) (string, error) {
+	zone, err := r.zoneRowForName(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return zone.Name, nil
+}
+
+// isGeneratedType returns true for record types which are generated by the
+// resolver instead of being stored in the database
+func isGeneratedType(rrType uint16) bool {
+	switch rrType {
+	case dns.TypeSOA, dns.TypeDNSKEY, dns.TypeCDNSKEY, dns.TypeCDS, dns.TypeNSEC3PARAM:
+		return true
+	}
+	return false
+}
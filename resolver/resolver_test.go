@@ -0,0 +1,530 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/secondary"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestResolver creates a resolver serving example.com. with the records
+// from an in-memory store
+func newTestResolver(t *testing.T, records ...string) *Resolver {
+	t.Helper()
+	soa, err := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 300")
+	assert.NoError(t, err)
+	rrs := make([]dns.RR, 0, len(records))
+	for _, i := range records {
+		rr, err := dns.NewRR(i)
+		assert.NoError(t, err)
+		rrs = append(rrs, rr)
+	}
+	store := secondary.NewStore()
+	store.Set(secondary.NewZone("example.com.", soa.(*dns.SOA), rrs))
+	return NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}, Mbox: "hostmaster.example.com."}, store, nil, nil)
+}
+
+func testLookup(res *Resolver, name string, qtype uint16) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	return res.Lookup(context.Background(), req, nil)
+}
+
+// rrStrings returns the records in presentation format
+func rrStrings(rrs []dns.RR) []string {
+	var out []string
+	for _, rr := range rrs {
+		out = append(out, rr.String())
+	}
+	return out
+}
+
+// sortedRRStrings returns the records in presentation format sorted so sections
+// in a random order can be compared
+func sortedRRStrings(rrs []dns.RR) []string {
+	out := rrStrings(rrs)
+	slices.Sort(out)
+	return out
+}
+
+func TestResolver_Lookup_nodata(t *testing.T) {
+	res := newTestResolver(t,
+		"www.example.com. 300 IN A 10.0.0.1",
+		"a.b.example.com. 300 IN A 10.0.0.2",
+		"_sip._tcp.example.com. 300 IN SRV 10 10 5060 sip.example.com.",
+	)
+
+	tests := []struct {
+		name  string
+		qtype uint16
+		rcode int
+	}{
+		{"www.example.com.", dns.TypeA, dns.RcodeSuccess},
+		{"www.example.com.", dns.TypeAAAA, dns.RcodeSuccess},
+		{"a.b.example.com.", dns.TypeTXT, dns.RcodeSuccess},
+		{"b.example.com.", dns.TypeA, dns.RcodeSuccess},
+		{"_tcp.example.com.", dns.TypeSRV, dns.RcodeSuccess},
+		{"example.com.", dns.TypeMX, dns.RcodeSuccess},
+		{"missing.example.com.", dns.TypeA, dns.RcodeNameError},
+		{"c.b.example.com.", dns.TypeA, dns.RcodeNameError},
+		{"ab.example.com.", dns.TypeA, dns.RcodeNameError},
+	}
+	for _, i := range tests {
+		t.Run(i.name+" "+dns.TypeToString[i.qtype], func(t *testing.T) {
+			msg := testLookup(res, i.name, i.qtype)
+			assert.Equal(t, i.rcode, msg.Rcode)
+			if len(msg.Answer) == 0 {
+				assert.Len(t, msg.Ns, 1)
+				assert.Equal(t, dns.TypeSOA, msg.Ns[0].Header().Rrtype)
+			}
+		})
+	}
+}
+
+func TestResolver_Lookup_wildcard(t *testing.T) {
+	res := newTestResolver(t,
+		"*.example.com. 300 IN A 10.0.0.1",
+		"*.example.com. 300 IN TXT \"wildcard\"",
+		"www.example.com. 300 IN AAAA fd00::1",
+		"a.b.example.com. 300 IN A 10.0.0.2",
+		"*.c.example.com. 300 IN CNAME www.example.com.",
+		"sub.c.example.com. 300 IN A 10.0.0.3",
+	)
+
+	tests := []struct {
+		name   string
+		qtype  uint16
+		rcode  int
+		answer string
+	}{
+		{"host.example.com.", dns.TypeA, dns.RcodeSuccess, "host.example.com.\t300\tIN\tA\t10.0.0.1"},
+		{"deep.host.example.com.", dns.TypeA, dns.RcodeSuccess, "deep.host.example.com.\t300\tIN\tA\t10.0.0.1"},
+		{"host.example.com.", dns.TypeTXT, dns.RcodeSuccess, "host.example.com.\t300\tIN\tTXT\t\"wildcard\""},
+		{"host.example.com.", dns.TypeMX, dns.RcodeSuccess, ""},
+
+		// existing names and empty non-terminals block the wildcard
+		{"www.example.com.", dns.TypeA, dns.RcodeSuccess, ""},
+		{"b.example.com.", dns.TypeA, dns.RcodeSuccess, ""},
+		{"x.b.example.com.", dns.TypeA, dns.RcodeNameError, ""},
+
+		// CNAME wildcards match every type at the closest encloser
+		{"host.c.example.com.", dns.TypeA, dns.RcodeSuccess, "host.c.example.com.\t300\tIN\tCNAME\twww.example.com."},
+		{"host.c.example.com.", dns.TypeCNAME, dns.RcodeSuccess, "host.c.example.com.\t300\tIN\tCNAME\twww.example.com."},
+		{"sub.c.example.com.", dns.TypeA, dns.RcodeSuccess, "sub.c.example.com.\t300\tIN\tA\t10.0.0.3"},
+		{"sub.c.example.com.", dns.TypeTXT, dns.RcodeSuccess, ""},
+	}
+	for _, i := range tests {
+		t.Run(i.name+" "+dns.TypeToString[i.qtype], func(t *testing.T) {
+			msg := testLookup(res, i.name, i.qtype)
+			assert.Equal(t, i.rcode, msg.Rcode)
+			if i.answer == "" {
+				assert.Empty(t, msg.Answer)
+				return
+			}
+			assert.Len(t, msg.Answer, 1)
+			assert.Equal(t, i.answer, msg.Answer[0].String())
+		})
+	}
+}
+
+func TestResolver_Lookup_wildcardOutsideZone(t *testing.T) {
+	res := newTestResolver(t, "*.example.com. 300 IN A 10.0.0.1")
+
+	// wildcards are never searched for above the zone apex
+	msg := testLookup(res, "host.example.org.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, msg.Rcode)
+	assert.Empty(t, msg.Answer)
+}
+
+func TestResolver_Lookup_additional(t *testing.T) {
+	res := newTestResolver(t,
+		"example.com. 300 IN MX 10 mail.example.com.",
+		"example.com. 300 IN MX 20 mail.example.org.",
+		"mail.example.com. 300 IN A 10.0.0.1",
+		"mail.example.com. 300 IN AAAA fd00::1",
+		"_sip._tcp.example.com. 300 IN SRV 10 10 5060 sip.example.com.",
+		"sip.example.com. 300 IN A 10.0.0.2",
+		"ns1.example.com. 300 IN A 10.0.0.53",
+	)
+
+	msg := testLookup(res, "example.com.", dns.TypeMX)
+	assert.Len(t, msg.Answer, 2)
+	assert.Equal(t, []string{
+		"mail.example.com.\t300\tIN\tA\t10.0.0.1",
+		"mail.example.com.\t300\tIN\tAAAA\tfd00::1",
+	}, rrStrings(msg.Extra))
+
+	msg = testLookup(res, "_sip._tcp.example.com.", dns.TypeSRV)
+	assert.Equal(t, []string{"sip.example.com.\t300\tIN\tA\t10.0.0.2"}, rrStrings(msg.Extra))
+
+	// glue for the configured nameservers
+	msg = testLookup(res, "example.com.", dns.TypeNS)
+	assert.Equal(t, []string{"ns1.example.com.\t300\tIN\tA\t10.0.0.53"}, rrStrings(msg.Extra))
+
+	// other types have no additional records
+	msg = testLookup(res, "mail.example.com.", dns.TypeA)
+	assert.Empty(t, msg.Extra)
+}
+
+func TestAdditionalTargets(t *testing.T) {
+	mx, _ := dns.NewRR("example.com. 300 IN MX 10 Mail.Example.com.")
+	mx2, _ := dns.NewRR("example.com. 300 IN MX 20 mail.example.com.")
+	nullMx, _ := dns.NewRR("example.org. 300 IN MX 0 .")
+	a, _ := dns.NewRR("example.com. 300 IN A 10.0.0.1")
+	assert.Equal(t, []string{"mail.example.com."}, additionalTargets([]dns.RR{mx, mx2, nullMx, a}))
+
+	// a ServiceMode target of "." is the owner name
+	https, _ := dns.NewRR("www.example.com. 300 IN HTTPS 1 . alpn=h2")
+	svcb, _ := dns.NewRR("_dns.example.com. 300 IN SVCB 1 dns.example.com. alpn=dot")
+	assert.Equal(t, []string{"www.example.com.", "dns.example.com."}, additionalTargets([]dns.RR{https, svcb}))
+}
+
+func TestResolver_Lookup_httpsAliasMode(t *testing.T) {
+	res := newTestResolver(t,
+		"example.com. 300 IN HTTPS 0 cdn.example.net.",
+		"www.example.com. 300 IN HTTPS 1 . alpn=h2,h3 ipv4hint=10.0.0.1",
+		"www.example.com. 300 IN A 10.0.0.1",
+	)
+
+	msg := testLookup(res, "example.com.", dns.TypeHTTPS)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 1)
+	assert.Equal(t, "example.com.\t300\tIN\tHTTPS\t0 cdn.example.net.", msg.Answer[0].String())
+	assert.Empty(t, msg.Extra)
+
+	msg = testLookup(res, "www.example.com.", dns.TypeHTTPS)
+	assert.Len(t, msg.Answer, 1)
+	assert.Equal(t, []string{"www.example.com.\t300\tIN\tA\t10.0.0.1"}, []string{msg.Extra[0].String()})
+}
+
+func TestResolver_Lookup_cnameChain(t *testing.T) {
+	res := newTestResolver(t,
+		"www.example.com. 300 IN CNAME web.example.com.",
+		"web.example.com. 300 IN CNAME host.example.com.",
+		"host.example.com. 300 IN A 10.0.0.1",
+		"ext.example.com. 300 IN CNAME www.example.org.",
+		"dangling.example.com. 300 IN CNAME missing.example.com.",
+		"loop1.example.com. 300 IN CNAME loop2.example.com.",
+		"loop2.example.com. 300 IN CNAME loop1.example.com.",
+		"*.wild.example.com. 300 IN CNAME host.example.com.",
+	)
+
+	msg := testLookup(res, "www.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Equal(t, []string{
+		"www.example.com.\t300\tIN\tCNAME\tweb.example.com.",
+		"web.example.com.\t300\tIN\tCNAME\thost.example.com.",
+		"host.example.com.\t300\tIN\tA\t10.0.0.1",
+	}, rrStrings(msg.Answer))
+
+	// CNAME queries are not followed
+	msg = testLookup(res, "www.example.com.", dns.TypeCNAME)
+	assert.Equal(t, []string{"www.example.com.\t300\tIN\tCNAME\tweb.example.com."}, rrStrings(msg.Answer))
+
+	// wildcard CNAME records are followed
+	msg = testLookup(res, "a.wild.example.com.", dns.TypeA)
+	assert.Equal(t, []string{
+		"a.wild.example.com.\t300\tIN\tCNAME\thost.example.com.",
+		"host.example.com.\t300\tIN\tA\t10.0.0.1",
+	}, rrStrings(msg.Answer))
+
+	// targets outside the zone are left for the client
+	msg = testLookup(res, "ext.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Equal(t, []string{"ext.example.com.\t300\tIN\tCNAME\twww.example.org."}, rrStrings(msg.Answer))
+	assert.Empty(t, msg.Ns)
+
+	// the rcode is for the last name in the chain
+	msg = testLookup(res, "dangling.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, msg.Rcode)
+	assert.Equal(t, []string{"dangling.example.com.\t300\tIN\tCNAME\tmissing.example.com."}, rrStrings(msg.Answer))
+	assert.Len(t, msg.Ns, 1)
+	msg = testLookup(res, "www.example.com.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 2)
+	assert.Len(t, msg.Ns, 1)
+
+	// loops are a server failure
+	msg = testLookup(res, "loop1.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeServerFailure, msg.Rcode)
+	assert.Empty(t, msg.Answer)
+}
+
+func TestResolver_Lookup_cnameChainZones(t *testing.T) {
+	comSoa, _ := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 300")
+	orgSoa, _ := dns.NewRR("example.org. 300 IN SOA ns1.example.com. hostmaster.example.com. 2 300 300 300 300")
+	var com, org []dns.RR
+	for _, i := range []string{
+		"www.example.com. 300 IN CNAME www.example.org.",
+		"dangling.example.com. 300 IN CNAME missing.example.org.",
+		"loop.example.com. 300 IN CNAME loop.example.org.",
+	} {
+		rr, _ := dns.NewRR(i)
+		com = append(com, rr)
+	}
+	for _, i := range []string{
+		"www.example.org. 300 IN A 10.0.0.1",
+		"loop.example.org. 300 IN CNAME loop.example.com.",
+	} {
+		rr, _ := dns.NewRR(i)
+		org = append(org, rr)
+	}
+	store := secondary.NewStore()
+	store.Set(secondary.NewZone("example.com.", comSoa.(*dns.SOA), com))
+	store.Set(secondary.NewZone("example.org.", orgSoa.(*dns.SOA), org))
+	res := NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}, Mbox: "hostmaster.example.com."}, store, nil, nil)
+
+	// chains are followed into other hosted zones
+	msg := testLookup(res, "www.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Equal(t, []string{
+		"www.example.com.\t300\tIN\tCNAME\twww.example.org.",
+		"www.example.org.\t300\tIN\tA\t10.0.0.1",
+	}, rrStrings(msg.Answer))
+
+	// the rcode and SOA record are from the zone of the last name
+	msg = testLookup(res, "dangling.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, msg.Rcode)
+	assert.Len(t, msg.Ns, 1)
+	assert.Equal(t, "example.org.", msg.Ns[0].Header().Name)
+	assert.Equal(t, uint32(2), msg.Ns[0].(*dns.SOA).Serial)
+
+	// loops through several zones are a server failure
+	msg = testLookup(res, "loop.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeServerFailure, msg.Rcode)
+}
+
+func TestResolver_Lookup_cnameChainLimit(t *testing.T) {
+	var records []string
+	for i := 0; i < maxCnameChain+4; i++ {
+		records = append(records, fmt.Sprintf("c%d.example.com. 300 IN CNAME c%d.example.com.", i, i+1))
+	}
+	res := newTestResolver(t, records...)
+
+	msg := testLookup(res, "c0.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, maxCnameChain+1)
+}
+
+func TestResolver_Lookup_alias(t *testing.T) {
+	res := newTestResolver(t,
+		"example.com. 300 IN ALIAS www.example.com.",
+		"www.example.com. 60 IN A 10.0.0.1",
+		"cdn.example.com. 300 IN ALIAS cdn.example.net.",
+		"loop.example.com. 300 IN ALIAS loop.example.com.",
+	)
+
+	// stub upstream resolver for targets outside the hosted zones
+	var queries atomic.Int32
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		queries.Add(1)
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+		if req.Question[0].Qtype == dns.TypeA {
+			cname, _ := dns.NewRR("cdn.example.net. 600 IN CNAME edge.example.net.")
+			a, _ := dns.NewRR("edge.example.net. 120 IN A 192.0.2.1")
+			msg.Answer = []dns.RR{cname, a}
+		}
+		_ = w.WriteMsg(msg)
+	})}
+	go func() { _ = srv.ActivateAndServe() }()
+	defer srv.Shutdown()
+	res.alias = NewAliasResolver(pc.LocalAddr().String())
+
+	// targets inside the hosted zones are resolved internally
+	msg := testLookup(res, "example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 1)
+	assert.Equal(t, "example.com.\t60\tIN\tA\t10.0.0.1", msg.Answer[0].String())
+	msg = testLookup(res, "example.com.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Empty(t, msg.Answer)
+
+	// other targets use the upstream resolver and are cached
+	msg = testLookup(res, "cdn.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 1)
+	assert.Equal(t, "cdn.example.com.\t120\tIN\tA\t192.0.2.1", msg.Answer[0].String())
+	msg = testLookup(res, "cdn.example.com.", dns.TypeA)
+	assert.Len(t, msg.Answer, 1)
+	assert.Equal(t, int32(1), queries.Load())
+
+	// loops are a server failure
+	msg = testLookup(res, "loop.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeServerFailure, msg.Rcode)
+
+	// without an upstream resolver external targets fail
+	res.alias = nil
+	msg = testLookup(res, "cdn.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeServerFailure, msg.Rcode)
+}
+
+func TestResolver_Lookup_dname(t *testing.T) {
+	res := newTestResolver(t,
+		"old.example.com. 300 IN DNAME new.example.com.",
+		"www.new.example.com. 300 IN A 10.0.0.1",
+		"ext.example.com. 300 IN DNAME example.net.",
+	)
+
+	msg := testLookup(res, "www.old.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Equal(t, []string{
+		"old.example.com.\t300\tIN\tDNAME\tnew.example.com.",
+		"www.old.example.com.\t300\tIN\tCNAME\twww.new.example.com.",
+		"www.new.example.com.\t300\tIN\tA\t10.0.0.1",
+	}, rrStrings(msg.Answer))
+
+	// the synthesised target may not exist
+	msg = testLookup(res, "missing.old.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, msg.Rcode)
+	assert.Len(t, msg.Answer, 2)
+
+	// targets outside the zone are left for the client
+	msg = testLookup(res, "a.b.ext.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Equal(t, []string{
+		"ext.example.com.\t300\tIN\tDNAME\texample.net.",
+		"a.b.ext.example.com.\t300\tIN\tCNAME\ta.b.example.net.",
+	}, rrStrings(msg.Answer))
+
+	// the owner name is not redirected
+	msg = testLookup(res, "old.example.com.", dns.TypeDNAME)
+	assert.Equal(t, []string{"old.example.com.\t300\tIN\tDNAME\tnew.example.com."}, rrStrings(msg.Answer))
+	msg = testLookup(res, "old.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Empty(t, msg.Answer)
+}
+
+func TestResolver_Lookup_generic(t *testing.T) {
+	res := newTestResolver(t,
+		"example.com. 300 IN TYPE65000 \\# 4 0a000001",
+		"host.example.com. 300 IN HINFO \"PC\" \"Linux\"",
+	)
+
+	msg := testLookup(res, "example.com.", 65000)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 1)
+	assert.Equal(t, "example.com.\t300\tCLASS1\tTYPE65000\t\\# 4 0a000001", msg.Answer[0].String())
+
+	// known types without a model are served unchanged
+	msg = testLookup(res, "host.example.com.", dns.TypeHINFO)
+	assert.Len(t, msg.Answer, 1)
+	buf, err := msg.Pack()
+	assert.NoError(t, err)
+	wire := new(dns.Msg)
+	assert.NoError(t, wire.Unpack(buf))
+	assert.Equal(t, "host.example.com.\t300\tIN\tHINFO\t\"PC\" \"Linux\"", wire.Answer[0].String())
+}
+
+func TestResolver_Lookup_delegation(t *testing.T) {
+	res := newTestResolver(t,
+		"dev.example.com. 300 IN NS ns1.dev.example.com.",
+		"dev.example.com. 300 IN NS ns1.example.net.",
+		"dev.example.com. 300 IN DS 12345 13 2 ABCD",
+		"ns1.dev.example.com. 300 IN A 10.0.0.53",
+		"www.dev.example.com. 300 IN A 10.0.0.1",
+		"dev.example.com. 300 IN A 10.0.0.2",
+		"app.example.com. 300 IN CNAME www.dev.example.com.",
+	)
+
+	// names at and below the zone cut get a referral
+	for _, i := range []struct {
+		name  string
+		qtype uint16
+	}{{"dev.example.com.", dns.TypeA}, {"dev.example.com.", dns.TypeNS}, {"www.dev.example.com.", dns.TypeA}, {"missing.dev.example.com.", dns.TypeTXT}} {
+		msg := testLookup(res, i.name, i.qtype)
+		assert.Equal(t, dns.RcodeSuccess, msg.Rcode, i.name)
+		assert.False(t, msg.Authoritative, i.name)
+		assert.Empty(t, msg.Answer, i.name)
+		assert.Equal(t, []string{
+			"dev.example.com.\t300\tIN\tNS\tns1.dev.example.com.",
+			"dev.example.com.\t300\tIN\tNS\tns1.example.net.",
+		}, sortedRRStrings(msg.Ns), i.name)
+		assert.Equal(t, []string{"ns1.dev.example.com.\t300\tIN\tA\t10.0.0.53"}, sortedRRStrings(msg.Extra), i.name)
+	}
+
+	// the parent zone is authoritative for the DS records
+	msg := testLookup(res, "dev.example.com.", dns.TypeDS)
+	assert.True(t, msg.Authoritative)
+	assert.Len(t, msg.Answer, 1)
+
+	// CNAME chains stop at the zone cut
+	msg = testLookup(res, "app.example.com.", dns.TypeA)
+	assert.True(t, msg.Authoritative)
+	assert.Equal(t, []string{"app.example.com.\t300\tIN\tCNAME\twww.dev.example.com."}, sortedRRStrings(msg.Answer))
+
+	// the apex still uses the configured nameservers
+	msg = testLookup(res, "example.com.", dns.TypeNS)
+	assert.True(t, msg.Authoritative)
+	assert.Equal(t, []string{"example.com.\t300\tIN\tNS\tns1.example.com."}, sortedRRStrings(msg.Answer))
+}
+
+func TestResolver_Lookup_childZone(t *testing.T) {
+	parentSoa, _ := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 300")
+	childSoa, _ := dns.NewRR("eng.example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 7 300 300 300 300")
+	www, _ := dns.NewRR("www.example.com. 300 IN A 10.0.0.1")
+	childWww, _ := dns.NewRR("www.eng.example.com. 300 IN A 10.0.1.1")
+	store := secondary.NewStore()
+	store.Set(secondary.NewZone("example.com.", parentSoa.(*dns.SOA), []dns.RR{www}))
+	store.Set(secondary.NewZone("eng.example.com.", childSoa.(*dns.SOA), []dns.RR{childWww}))
+	res := NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}, Mbox: "hostmaster.example.com."}, store, nil, nil)
+
+	// the longest matching zone answers
+	msg := testLookup(res, "www.eng.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 1)
+
+	msg = testLookup(res, "missing.eng.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, msg.Rcode)
+	assert.Len(t, msg.Ns, 1)
+	assert.Equal(t, "eng.example.com.", msg.Ns[0].Header().Name)
+	assert.Equal(t, uint32(7), msg.Ns[0].(*dns.SOA).Serial)
+
+	msg = testLookup(res, "eng.example.com.", dns.TypeSOA)
+	assert.Len(t, msg.Answer, 1)
+	assert.Equal(t, "eng.example.com.", msg.Answer[0].Header().Name)
+
+	// SOA and NS records only exist at the zone apex
+	for _, qtype := range []uint16{dns.TypeSOA, dns.TypeNS} {
+		msg = testLookup(res, "www.example.com.", qtype)
+		assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+		assert.Empty(t, msg.Answer)
+		assert.Equal(t, "example.com.", msg.Ns[0].Header().Name)
+	}
+
+	// names outside the hosted zones have no authority
+	msg = testLookup(res, "www.example.net.", dns.TypeA)
+	assert.False(t, msg.Authoritative)
+	assert.Empty(t, msg.Ns)
+}
+
+func TestResolver_Lookup_ZoneSoa(t *testing.T) {
+	res := newTestResolver(t,
+		"example.com. 300 IN NS ns1.customer.example.",
+		"example.com. 300 IN NS ns2.customer.example.",
+	)
+
+	msg := testLookup(res, "example.com.", dns.TypeNS)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	var ns []string
+	for _, rr := range msg.Answer {
+		ns = append(ns, rr.(*dns.NS).Ns)
+	}
+	assert.ElementsMatch(t, []string{"ns1.customer.example.", "ns2.customer.example."}, ns)
+
+	msg = testLookup(res, "example.com.", dns.TypeSOA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	if assert.Len(t, msg.Answer, 1) {
+		soa := msg.Answer[0].(*dns.SOA)
+		assert.Equal(t, "ns1.customer.example.", soa.Ns)
+		assert.Equal(t, uint32(300), soa.Refresh)
+	}
+}
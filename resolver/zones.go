@@ -0,0 +1,58 @@
+package resolver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/1f349/azalea/database"
+	"github.com/miekg/dns"
+	"strings"
+	"sync"
+)
+
+// zoneCacheKey is the context key for the zones found during a single lookup
+type zoneCacheKey struct{}
+
+// zoneCache remembers the zone containing each name during a single lookup,
+// answering a question finds the zone for the same names many times
+type zoneCache struct {
+	mu    sync.Mutex
+	zones map[string]zoneResult
+}
+
+type zoneResult struct {
+	zone database.Zone
+	err  error
+}
+
+// withZoneCache returns a context which caches the zone found for each name,
+// the cache is only used for a single lookup so zone changes are seen by the
+// next lookup
+func withZoneCache(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(zoneCacheKey{}).(*zoneCache); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, zoneCacheKey{}, &zoneCache{zones: make(map[string]zoneResult)})
+}
+
+// zoneRowForName returns the hosted zone containing the name, the result is
+// cached if the context was created by withZoneCache
+func (r *Resolver) zoneRowForName(ctx context.Context, name string) (database.Zone, error) {
+	name = strings.ToLower(dns.Fqdn(name))
+	cache, ok := ctx.Value(zoneCacheKey{}).(*zoneCache)
+	if !ok {
+		return r.db.GetZoneForName(ctx, name)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if result, ok := cache.zones[name]; ok {
+		return result.zone, result.err
+	}
+	zone, err := r.db.GetZoneForName(ctx, name)
+	// other errors are not cached so they can be retried
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		cache.zones[name] = zoneResult{zone: zone, err: err}
+	}
+	return zone, err
+}
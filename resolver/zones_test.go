@@ -0,0 +1,111 @@
+package resolver
+
+import (
+	"context"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/secondary"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// countingStore counts the zone lookups for each name
+type countingStore struct {
+	*secondary.Store
+	calls       map[string]int
+	getZones    int
+	nsLookups   int
+	delegations int
+}
+
+func (c *countingStore) LookupRecordsForType(ctx context.Context, arg database.LookupRecordsForTypeParams) ([]database.LookupRecordsForTypeRow, error) {
+	if arg.Type == "NS" {
+		c.nsLookups++
+	}
+	return c.Store.LookupRecordsForType(ctx, arg)
+}
+
+func (c *countingStore) CountDelegations(ctx context.Context, name string) (int64, error) {
+	c.delegations++
+	return c.Store.CountDelegations(ctx, name)
+}
+
+func (c *countingStore) GetZone(ctx context.Context, name string) (database.Zone, error) {
+	c.getZones++
+	return c.Store.GetZone(ctx, name)
+}
+
+func (c *countingStore) GetZoneForName(ctx context.Context, name string) (database.Zone, error) {
+	c.calls[name]++
+	return c.Store.GetZoneForName(ctx, name)
+}
+
+func TestResolver_Lookup_zoneCache(t *testing.T) {
+	soa, err := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 300")
+	assert.NoError(t, err)
+	var rrs []dns.RR
+	for _, i := range []string{
+		"www.example.com. 300 IN CNAME web.example.com.",
+		"web.example.com. 300 IN A 10.0.0.1",
+	} {
+		rr, err := dns.NewRR(i)
+		assert.NoError(t, err)
+		rrs = append(rrs, rr)
+	}
+	store := &countingStore{Store: secondary.NewStore(), calls: make(map[string]int)}
+	store.Set(secondary.NewZone("example.com.", soa.(*dns.SOA), rrs))
+	res := NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}, Mbox: "hostmaster.example.com."}, store, nil, nil)
+
+	msg := testLookup(res, "www.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 2)
+
+	// each name is only looked up once during a query
+	assert.NotEmpty(t, store.calls)
+	for name, calls := range store.calls {
+		assert.Equal(t, 1, calls, name)
+	}
+
+	// the cache is not shared between queries
+	testLookup(res, "www.example.com.", dns.TypeA)
+	assert.Equal(t, 2, store.calls["www.example.com."])
+
+	// the apex NS records reuse the cached zone
+	msg = testLookup(res, "example.com.", dns.TypeNS)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 1)
+	assert.Equal(t, 1, store.calls["example.com."])
+	assert.Zero(t, store.getZones)
+}
+
+func TestResolver_Lookup_noDelegations(t *testing.T) {
+	soa, err := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 300")
+	assert.NoError(t, err)
+	rr, err := dns.NewRR("www.a.b.c.example.com. 300 IN A 10.0.0.1")
+	assert.NoError(t, err)
+	store := &countingStore{Store: secondary.NewStore(), calls: make(map[string]int)}
+	store.Set(secondary.NewZone("example.com.", soa.(*dns.SOA), []dns.RR{rr}))
+	res := NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}, Mbox: "hostmaster.example.com."}, store, nil, nil)
+
+	// zones without delegations don't look for a zone cut
+	msg := testLookup(res, "www.a.b.c.example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+	assert.Len(t, msg.Answer, 1)
+	testLookup(res, "www.a.b.c.example.com.", dns.TypeA)
+	assert.Zero(t, store.nsLookups)
+	assert.Equal(t, 1, store.delegations)
+
+	// a new serial checks the zone again
+	soa, err = dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 2 300 300 300 300")
+	assert.NoError(t, err)
+	ns, err := dns.NewRR("b.c.example.com. 300 IN NS ns1.example.net.")
+	assert.NoError(t, err)
+	store.Set(secondary.NewZone("example.com.", soa.(*dns.SOA), []dns.RR{rr, ns}))
+	msg = testLookup(res, "www.a.b.c.example.com.", dns.TypeA)
+	assert.False(t, msg.Authoritative)
+	assert.Empty(t, msg.Answer)
+	assert.Equal(t, []string{"b.c.example.com.\t300\tIN\tNS\tns1.example.net."}, rrStrings(msg.Ns))
+	assert.Equal(t, 2, store.delegations)
+	assert.NotZero(t, store.nsLookups)
+}
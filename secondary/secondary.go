@@ -0,0 +1,354 @@
+package secondary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/logger"
+	"github.com/miekg/dns"
+	"github.com/rcrowley/go-metrics"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRetry is used as the retry interval until the first copy of a zone
+// has been transferred
+const defaultRetry = 30 * time.Second
+
+// Secondary keeps the zones in a Store up-to-date by transferring them from the
+// primary nameserver on the SOA refresh, retry and expire timers
+type Secondary struct {
+	primary string
+	dir     string
+	zones   []string
+	store   *Store
+	client  *dns.Client
+
+	triggers  map[string]chan struct{}
+	closeOnce sync.Once
+	stop      chan struct{}
+}
+
+func New(c conf.SecondaryConf, dir string) *Secondary {
+	primary := c.Primary
+	if _, _, err := net.SplitHostPort(primary); err != nil {
+		primary = net.JoinHostPort(primary, "53")
+	}
+	zones := make([]string, 0, len(c.Zones))
+	triggers := make(map[string]chan struct{}, len(c.Zones))
+	for _, zone := range c.Zones {
+		zone = dns.Fqdn(strings.ToLower(zone))
+		zones = append(zones, zone)
+		triggers[zone] = make(chan struct{}, 1)
+	}
+	return &Secondary{
+		primary:  primary,
+		dir:      dir,
+		zones:    zones,
+		store:    NewStore(),
+		client:   &dns.Client{Net: "udp", Timeout: 5 * time.Second},
+		triggers: triggers,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Store returns the store containing the transferred zones
+func (s *Secondary) Store() *Store {
+	return s.store
+}
+
+// Run loads the saved zones and starts refreshing each zone in the background
+func (s *Secondary) Run() {
+	for _, zone := range s.zones {
+		go s.runZone(zone)
+	}
+}
+
+func (s *Secondary) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// NotifyAllowed checks the address belongs to the primary nameserver, a
+// primary configured with a hostname is resolved for each check so address
+// changes are picked up
+func (s *Secondary) NotifyAllowed(addr net.Addr) bool {
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	remote := addrPort.Addr().Unmap()
+	host, _, err := net.SplitHostPort(s.primary)
+	if err != nil {
+		return false
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return ip.Unmap() == remote
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.client.Timeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		logger.Logger.Warn("Failed to resolve primary", "primary", host, "err", err)
+		return false
+	}
+	return slices.ContainsFunc(ips, func(ip netip.Addr) bool { return ip.Unmap() == remote })
+}
+
+// ReceiveNotify triggers an early refresh of the zone, the return value is
+// false if the zone is not transferred by this secondary
+func (s *Secondary) ReceiveNotify(zone string) bool {
+	trigger, ok := s.triggers[dns.Fqdn(strings.ToLower(zone))]
+	if !ok {
+		return false
+	}
+	select {
+	case trigger <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (s *Secondary) runZone(name string) {
+	var lastRefresh time.Time
+	if z, modTime, err := s.load(name); err == nil {
+		s.store.Set(z)
+		lastRefresh = modTime
+		logger.Logger.Info("Loaded saved zone", "zone", name, "serial", z.Soa.Serial)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		logger.Logger.Warn("Failed to load saved zone", "zone", name, "err", err)
+	}
+
+	for {
+		wait := defaultRetry
+		err := s.refresh(name)
+		current := s.store.Get(name)
+		switch {
+		case err == nil:
+			lastRefresh = time.Now()
+			wait = time.Duration(current.Soa.Refresh) * time.Second
+		case current != nil:
+			logger.Logger.Warn("Failed to refresh zone", "zone", name, "err", err)
+			wait = time.Duration(current.Soa.Retry) * time.Second
+
+			// stop serving the zone once the expire timer has passed
+			if time.Since(lastRefresh) > time.Duration(current.Soa.Expire)*time.Second {
+				logger.Logger.Error("Zone expired", "zone", name)
+				metrics.GetOrRegisterCounter("secondary.expired", metrics.DefaultRegistry).Inc(1)
+				s.store.Remove(name)
+				wait = defaultRetry
+			}
+		default:
+			logger.Logger.Warn("Failed to transfer zone", "zone", name, "err", err)
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-s.triggers[name]:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// refresh checks the serial on the primary and transfers the zone if it has
+// changed
+func (s *Secondary) refresh(name string) error {
+	current := s.store.Get(name)
+	if current != nil {
+		serial, err := s.primarySerial(name)
+		if err != nil {
+			return err
+		}
+		if !serialGreater(serial, current.Soa.Serial) {
+			return nil
+		}
+	}
+
+	z, err := s.transfer(name, current)
+	if err != nil {
+		metrics.GetOrRegisterCounter("secondary.transfer.failed", metrics.DefaultRegistry).Inc(1)
+		return err
+	}
+	metrics.GetOrRegisterCounter("secondary.transfer.success", metrics.DefaultRegistry).Inc(1)
+	if z == current {
+		return nil
+	}
+	s.store.Set(z)
+	logger.Logger.Info("Transferred zone", "zone", name, "serial", z.Soa.Serial)
+
+	if err := s.save(z); err != nil {
+		logger.Logger.Warn("Failed to save zone", "zone", name, "err", err)
+	}
+	return nil
+}
+
+// primarySerial queries the SOA serial of the zone on the primary
+func (s *Secondary) primarySerial(name string) (uint32, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, dns.TypeSOA)
+	resp, _, err := s.client.Exchange(msg, s.primary)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return 0, fmt.Errorf("primary responded with %s", dns.RcodeToString[resp.Rcode])
+	}
+	for _, rr := range resp.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, nil
+		}
+	}
+	return 0, errors.New("primary did not return a SOA record")
+}
+
+// transfer requests an IXFR if a copy of the zone is already held and an AXFR
+// otherwise, the primary may answer an IXFR with a full zone transfer
+func (s *Secondary) transfer(name string, current *Zone) (*Zone, error) {
+	msg := new(dns.Msg)
+	if current != nil {
+		msg.SetIxfr(name, current.Soa.Serial, current.Soa.Ns, current.Soa.Mbox)
+	} else {
+		msg.SetAxfr(name)
+	}
+
+	tr := &dns.Transfer{
+		DialTimeout:  5 * time.Second,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+	env, err := tr.In(msg, s.primary)
+	if err != nil {
+		return nil, err
+	}
+	var rrs []dns.RR
+	for e := range env {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		rrs = append(rrs, e.RR...)
+	}
+
+	if len(rrs) == 0 {
+		return nil, errors.New("empty zone transfer")
+	}
+	soa, ok := rrs[0].(*dns.SOA)
+	if !ok {
+		return nil, errors.New("zone transfer does not start with a SOA record")
+	}
+
+	// the IXFR response only contains the SOA when the zone is up-to-date
+	if len(rrs) == 1 {
+		if current == nil {
+			return nil, errors.New("zone transfer only contains a SOA record")
+		}
+		return current, nil
+	}
+	if _, ok := rrs[len(rrs)-1].(*dns.SOA); !ok {
+		return nil, errors.New("zone transfer does not end with a SOA record")
+	}
+
+	// an incremental transfer has a SOA record as the second record
+	if _, ok := rrs[1].(*dns.SOA); ok && current != nil {
+		return NewZone(name, soa, applyIxfr(current.RRs, rrs[1:len(rrs)-1])), nil
+	}
+	return NewZone(name, soa, rrs[1:len(rrs)-1]), nil
+}
+
+// applyIxfr applies the IXFR changes to a copy of the records, each change is
+// the old SOA record followed by the deleted records then the new SOA record
+// followed by the added records
+func applyIxfr(rrs []dns.RR, changes []dns.RR) []dns.RR {
+	rrs = slices.Clone(rrs)
+	adding := true
+	for _, rr := range changes {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			adding = !adding
+			continue
+		}
+		if adding {
+			rrs = append(rrs, rr)
+			continue
+		}
+		rrs = slices.DeleteFunc(rrs, func(a dns.RR) bool {
+			return dns.IsDuplicate(a, rr)
+		})
+	}
+	return rrs
+}
+
+// serialGreater compares serials using RFC 1982 serial number arithmetic
+func serialGreater(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
+
+func (s *Secondary) zonePath(name string) string {
+	return filepath.Join(s.dir, strings.TrimSuffix(name, ".")+".zone")
+}
+
+// save writes the zone to the zone directory if one is configured
+func (s *Secondary) save(z *Zone) error {
+	if s.dir == "" {
+		return nil
+	}
+	var sb strings.Builder
+	sb.WriteString(z.Soa.String())
+	sb.WriteByte('\n')
+	for _, rr := range z.RRs {
+		sb.WriteString(rr.String())
+		sb.WriteByte('\n')
+	}
+
+	// write to a temporary file first so a partial zone is never loaded
+	p := s.zonePath(z.Name)
+	err := os.WriteFile(p+".tmp", []byte(sb.String()), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(p+".tmp", p)
+}
+
+// load reads a zone from the zone directory and returns it with the time the
+// zone was saved
+func (s *Secondary) load(name string) (*Zone, time.Time, error) {
+	if s.dir == "" {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+	p := s.zonePath(name)
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var soa *dns.SOA
+	var rrs []dns.RR
+	zp := dns.NewZoneParser(f, name, p)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if v, isSoa := rr.(*dns.SOA); isSoa && soa == nil {
+			soa = v
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, time.Time{}, err
+	}
+	if soa == nil {
+		return nil, time.Time{}, errors.New("saved zone is missing a SOA record")
+	}
+	return NewZone(name, soa, rrs), stat.ModTime(), nil
+}
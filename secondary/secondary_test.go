@@ -0,0 +1,132 @@
+package secondary
+
+import (
+	"context"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/database"
+	"github.com/gobuffalo/nulls"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func mustRR(s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		panic(err)
+	}
+	return rr
+}
+
+func TestApplyIxfr(t *testing.T) {
+	rrs := []dns.RR{
+		mustRR("example.com. 300 IN A 10.0.0.1"),
+		mustRR("www.example.com. 300 IN A 10.0.0.2"),
+	}
+	out := applyIxfr(rrs, []dns.RR{
+		mustRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 300"),
+		mustRR("www.example.com. 300 IN A 10.0.0.2"),
+		mustRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 2 300 300 300 300"),
+		mustRR("www.example.com. 300 IN A 10.0.0.3"),
+		mustRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 2 300 300 300 300"),
+		mustRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 3 300 300 300 300"),
+		mustRR("mail.example.com. 300 IN A 10.0.0.4"),
+	})
+	assert.Equal(t, []dns.RR{
+		mustRR("example.com. 300 IN A 10.0.0.1"),
+		mustRR("www.example.com. 300 IN A 10.0.0.3"),
+		mustRR("mail.example.com. 300 IN A 10.0.0.4"),
+	}, out)
+
+	// the original records are not modified
+	assert.Len(t, rrs, 2)
+}
+
+func TestSecondary_refresh(t *testing.T) {
+	soa := mustRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 5 300 300 300 300")
+	zone := []dns.RR{
+		soa,
+		mustRR("example.com. 300 IN NS ns1.example.com."),
+		mustRR("example.com. 300 IN A 10.0.0.1"),
+		mustRR("www.example.com. 300 IN CNAME example.com."),
+		soa,
+	}
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if req.Question[0].Qtype == dns.TypeAXFR {
+			ch := make(chan *dns.Envelope, 1)
+			ch <- &dns.Envelope{RR: zone}
+			close(ch)
+			_ = new(dns.Transfer).Out(w, req, ch)
+			return
+		}
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+		msg.Answer = []dns.RR{soa}
+		_ = w.WriteMsg(msg)
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	pc, err := net.ListenPacket("udp", ln.Addr().String())
+	assert.NoError(t, err)
+	tcpSrv := &dns.Server{Listener: ln, Handler: handler}
+	udpSrv := &dns.Server{PacketConn: pc, Handler: handler}
+	go func() { _ = tcpSrv.ActivateAndServe() }()
+	go func() { _ = udpSrv.ActivateAndServe() }()
+	defer tcpSrv.Shutdown()
+	defer udpSrv.Shutdown()
+
+	s := New(conf.SecondaryConf{Primary: ln.Addr().String(), Zones: []string{"example.com"}}, t.TempDir())
+	assert.NoError(t, s.refresh("example.com."))
+
+	z := s.Store().Get("example.com.")
+	assert.NotNil(t, z)
+	assert.Equal(t, uint32(5), z.Soa.Serial)
+
+	rows, err := s.Store().LookupRecordsForType(context.Background(), database.LookupRecordsForTypeParams{Type: "CNAME", Name: "www", Name_2: "example.com."})
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "example.com.", rows[0].Value)
+
+	// the apex NS records are generated by the resolver
+	records, err := s.Store().GetZoneRecords(context.Background(), "example.com.")
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	// the zone is unchanged so the same copy is kept
+	assert.NoError(t, s.refresh("example.com."))
+	assert.Same(t, z, s.Store().Get("example.com."))
+
+	// the saved zone can be loaded again
+	loaded, _, err := s.load("example.com.")
+	assert.NoError(t, err)
+	assert.Equal(t, z.Soa.String(), loaded.Soa.String())
+	assert.Len(t, loaded.RRs, 3)
+}
+
+func TestSecondary_NotifyAllowed(t *testing.T) {
+	s := New(conf.SecondaryConf{Primary: "10.0.0.1", Zones: []string{"example.com"}}, "")
+	assert.True(t, s.NotifyAllowed(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5353}))
+	assert.True(t, s.NotifyAllowed(&net.TCPAddr{IP: net.ParseIP("::ffff:10.0.0.1"), Port: 5353}))
+	assert.False(t, s.NotifyAllowed(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 53}))
+
+	s = New(conf.SecondaryConf{Primary: "localhost:5353", Zones: []string{"example.com"}}, "")
+	assert.True(t, s.NotifyAllowed(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}))
+	assert.False(t, s.NotifyAllowed(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 53}))
+}
+
+func TestNewZone(t *testing.T) {
+	soa := mustRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 5 300 300 300 300")
+	z := NewZone("example.com.", soa.(*dns.SOA), []dns.RR{
+		mustRR("example.com. 300 IN NS ns1.example.com."),
+		mustRR("www.example.com. 300 IN A 10.0.0.1"),
+		mustRR("_loc_res.geo.example.com. 300 IN TXT \"service\""),
+	})
+	assert.Equal(t, []string{"ns1.example.com."}, z.nameservers)
+
+	// location resolving records are not served by secondaries
+	assert.Equal(t, []database.Record{
+		{Name: "www", Type: "A", Ttl: nulls.NewUInt32(300), Value: "10.0.0.1"},
+	}, z.records)
+}
@@ -0,0 +1,280 @@
+package secondary
+
+import (
+	"context"
+	"database/sql"
+	"github.com/1f349/azalea/converters"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/logger"
+	"github.com/1f349/azalea/models"
+	"github.com/1f349/azalea/utils"
+	"github.com/gobuffalo/nulls"
+	"github.com/miekg/dns"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Zone is an immutable copy of a zone transferred from the primary nameserver
+type Zone struct {
+	Name string
+	Soa  *dns.SOA
+
+	// RRs contains every record in the zone except the SOA record
+	RRs []dns.RR
+
+	// records are the RRs converted to database records for the resolver, the
+	// apex NS records are excluded as the resolver generates them
+	records []database.Record
+
+	// nameservers are the targets of the apex NS records
+	nameservers []string
+}
+
+// locationResolvingPrefix is the label used by the primary to send location
+// resolving records as TXT records in zone transfers
+const locationResolvingPrefix = "_loc_res."
+
+// NewZone creates a zone from the transferred records, records with an
+// unsupported type are logged and left out of the records served by the
+// resolver, location resolving records need the service locations from the
+// database of the primary so these are also left out
+func NewZone(name string, soa *dns.SOA, rrs []dns.RR) *Zone {
+	name = dns.Fqdn(strings.ToLower(name))
+	z := &Zone{
+		Name:    name,
+		Soa:     soa,
+		RRs:     rrs,
+		records: make([]database.Record, 0, len(rrs)),
+	}
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		rrName := strings.ToLower(hdr.Name)
+		if hdr.Rrtype == dns.TypeSOA {
+			continue
+		}
+		if ns, ok := rr.(*dns.NS); ok && rrName == name {
+			z.nameservers = append(z.nameservers, ns.Ns)
+			continue
+		}
+		if hdr.Rrtype == dns.TypeTXT && strings.HasPrefix(rrName, locationResolvingPrefix) {
+			logger.Logger.Warn("Skipping location resolving record, these are not supported by secondaries", "zone", name, "name", strings.TrimPrefix(rrName, locationResolvingPrefix))
+			continue
+		}
+		value, err := converters.FromRR(rr)
+		if err != nil {
+			logger.Logger.Warn("Skipping transferred record", "zone", name, "record", rr.String(), "err", err)
+			continue
+		}
+		z.records = append(z.records, database.Record{
+			Name:  utils.SimplifyRecordName(rrName, name),
+			Type:  models.TypeToString(hdr.Rrtype),
+			Ttl:   nulls.NewUInt32(hdr.Ttl),
+			Value: value.EncodeValue(),
+		})
+	}
+	return z
+}
+
+// Store holds the zones transferred from the primary nameserver in memory and
+// provides the queries used by resolver.Resolver
+type Store struct {
+	mu     *sync.RWMutex
+	zones  map[string]*Zone
+	ids    map[string]int32
+	nextId int32
+}
+
+func NewStore() *Store {
+	return &Store{
+		mu:    new(sync.RWMutex),
+		zones: make(map[string]*Zone),
+		ids:   make(map[string]int32),
+	}
+}
+
+// Get returns the zone or nil if the zone is not loaded
+func (s *Store) Get(name string) *Zone {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.zones[name]
+}
+
+// Set adds or replaces a zone
+func (s *Store) Set(z *Zone) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ids[z.Name]; !ok {
+		s.nextId++
+		s.ids[z.Name] = s.nextId
+	}
+	s.zones[z.Name] = z
+}
+
+// Remove stops serving a zone
+func (s *Store) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.zones, name)
+}
+
+// dbZone converts the zone for the resolver, the SOA and NS settings from the
+// primary override the config of the secondary
+func (s *Store) dbZone(z *Zone) database.Zone {
+	zone := database.Zone{
+		ID:         s.ids[z.Name],
+		Name:       z.Name,
+		Serial:     z.Soa.Serial,
+		DefaultTtl: z.Soa.Hdr.Ttl,
+		Mbox:       nulls.NewString(z.Soa.Mbox),
+		Refresh:    nulls.NewUInt32(z.Soa.Refresh),
+		Retry:      nulls.NewUInt32(z.Soa.Retry),
+		Expire:     nulls.NewUInt32(z.Soa.Expire),
+		Minimum:    nulls.NewUInt32(z.Soa.Minttl),
+	}
+	if len(z.nameservers) > 0 {
+		zone.Nameservers = nulls.NewString(strings.Join(z.nameservers, " "))
+	}
+	return zone
+}
+
+func (s *Store) LookupRecordsForType(_ context.Context, arg database.LookupRecordsForTypeParams) ([]database.LookupRecordsForTypeRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zones[arg.Name_2]
+	if z == nil {
+		return nil, nil
+	}
+	var rows []database.LookupRecordsForTypeRow
+	for _, i := range z.records {
+		if i.Name != arg.Name || (i.Type != arg.Type && i.Type != "LOC_RES") {
+			continue
+		}
+		rows = append(rows, database.LookupRecordsForTypeRow{
+			ID:             i.ID,
+			Zone:           s.ids[z.Name],
+			Name:           i.Name,
+			Type:           i.Type,
+			Locked:         i.Locked,
+			Ttl:            i.Ttl,
+			Value:          i.Value,
+			ZoneName:       z.Name,
+			ZoneDefaultTtl: z.Soa.Hdr.Ttl,
+		})
+	}
+	return rows, nil
+}
+
+func (s *Store) GetZones(_ context.Context) ([]database.Zone, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	zones := make([]database.Zone, 0, len(s.zones))
+	for _, z := range s.zones {
+		zones = append(zones, s.dbZone(z))
+	}
+	sort.Slice(zones, func(i, j int) bool {
+		return zones[i].ID < zones[j].ID
+	})
+	return zones, nil
+}
+
+func (s *Store) GetZone(_ context.Context, name string) (database.Zone, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zones[name]
+	if z == nil {
+		return database.Zone{}, sql.ErrNoRows
+	}
+	return s.dbZone(z), nil
+}
+
+// GetZoneForName returns the zone with the longest name containing the name
+func (s *Store) GetZoneForName(_ context.Context, name string) (database.Zone, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for n := name; n != ""; _, n, _ = strings.Cut(n, ".") {
+		if z := s.zones[n]; z != nil {
+			return s.dbZone(z), nil
+		}
+	}
+	return database.Zone{}, sql.ErrNoRows
+}
+
+func (s *Store) GetZoneRecords(_ context.Context, name string) ([]database.Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zones[name]
+	if z == nil {
+		return nil, nil
+	}
+	records := make([]database.Record, len(z.records))
+	copy(records, z.records)
+	for i := range records {
+		records[i].Zone = s.ids[z.Name]
+	}
+	return records, nil
+}
+
+// GetJournalEntries always returns no entries as the secondary does not keep a
+// journal, IXFR requests for transferred zones are answered with a full zone
+// transfer
+func (s *Store) GetJournalEntries(_ context.Context, _ database.GetJournalEntriesParams) ([]database.ZoneJournal, error) {
+	return nil, nil
+}
+
+// GetZoneKeys always returns no keys as transferred zones are served unsigned,
+// the primary refuses to sign zones with secondaries
+func (s *Store) GetZoneKeys(_ context.Context, _ string) ([]database.ZoneKey, error) {
+	return nil, nil
+}
+
+func (s *Store) LookupRecordTypes(_ context.Context, arg database.LookupRecordTypesParams) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zones[arg.Name_2]
+	if z == nil {
+		return nil, nil
+	}
+	var types []string
+	for _, i := range z.records {
+		if i.Name == arg.Name && !slices.Contains(types, i.Type) {
+			types = append(types, i.Type)
+		}
+	}
+	return types, nil
+}
+
+// CountDelegations counts the NS records below the zone apex, the apex NS
+// records are not stored as records
+func (s *Store) CountDelegations(_ context.Context, name string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zones[name]
+	if z == nil {
+		return 0, nil
+	}
+	var count int64
+	for _, i := range z.records {
+		if i.Type == "NS" && i.Name != "@" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) CountRecordsBelowName(_ context.Context, arg database.CountRecordsBelowNameParams) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z := s.zones[arg.Zone]
+	if z == nil {
+		return 0, nil
+	}
+	var count int64
+	for _, i := range z.records {
+		if strings.HasSuffix(i.Name, arg.Suffix) {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -15,7 +15,7 @@ import (
 	"strings"
 )
 
-func NewApiServer(db *database.Queries, res *resolver.Resolver, verify *mjwt.KeyStore, authToken string) *httprouter.Router {
+func NewApiServer(db *database.Queries, res *resolver.Resolver, notify zoneNotifier, keys keyManager, verify *mjwt.KeyStore, authToken string) *httprouter.Router {
 	r := httprouter.New()
 
 	r.GET("/", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params) {
@@ -37,8 +37,10 @@ func NewApiServer(db *database.Queries, res *resolver.Resolver, verify *mjwt.Key
 		_ = json.NewEncoder(rw).Encode(metrics.DefaultRegistry.GetAll())
 	})
 
-	AddDomainEndpoints(r, db, res, verify)
-	AddRecordEndpoints(r, db, res, verify)
+	AddDomainEndpoints(r, db, res, notify, verify)
+	AddRecordEndpoints(r, db, res, notify, verify)
+	AddDnssecEndpoints(r, db, keys, verify)
+	AddDohEndpoints(r, res)
 
 	return r
 }
@@ -62,9 +64,17 @@ func getZoneOwnershipClaims(perms *auth.PermStorage) []string {
 }
 
 // validateZoneOwnershipClaims validates if the claims contain the
-// `domain:owns=<fqdn>` field with the matching top level domain
+// `domain:owns=<fqdn>` field for the zone itself or for its registrable domain
+// (eTLD+1), this allows owners of a domain to manage child zones hosted
+// separately without a claim on a public suffix granting every zone below it
 func validateZoneOwnershipClaims(a string, perms *auth.PermStorage) bool {
-	a = strings.TrimRight(a, ".")
+	a = strings.ToLower(strings.TrimRight(a, "."))
+	if a == "" {
+		return false
+	}
+	if perms.Has("domain:owns=" + a) {
+		return true
+	}
 	if fqdn, ok := utils.GetTopFqdn(a); ok {
 		if perms.Has("domain:owns=" + fqdn) {
 			return true
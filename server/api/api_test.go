@@ -0,0 +1,28 @@
+package api
+
+import (
+	"github.com/1f349/mjwt/auth"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateZoneOwnershipClaims(t *testing.T) {
+	ps := auth.NewPermStorage()
+	ps.Set("domain:owns=example.com")
+	ps.Set("domain:owns=eng.example.org")
+	ps.Set("domain:owns=com")
+
+	assert.True(t, validateZoneOwnershipClaims("example.com.", ps))
+	assert.True(t, validateZoneOwnershipClaims("eng.example.com.", ps))
+	assert.True(t, validateZoneOwnershipClaims("eng.example.org", ps))
+	assert.True(t, validateZoneOwnershipClaims("dev.example.com.", ps))
+	assert.False(t, validateZoneOwnershipClaims("example.org.", ps))
+	assert.False(t, validateZoneOwnershipClaims("other.example.org.", ps))
+	assert.False(t, validateZoneOwnershipClaims("notexample.com.", ps))
+
+	// claims only match the zone itself or the registrable domain
+	assert.False(t, validateZoneOwnershipClaims("dev.eng.example.org.", ps))
+	assert.True(t, validateZoneOwnershipClaims("com.", ps))
+	assert.False(t, validateZoneOwnershipClaims("other.com.", ps))
+	assert.False(t, validateZoneOwnershipClaims("", ps))
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/dnssec"
+	"github.com/1f349/mjwt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/miekg/dns"
+	"net/http"
+)
+
+type dnssecQueries interface {
+	GetZone(ctx context.Context, zone string) (database.Zone, error)
+	GetZoneKeys(ctx context.Context, name string) ([]database.ZoneKey, error)
+}
+
+type keyManager interface {
+	Enable(ctx context.Context, name string) error
+	Rollover(ctx context.Context, name string, ksk bool) error
+	ConfirmDs(ctx context.Context, name string) error
+}
+
+type zoneKeyValue struct {
+	Id             int32  `json:"id"`
+	Flags          uint16 `json:"flags"`
+	Algorithm      uint8  `json:"algorithm"`
+	KeyTag         uint16 `json:"key_tag"`
+	PublicKey      string `json:"public_key"`
+	State          string `json:"state"`
+	StateChangedAt int64  `json:"state_changed_at"`
+}
+
+func AddDnssecEndpoints(r *httprouter.Router, db dnssecQueries, keys keyManager, verify *mjwt.KeyStore) {
+	// Endpoints for DNSSEC keys
+	r.GET("/domains/:domain/dnssec", checkAuthWithPerm(verify, "azalea:domains", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params, b AuthClaims) {
+		domain := dns.Fqdn(params.ByName("domain"))
+		if !validateZoneOwnershipClaims(domain, b.Claims.Perms) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+		_, err := db.GetZone(req.Context(), domain)
+		if errors.Is(err, sql.ErrNoRows) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+		if err != nil {
+			apiError(rw, http.StatusInternalServerError, "Internal database error")
+			return
+		}
+		rows, err := db.GetZoneKeys(req.Context(), domain)
+		if err != nil {
+			apiError(rw, http.StatusInternalServerError, "Internal database error")
+			return
+		}
+		out := make([]zoneKeyValue, 0, len(rows))
+		for _, i := range rows {
+			out = append(out, zoneKeyValue{
+				Id:             i.ID,
+				Flags:          i.Flags,
+				Algorithm:      i.Algorithm,
+				KeyTag:         dnssec.DNSKEY(domain, i).KeyTag(),
+				PublicKey:      i.PublicKey,
+				State:          i.State,
+				StateChangedAt: i.StateChangedAt,
+			})
+		}
+		_ = json.NewEncoder(rw).Encode(out)
+	}))
+	r.POST("/domains/:domain/dnssec", checkAuthWithPerm(verify, "azalea:domains", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params, b AuthClaims) {
+		domain := dns.Fqdn(params.ByName("domain"))
+		if !validateZoneOwnershipClaims(domain, b.Claims.Perms) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+		if keyManagerError(rw, keys.Enable(req.Context(), domain)) {
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	r.POST("/domains/:domain/dnssec/rollover", checkAuthWithPerm(verify, "azalea:domains", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params, b AuthClaims) {
+		domain := dns.Fqdn(params.ByName("domain"))
+		if !validateZoneOwnershipClaims(domain, b.Claims.Perms) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+
+		var a struct {
+			Type string `json:"type"`
+		}
+		dec := json.NewDecoder(req.Body)
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&a)
+		if err != nil || (a.Type != "ksk" && a.Type != "zsk") {
+			apiError(rw, http.StatusBadRequest, "Bad Request")
+			return
+		}
+		if keyManagerError(rw, keys.Rollover(req.Context(), domain, a.Type == "ksk")) {
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	// Endpoints for the DS records in the parent zone
+	r.GET("/domains/:domain/dnssec/ds", checkAuthWithPerm(verify, "azalea:domains", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params, b AuthClaims) {
+		domain := dns.Fqdn(params.ByName("domain"))
+		if !validateZoneOwnershipClaims(domain, b.Claims.Perms) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+		_, err := db.GetZone(req.Context(), domain)
+		if errors.Is(err, sql.ErrNoRows) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+		if err != nil {
+			apiError(rw, http.StatusInternalServerError, "Internal database error")
+			return
+		}
+		rows, err := db.GetZoneKeys(req.Context(), domain)
+		if err != nil {
+			apiError(rw, http.StatusInternalServerError, "Internal database error")
+			return
+		}
+		for _, i := range dnssec.DsRecords(domain, rows) {
+			_, err = fmt.Fprintln(rw, i.String())
+			if err != nil {
+				return
+			}
+		}
+	}))
+	r.POST("/domains/:domain/dnssec/ds-seen", checkAuthWithPerm(verify, "azalea:domains", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params, b AuthClaims) {
+		domain := dns.Fqdn(params.ByName("domain"))
+		if !validateZoneOwnershipClaims(domain, b.Claims.Perms) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+		if keyManagerError(rw, keys.ConfirmDs(req.Context(), domain)) {
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+}
+
+// keyManagerError outputs the error from the key manager, the return value is
+// true if there was an error
+func keyManagerError(rw http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, sql.ErrNoRows):
+		apiError(rw, http.StatusNotFound, "Invalid domain")
+	case errors.Is(err, dnssec.ErrAlreadyEnabled),
+		errors.Is(err, dnssec.ErrNotEnabled),
+		errors.Is(err, dnssec.ErrRolloverInProgress),
+		errors.Is(err, dnssec.ErrNoPendingDs),
+		errors.Is(err, dnssec.ErrHasSecondaries):
+		apiError(rw, http.StatusConflict, err.Error())
+	default:
+		apiError(rw, http.StatusInternalServerError, "Internal database error")
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/dnssec"
+	"github.com/1f349/mjwt/auth"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/julienschmidt/httprouter"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type fakeDnssecQueries struct {
+	keys []database.ZoneKey
+}
+
+func (f *fakeDnssecQueries) GetZone(ctx context.Context, zone string) (database.Zone, error) {
+	switch zone {
+	case "example.com.":
+		return database.Zone{ID: 1, Name: "example.com."}, nil
+	case "example.net.":
+		return database.Zone{}, sql.ErrNoRows
+	}
+	panic("not implemented")
+}
+
+func (f *fakeDnssecQueries) GetZoneKeys(ctx context.Context, name string) ([]database.ZoneKey, error) {
+	if name == "example.com." {
+		return f.keys, nil
+	}
+	panic("not implemented")
+}
+
+type fakeKeyManager struct{}
+
+func (f *fakeKeyManager) Enable(ctx context.Context, name string) error {
+	if name == "example.net." {
+		return sql.ErrNoRows
+	}
+	return dnssec.ErrAlreadyEnabled
+}
+
+func (f *fakeKeyManager) Rollover(ctx context.Context, name string, ksk bool) error {
+	if !ksk {
+		panic("wrong key type")
+	}
+	return nil
+}
+
+func (f *fakeKeyManager) ConfirmDs(ctx context.Context, name string) error {
+	return dnssec.ErrNoPendingDs
+}
+
+func TestAddDnssecEndpoints(t *testing.T) {
+	params, err := dnssec.GenerateKey(database.Zone{Name: "example.com."}, dns.ZONE|dns.SEP, dnssec.StateActive, time.Unix(1700000000, 0))
+	assert.NoError(t, err)
+	key := database.ZoneKey{
+		ID:             1,
+		Flags:          params.Flags,
+		Algorithm:      params.Algorithm,
+		PublicKey:      params.PublicKey,
+		PrivateKey:     params.PrivateKey,
+		State:          params.State,
+		StateChangedAt: params.StateChangedAt,
+	}
+
+	r := httprouter.New()
+	signer := genSigner(t)
+	AddDnssecEndpoints(r, &fakeDnssecQueries{keys: []database.ZoneKey{key}}, &fakeKeyManager{}, signer.KeyStore())
+
+	makeToken := func() string {
+		ps := auth.NewPermStorage()
+		ps.Set("azalea:domains")
+		ps.Set("domain:owns=example.com")
+		ps.Set("domain:owns=example.net")
+		return mustGen(signer, "1234", "1234", jwt.ClaimStrings{"example.com"}, 15*time.Minute, &auth.AccessTokenClaims{Perms: ps})
+	}
+
+	// tests
+	t.Run("GET domains example.com dnssec", func(t *testing.T) {
+		makeReq := baseMakeReq(http.MethodGet, "/domains/example.com/dnssec")
+		req := makeReq("")
+		doTestRequest(t, "no auth", req, r, http.StatusForbidden, "Missing bearer token")
+		req = baseMakeReq(http.MethodGet, "/domains/example.net/dnssec")("")
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "unknown domain", req, r, http.StatusNotFound, "Invalid domain")
+		req = makeReq("")
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "ok", req, r, http.StatusOK, fmt.Sprintf(`[{"id":1,"flags":257,"algorithm":%d,"key_tag":%d,"public_key":"%s","state":"active","state_changed_at":1700000000}]`,
+			key.Algorithm, dnssec.DNSKEY("example.com.", key).KeyTag(), key.PublicKey))
+	})
+	t.Run("POST domains example.com dnssec", func(t *testing.T) {
+		makeReq := baseMakeReq(http.MethodPost, "/domains/example.com/dnssec")
+		req := baseMakeReq(http.MethodPost, "/domains/example.net/dnssec")("")
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "unknown domain", req, r, http.StatusNotFound, "Invalid domain")
+		req = makeReq("")
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "already enabled", req, r, http.StatusConflict, dnssec.ErrAlreadyEnabled.Error())
+	})
+	t.Run("POST domains example.com dnssec rollover", func(t *testing.T) {
+		makeReq := baseMakeReq(http.MethodPost, "/domains/example.com/dnssec/rollover")
+		req := makeReq(`{"type":"dnskey"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "bad request", req, r, http.StatusBadRequest, "Bad Request")
+		req = makeReq(`{"type":"ksk"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "ok", req, r, http.StatusOK, "")
+	})
+	t.Run("GET domains example.com dnssec ds", func(t *testing.T) {
+		makeReq := baseMakeReq(http.MethodGet, "/domains/example.com/dnssec/ds")
+		req := baseMakeReq(http.MethodGet, "/domains/example.net/dnssec/ds")("")
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "unknown domain", req, r, http.StatusNotFound, "Invalid domain")
+		req = makeReq("")
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		ds := dnssec.DsRecords("example.com.", []database.ZoneKey{key})
+		if assert.Len(t, ds, 1) {
+			doTestRequest(t, "ok", req, r, http.StatusOK, "\000"+ds[0].String())
+		}
+	})
+	t.Run("POST domains example.com dnssec ds-seen", func(t *testing.T) {
+		req := baseMakeReq(http.MethodPost, "/domains/example.com/dnssec/ds-seen")("")
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "no pending ds", req, r, http.StatusConflict, dnssec.ErrNoPendingDs.Error())
+	})
+}
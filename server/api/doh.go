@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/julienschmidt/httprouter"
+	"github.com/miekg/dns"
+	"github.com/rcrowley/go-metrics"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+)
+
+const dnsMessageType = "application/dns-message"
+
+type dohResolver interface {
+	Lookup(ctx context.Context, req *dns.Msg, addr net.Addr) *dns.Msg
+}
+
+// AddDohEndpoints adds the DNS-over-HTTPS endpoint from RFC 8484
+func AddDohEndpoints(r *httprouter.Router, res dohResolver) {
+	r.GET("/dns-query", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		raw, err := base64.RawURLEncoding.DecodeString(req.URL.Query().Get("dns"))
+		if err != nil || len(raw) == 0 {
+			http.Error(rw, "Invalid dns parameter", http.StatusBadRequest)
+			return
+		}
+		serveDoh(rw, req, res, raw)
+	})
+	r.POST("/dns-query", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if req.Header.Get("Content-Type") != dnsMessageType {
+			http.Error(rw, "Unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		raw, err := io.ReadAll(io.LimitReader(req.Body, dns.MaxMsgSize+1))
+		if err != nil || len(raw) == 0 || len(raw) > dns.MaxMsgSize {
+			http.Error(rw, "Invalid DNS message", http.StatusBadRequest)
+			return
+		}
+		serveDoh(rw, req, res, raw)
+	})
+}
+
+func serveDoh(rw http.ResponseWriter, req *http.Request, res dohResolver, raw []byte) {
+	metrics.GetOrRegisterCounter("doh.requests", metrics.DefaultRegistry).Inc(1)
+
+	msg := new(dns.Msg)
+	err := msg.Unpack(raw)
+	if err != nil || msg.Response || len(msg.Question) != 1 {
+		http.Error(rw, "Invalid DNS message", http.StatusBadRequest)
+		return
+	}
+
+	var reply *dns.Msg
+	switch {
+	case msg.Opcode != dns.OpcodeQuery:
+		reply = new(dns.Msg).SetRcode(msg, dns.RcodeNotImplemented)
+	case msg.Question[0].Qtype == dns.TypeAXFR || msg.Question[0].Qtype == dns.TypeIXFR:
+		// zone transfers are not supported over HTTP
+		reply = new(dns.Msg).SetRcode(msg, dns.RcodeRefused)
+	default:
+		var addr net.Addr
+		if addrPort, err := netip.ParseAddrPort(req.RemoteAddr); err == nil {
+			addr = net.TCPAddrFromAddrPort(addrPort)
+		}
+		reply = res.Lookup(req.Context(), msg, addr)
+	}
+
+	out, err := reply.Pack()
+	if err != nil {
+		http.Error(rw, "Failed to pack DNS message", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", dnsMessageType)
+	rw.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(minTtl(reply)), 10))
+	rw.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(out)
+}
+
+// minTtl returns the lowest TTL in the answer and authority sections, the SOA
+// minimum is included for negative caching and zero is returned if there are
+// no records
+func minTtl(msg *dns.Msg) uint32 {
+	var ttl uint32
+	first := true
+	for _, sections := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rr := range sections {
+			rrTtl := rr.Header().Ttl
+			if soa, ok := rr.(*dns.SOA); ok {
+				rrTtl = min(rrTtl, soa.Minttl)
+			}
+			if first || rrTtl < ttl {
+				ttl = rrTtl
+				first = false
+			}
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/julienschmidt/httprouter"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeDohResolver struct {
+	addr net.Addr
+}
+
+func (f *fakeDohResolver) Lookup(ctx context.Context, req *dns.Msg, addr net.Addr) *dns.Msg {
+	f.addr = addr
+	msg := new(dns.Msg)
+	msg.SetReply(req)
+	a, _ := dns.NewRR(req.Question[0].Name + " 300 IN A 10.0.0.1")
+	b, _ := dns.NewRR(req.Question[0].Name + " 60 IN A 10.0.0.2")
+	msg.Answer = []dns.RR{a, b}
+	return msg
+}
+
+func TestAddDohEndpoints(t *testing.T) {
+	r := httprouter.New()
+	res := &fakeDohResolver{}
+	AddDohEndpoints(r, res)
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	query.Id = 0
+	raw, err := query.Pack()
+	assert.NoError(t, err)
+
+	checkReply := func(t *testing.T, resp *http.Response) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/dns-message", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "max-age=60", resp.Header.Get("Cache-Control"))
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		reply := new(dns.Msg)
+		assert.NoError(t, reply.Unpack(body))
+		assert.Len(t, reply.Answer, 2)
+	}
+
+	t.Run("GET", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/dns-query?dns="+base64.RawURLEncoding.EncodeToString(raw), nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		checkReply(t, rec.Result())
+		assert.Equal(t, req.RemoteAddr, res.addr.String())
+	})
+	t.Run("GET invalid", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/dns-query?dns=%3D%3D", nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("POST", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/dns-query", strings.NewReader(string(raw)))
+		req.Header.Set("Content-Type", "application/dns-message")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		checkReply(t, rec.Result())
+	})
+	t.Run("POST invalid content type", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/dns-query", strings.NewReader(string(raw)))
+		req.Header.Set("Content-Type", "text/plain")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+	t.Run("AXFR refused", func(t *testing.T) {
+		axfr := new(dns.Msg)
+		axfr.SetAxfr("example.com.")
+		raw, err := axfr.Pack()
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/dns-query", strings.NewReader(string(raw)))
+		req.Header.Set("Content-Type", "application/dns-message")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		reply := new(dns.Msg)
+		assert.NoError(t, reply.Unpack(rec.Body.Bytes()))
+		assert.Equal(t, dns.RcodeRefused, reply.Rcode)
+	})
+}
+
+func TestMinTtl(t *testing.T) {
+	msg := new(dns.Msg)
+	assert.Equal(t, uint32(0), minTtl(msg))
+	soa, err := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 120")
+	assert.NoError(t, err)
+	msg.Ns = []dns.RR{soa}
+	assert.Equal(t, uint32(120), minTtl(msg))
+}
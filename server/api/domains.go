@@ -6,12 +6,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/1f349/azalea/conf"
 	"github.com/1f349/azalea/database"
 	"github.com/1f349/azalea/models"
 	"github.com/1f349/mjwt"
+	"github.com/gobuffalo/nulls"
 	"github.com/julienschmidt/httprouter"
 	"github.com/miekg/dns"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -19,13 +22,31 @@ type domainQueries interface {
 	AddZone(ctx context.Context, zone string) (int64, error)
 	GetOwnedZones(ctx context.Context, zones []string) ([]database.Zone, error)
 	GetZone(ctx context.Context, zone string) (database.Zone, error)
+	SetZoneDefaultTtlWithJournal(ctx context.Context, arg database.SetZoneDefaultTtlParams) error
+	SetZoneSerialScheme(ctx context.Context, arg database.SetZoneSerialSchemeParams) error
+	SetZoneSoaWithJournal(ctx context.Context, arg database.SetZoneSoaParams) error
+}
+
+// zoneSoaValue contains the SOA and NS settings of a zone, null values use the
+// settings from the config
+//
+// Updates replace every setting, fields missing from the request are reset to
+// the config values so an empty object removes all overrides for the zone.
+type zoneSoaValue struct {
+	Nameservers []string     `json:"nameservers"`
+	Mbox        nulls.String `json:"mbox"`
+	Refresh     nulls.UInt32 `json:"refresh"`
+	Retry       nulls.UInt32 `json:"retry"`
+	Expire      nulls.UInt32 `json:"expire"`
+	Minimum     nulls.UInt32 `json:"minimum"`
 }
 
 type domainResolver interface {
 	GetZoneRecords(ctx context.Context, zone string) ([]*models.Record, error)
+	ZoneSoa(zoneRow database.Zone) conf.SoaConf
 }
 
-func AddDomainEndpoints(r *httprouter.Router, db domainQueries, res domainResolver, verify *mjwt.KeyStore) {
+func AddDomainEndpoints(r *httprouter.Router, db domainQueries, res domainResolver, notify zoneNotifier, verify *mjwt.KeyStore) {
 	// Endpoints for domains
 	r.POST("/domains", checkAuthWithPerm(verify, "azalea:domains", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params, b AuthClaims) {
 		var a struct {
@@ -85,6 +106,184 @@ func AddDomainEndpoints(r *httprouter.Router, db domainQueries, res domainResolv
 		}
 		_ = json.NewEncoder(rw).Encode(zone)
 	}))
+	r.PUT("/domains/:domain", checkAuthWithPerm(verify, "azalea:domains", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params, b AuthClaims) {
+		domain := dns.Fqdn(params.ByName("domain"))
+		if !validateZoneOwnershipClaims(domain, b.Claims.Perms) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+
+		var a struct {
+			DefaultTtl   *uint32 `json:"default_ttl"`
+			SerialScheme *string `json:"serial_scheme"`
+		}
+		dec := json.NewDecoder(req.Body)
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&a)
+		if err != nil {
+			apiError(rw, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if a.DefaultTtl != nil && *a.DefaultTtl > maxTtl {
+			apiError(rw, http.StatusBadRequest, "Invalid TTL")
+			return
+		}
+		if a.SerialScheme != nil && !database.ValidSerialScheme(*a.SerialScheme) {
+			apiError(rw, http.StatusBadRequest, "Invalid serial scheme")
+			return
+		}
+
+		zone, err := db.GetZone(req.Context(), domain)
+		if errors.Is(err, sql.ErrNoRows) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+		if err != nil {
+			apiError(rw, http.StatusInternalServerError, "Internal database error")
+			return
+		}
+
+		// the serial scheme is used for the next change so the records and
+		// serial are unchanged
+		if a.SerialScheme != nil {
+			err = db.SetZoneSerialScheme(req.Context(), database.SetZoneSerialSchemeParams{
+				SerialScheme: *a.SerialScheme,
+				ID:           zone.ID,
+			})
+			if err != nil {
+				apiError(rw, http.StatusInternalServerError, "Internal database error")
+				return
+			}
+		}
+		if a.DefaultTtl == nil {
+			rw.WriteHeader(http.StatusOK)
+			return
+		}
+		err = db.SetZoneDefaultTtlWithJournal(req.Context(), database.SetZoneDefaultTtlParams{
+			DefaultTtl: *a.DefaultTtl,
+			ID:         zone.ID,
+		})
+		if err != nil {
+			apiError(rw, http.StatusInternalServerError, "Internal database error")
+			return
+		}
+		notify.Notify(domain)
+
+		rw.WriteHeader(http.StatusOK)
+	}))
+	r.GET("/domains/:domain/soa", checkAuthWithPerm(verify, "azalea:domains", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params, b AuthClaims) {
+		domain := dns.Fqdn(params.ByName("domain"))
+		if !validateZoneOwnershipClaims(domain, b.Claims.Perms) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+		zone, err := db.GetZone(req.Context(), domain)
+		if errors.Is(err, sql.ErrNoRows) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+		if err != nil {
+			apiError(rw, http.StatusInternalServerError, "Internal database error")
+			return
+		}
+		var nameservers []string
+		if zone.Nameservers.Valid {
+			nameservers = strings.Fields(zone.Nameservers.String)
+		}
+		_ = json.NewEncoder(rw).Encode(zoneSoaValue{
+			Nameservers: nameservers,
+			Mbox:        zone.Mbox,
+			Refresh:     zone.Refresh,
+			Retry:       zone.Retry,
+			Expire:      zone.Expire,
+			Minimum:     zone.Minimum,
+		})
+	}))
+	r.PUT("/domains/:domain/soa", checkAuthWithPerm(verify, "azalea:domains", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params, b AuthClaims) {
+		domain := dns.Fqdn(params.ByName("domain"))
+		if !validateZoneOwnershipClaims(domain, b.Claims.Perms) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+
+		var a zoneSoaValue
+		dec := json.NewDecoder(req.Body)
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&a)
+		var numErr *strconv.NumError
+		if errors.As(err, &numErr) {
+			// numbers which don't fit are rejected by the nulls package
+			apiError(rw, http.StatusBadRequest, "Invalid SOA field")
+			return
+		}
+		if err != nil {
+			apiError(rw, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		var nameservers nulls.String
+		if a.Nameservers != nil {
+			if len(a.Nameservers) == 0 {
+				apiError(rw, http.StatusBadRequest, "Invalid nameservers")
+				return
+			}
+			for n, ns := range a.Nameservers {
+				if _, ok := dns.IsDomainName(ns); !ok || strings.ContainsAny(ns, " \t") {
+					apiError(rw, http.StatusBadRequest, "Invalid nameservers")
+					return
+				}
+				a.Nameservers[n] = dns.Fqdn(ns)
+			}
+			nameservers = nulls.NewString(strings.Join(a.Nameservers, " "))
+		}
+		if a.Mbox.Valid {
+			if _, ok := dns.IsDomainName(a.Mbox.String); !ok || strings.ContainsAny(a.Mbox.String, " \t") {
+				apiError(rw, http.StatusBadRequest, "Invalid mbox")
+				return
+			}
+			a.Mbox.String = dns.Fqdn(a.Mbox.String)
+		}
+		if !validTtl(a.Minimum) {
+			apiError(rw, http.StatusBadRequest, "Invalid minimum")
+			return
+		}
+		if !validSoaTimer(a.Refresh) || !validSoaTimer(a.Retry) || !validSoaTimer(a.Expire) {
+			apiError(rw, http.StatusBadRequest, "Invalid SOA field")
+			return
+		}
+		// secondaries retry before the next refresh and expire the zone after
+		// failing to refresh it, the timers which are not set use the config
+		soa := res.ZoneSoa(database.Zone{Refresh: a.Refresh, Retry: a.Retry, Expire: a.Expire})
+		if soa.Retry >= soa.Refresh || soa.Refresh >= soa.Expire {
+			apiError(rw, http.StatusBadRequest, "Invalid SOA timers")
+			return
+		}
+
+		zone, err := db.GetZone(req.Context(), domain)
+		if errors.Is(err, sql.ErrNoRows) {
+			apiError(rw, http.StatusNotFound, "Invalid domain")
+			return
+		}
+		if err != nil {
+			apiError(rw, http.StatusInternalServerError, "Internal database error")
+			return
+		}
+		err = db.SetZoneSoaWithJournal(req.Context(), database.SetZoneSoaParams{
+			Nameservers: nameservers,
+			Mbox:        a.Mbox,
+			Refresh:     a.Refresh,
+			Retry:       a.Retry,
+			Expire:      a.Expire,
+			Minimum:     a.Minimum,
+			ID:          zone.ID,
+		})
+		if err != nil {
+			apiError(rw, http.StatusInternalServerError, "Internal database error")
+			return
+		}
+		notify.Notify(domain)
+
+		rw.WriteHeader(http.StatusOK)
+	}))
 	r.DELETE("/domains/:domain", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		// TODO: implement this
 		apiError(rw, http.StatusNotImplemented, "Not Implemented")
@@ -115,7 +314,7 @@ func AddDomainEndpoints(r *httprouter.Router, db domainQueries, res domainResolv
 		}
 
 		for _, i := range records {
-			line := i.RR(300).String()
+			line := i.RR(i.TtlOr(models.DefaultTtl)).String()
 
 			if strings.Count(line, "\t") > 2 {
 				prefix, suffix, _ := strings.Cut(line, "\t")
@@ -135,3 +334,9 @@ func AddDomainEndpoints(r *httprouter.Router, db domainQueries, res domainResolv
 		}
 	}))
 }
+
+// validSoaTimer checks the SOA refresh, retry or expire value is empty or a
+// non-zero value within the range allowed by RFC 2181
+func validSoaTimer(v nulls.UInt32) bool {
+	return !v.Valid || (v.UInt32 > 0 && v.UInt32 <= maxTtl)
+}
@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"github.com/1f349/azalea/conf"
 	"github.com/1f349/azalea/database"
 	"github.com/1f349/azalea/models"
 	"github.com/1f349/mjwt/auth"
@@ -29,19 +31,45 @@ func (f *fakeDomainQueries) AddZone(ctx context.Context, zone string) (int64, er
 }
 
 func (f *fakeDomainQueries) GetOwnedZones(ctx context.Context, zones []string) ([]database.Zone, error) {
-	return []database.Zone{{ID: 1, Name: "example.com."}}, nil
+	return []database.Zone{{ID: 1, Name: "example.com.", DefaultTtl: 300, SerialScheme: "date"}}, nil
 }
 
 func (f *fakeDomainQueries) GetZone(ctx context.Context, zone string) (database.Zone, error) {
 	if zone == "example.com." {
 		return database.Zone{
-			ID:   1,
-			Name: "example.com.",
+			ID:           1,
+			Name:         "example.com.",
+			DefaultTtl:   300,
+			SerialScheme: "date",
 		}, nil
 	}
+	if zone == "example.net." {
+		return database.Zone{}, sql.ErrNoRows
+	}
 	panic("not implemented")
 }
 
+func (f *fakeDomainQueries) SetZoneDefaultTtlWithJournal(ctx context.Context, arg database.SetZoneDefaultTtlParams) error {
+	if arg.ID != 1 || arg.DefaultTtl != 3600 {
+		panic("wrong default ttl")
+	}
+	return nil
+}
+
+func (f *fakeDomainQueries) SetZoneSerialScheme(ctx context.Context, arg database.SetZoneSerialSchemeParams) error {
+	if arg.ID != 1 || arg.SerialScheme != "unixtime" {
+		panic("wrong serial scheme")
+	}
+	return nil
+}
+
+func (f *fakeDomainQueries) SetZoneSoaWithJournal(ctx context.Context, arg database.SetZoneSoaParams) error {
+	if arg.ID != 1 || arg.Nameservers.String != "ns1.customer.example. ns2.customer.example." || arg.Mbox.Valid || arg.Refresh.UInt32 != 3600 {
+		panic("wrong soa")
+	}
+	return nil
+}
+
 type fakeResolver struct{}
 
 func (f *fakeResolver) GetZoneRecords(ctx context.Context, zone string) ([]*models.Record, error) {
@@ -80,6 +108,20 @@ func (f *fakeResolver) GetZoneRecords(ctx context.Context, zone string) ([]*mode
 	panic("not implemented")
 }
 
+func (f *fakeResolver) ZoneSoa(zoneRow database.Zone) conf.SoaConf {
+	soa := conf.SoaConf{Refresh: 7200, Retry: 1800, Expire: 1209600}
+	if zoneRow.Refresh.Valid {
+		soa.Refresh = zoneRow.Refresh.UInt32
+	}
+	if zoneRow.Retry.Valid {
+		soa.Retry = zoneRow.Retry.UInt32
+	}
+	if zoneRow.Expire.Valid {
+		soa.Expire = zoneRow.Expire.UInt32
+	}
+	return soa
+}
+
 func doTestRequest(t *testing.T, name string, req *http.Request, r *httprouter.Router, code int, output string) {
 	t.Helper()
 	t.Run(name, func(t *testing.T) {
@@ -120,12 +162,14 @@ func baseMakeReq(method, url string) func(body string) *http.Request {
 func TestAddDomainEndpoints(t *testing.T) {
 	r := httprouter.New()
 	signer := genSigner(t)
-	AddDomainEndpoints(r, &fakeDomainQueries{}, &fakeResolver{}, signer.KeyStore())
+	notify := &fakeNotifier{}
+	AddDomainEndpoints(r, &fakeDomainQueries{}, &fakeResolver{}, notify, signer.KeyStore())
 
 	makeToken := func() string {
 		ps := auth.NewPermStorage()
 		ps.Set("azalea:domains")
 		ps.Set("domain:owns=example.com")
+		ps.Set("domain:owns=example.net")
 		return mustGen(signer, "1234", "1234", jwt.ClaimStrings{"example.com"}, 15*time.Minute, &auth.AccessTokenClaims{Perms: ps})
 	}
 
@@ -147,7 +191,7 @@ func TestAddDomainEndpoints(t *testing.T) {
 		doTestRequest(t, "no auth", req, r, http.StatusForbidden, "Missing bearer token")
 		req = makeReq(`{"name":"example.com.","ns":"ns1.example.org.","mbox":"postmaster.example.org.","serial":1,"refresh":1,"retry":1,"expire":1,"ttl":1}`)
 		req.Header.Set("Authorization", "Bearer "+makeToken())
-		doTestRequest(t, "ok", req, r, http.StatusOK, `[{"id":1,"name":"example.com."}]`)
+		doTestRequest(t, "ok", req, r, http.StatusOK, `[{"id":1,"name":"example.com.","serial":0,"default_ttl":300,"serial_scheme":"date","nameservers":null,"mbox":null,"refresh":null,"retry":null,"expire":null,"minimum":null}]`)
 	})
 	t.Run("GET domains example.com", func(t *testing.T) {
 		makeReq := baseMakeReq(http.MethodGet, "/domains/example.com")
@@ -155,7 +199,80 @@ func TestAddDomainEndpoints(t *testing.T) {
 		doTestRequest(t, "no auth", req, r, http.StatusForbidden, "Missing bearer token")
 		req = makeReq(`{"name":"example.com.","ns":"ns1.example.org.","mbox":"postmaster.example.org.","serial":1,"refresh":1,"retry":1,"expire":1,"ttl":1}`)
 		req.Header.Set("Authorization", "Bearer "+makeToken())
-		doTestRequest(t, "ok", req, r, http.StatusOK, `{"id":1,"name":"example.com."}`)
+		doTestRequest(t, "ok", req, r, http.StatusOK, `{"id":1,"name":"example.com.","serial":0,"default_ttl":300,"serial_scheme":"date","nameservers":null,"mbox":null,"refresh":null,"retry":null,"expire":null,"minimum":null}`)
+	})
+	t.Run("PUT domains example.com", func(t *testing.T) {
+		makeReq := baseMakeReq(http.MethodPut, "/domains/example.com")
+		req := makeReq("")
+		doTestRequest(t, "no auth", req, r, http.StatusForbidden, "Missing bearer token")
+		req = makeReq(`{"default_ttl":2147483648}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "invalid ttl", req, r, http.StatusBadRequest, "Invalid TTL")
+		req = baseMakeReq(http.MethodPut, "/domains/example.net")(`{"default_ttl":3600}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "unknown domain", req, r, http.StatusNotFound, "Invalid domain")
+		req = makeReq(`{"default_ttl":3600}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "ok", req, r, http.StatusOK, "")
+		assert.Equal(t, []string{"example.com."}, notify.zones)
+		req = makeReq(`{"serial_scheme":"weekly"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "invalid serial scheme", req, r, http.StatusBadRequest, "Invalid serial scheme")
+		req = makeReq(`{"serial_scheme":"unixtime"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "ok serial scheme", req, r, http.StatusOK, "")
+		assert.Equal(t, []string{"example.com."}, notify.zones)
+	})
+	t.Run("GET domains example.com soa", func(t *testing.T) {
+		makeReq := baseMakeReq(http.MethodGet, "/domains/example.com/soa")
+		req := makeReq("")
+		doTestRequest(t, "no auth", req, r, http.StatusForbidden, "Missing bearer token")
+		req = makeReq("")
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "ok", req, r, http.StatusOK, `{"nameservers":null,"mbox":null,"refresh":null,"retry":null,"expire":null,"minimum":null}`)
+	})
+	t.Run("PUT domains example.com soa", func(t *testing.T) {
+		notify.zones = nil
+		makeReq := baseMakeReq(http.MethodPut, "/domains/example.com/soa")
+		req := makeReq("")
+		doTestRequest(t, "no auth", req, r, http.StatusForbidden, "Missing bearer token")
+		req = makeReq(`{"nameservers":[]}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "empty nameservers", req, r, http.StatusBadRequest, "Invalid nameservers")
+		req = makeReq(`{"nameservers":["ns1..customer.example"]}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "invalid nameservers", req, r, http.StatusBadRequest, "Invalid nameservers")
+		req = makeReq(`{"mbox":"host master.example"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "invalid mbox", req, r, http.StatusBadRequest, "Invalid mbox")
+		req = makeReq(`{"minimum":2147483648}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "invalid minimum", req, r, http.StatusBadRequest, "Invalid SOA field")
+		req = makeReq(`{"refresh":-1}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "negative refresh", req, r, http.StatusBadRequest, "Invalid SOA field")
+		req = makeReq(`{"retry":0}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "zero retry", req, r, http.StatusBadRequest, "Invalid SOA field")
+		req = makeReq(`{"refresh":3600,"retry":7200}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "retry after refresh", req, r, http.StatusBadRequest, "Invalid SOA timers")
+		req = makeReq(`{"refresh":3600,"expire":3600}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "expire before refresh", req, r, http.StatusBadRequest, "Invalid SOA timers")
+		req = makeReq(`{"retry":86400}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "retry after config refresh", req, r, http.StatusBadRequest, "Invalid SOA timers")
+		req = makeReq(`{"refresh":3600,"retry":3600}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "retry equal to refresh", req, r, http.StatusBadRequest, "Invalid SOA timers")
+		req = makeReq(`{"expire":3600}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "expire before config refresh", req, r, http.StatusBadRequest, "Invalid SOA timers")
+		req = makeReq(`{"nameservers":["ns1.customer.example","ns2.customer.example."],"refresh":3600}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "ok", req, r, http.StatusOK, "")
+		assert.Equal(t, []string{"example.com."}, notify.zones)
 	})
 	t.Run("GET domains example.com zone-file", func(t *testing.T) {
 		makeReq := baseMakeReq(http.MethodGet, "/domains/example.com/zone-file")
@@ -5,30 +5,34 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"github.com/1f349/azalea/converters"
 	"github.com/1f349/azalea/database"
 	"github.com/1f349/azalea/models"
+	"github.com/1f349/azalea/utils"
 	"github.com/1f349/mjwt"
-	validateDomain "github.com/chmike/domain"
 	"github.com/gobuffalo/nulls"
 	"github.com/julienschmidt/httprouter"
 	"github.com/miekg/dns"
 	"net/http"
 	"strconv"
-	"strings"
 )
 
 type recordQueries interface {
-	AddZoneRecord(ctx context.Context, params database.AddZoneRecordParams) (int64, error)
+	AddZoneRecordWithJournal(ctx context.Context, params database.AddZoneRecordParams) (int64, error)
 	GetZone(ctx context.Context, zone string) (database.Zone, error)
 	GetZoneRecordById(ctx context.Context, params database.GetZoneRecordByIdParams) (database.Record, error)
-	PutZoneRecordById(ctx context.Context, params database.PutZoneRecordByIdParams) error
-	DeleteZoneRecordById(ctx context.Context, params database.DeleteZoneRecordByIdParams) error
+	PutZoneRecordByIdWithJournal(ctx context.Context, params database.PutZoneRecordByIdParams) error
+	DeleteZoneRecordByIdWithJournal(ctx context.Context, params database.DeleteZoneRecordByIdParams) error
 }
 
 type recordResolver interface {
 	GetZoneRecords(ctx context.Context, zone string) ([]*models.Record, error)
 }
 
+type zoneNotifier interface {
+	Notify(zone string)
+}
+
 type recordValue struct {
 	Id    uint64          `json:"id"` // allow this field even though it is ignored
 	Name  string          `json:"name"`
@@ -37,7 +41,7 @@ type recordValue struct {
 	Value json.RawMessage `json:"value"`
 }
 
-func AddRecordEndpoints(r *httprouter.Router, db recordQueries, res recordResolver, verify *mjwt.KeyStore) {
+func AddRecordEndpoints(r *httprouter.Router, db recordQueries, res recordResolver, notify zoneNotifier, verify *mjwt.KeyStore) {
 	// Endpoints for records
 	r.POST("/domains/:domain/records", checkAuthWithPerm(verify, "azalea:domains", func(rw http.ResponseWriter, req *http.Request, params httprouter.Params, b AuthClaims) {
 		domain := dns.Fqdn(params.ByName("domain"))
@@ -56,17 +60,22 @@ func AddRecordEndpoints(r *httprouter.Router, db recordQueries, res recordResolv
 			return
 		}
 
-		err = validateRecordName(a.Name)
+		err = utils.ValidateRecordName(a.Name)
 		if err != nil {
 			apiError(rw, http.StatusBadRequest, "Invalid record name")
 			return
 		}
 
-		if _, validType := dns.TypeToString[a.Type]; !validType {
+		if _, validType := dns.TypeToString[a.Type]; !validType && !converters.IsGeneric(a.Type) {
 			apiError(rw, http.StatusBadRequest, "Invalid record type")
 			return
 		}
 
+		if !validTtl(a.Ttl) {
+			apiError(rw, http.StatusBadRequest, "Invalid TTL")
+			return
+		}
+
 		value, done := parseRecordValue(rw, a)
 		if done {
 			return
@@ -77,17 +86,19 @@ func AddRecordEndpoints(r *httprouter.Router, db recordQueries, res recordResolv
 			apiError(rw, http.StatusInternalServerError, "Internal database error")
 			return
 		}
-		recordId, err := db.AddZoneRecord(req.Context(), database.AddZoneRecordParams{
+		recordId, err := db.AddZoneRecordWithJournal(req.Context(), database.AddZoneRecordParams{
 			Zone:   zone.ID,
 			Name:   a.Name,
-			Type:   dns.TypeToString[a.Type],
+			Type:   models.TypeToString(a.Type),
 			Locked: false,
+			Ttl:    a.Ttl,
 			Value:  value,
 		})
 		if err != nil {
 			apiError(rw, http.StatusInternalServerError, "Internal database error")
 			return
 		}
+		notify.Notify(domain)
 		rw.WriteHeader(http.StatusCreated)
 		_ = json.NewEncoder(rw).Encode(struct {
 			ID int64 `json:"id"`
@@ -157,6 +168,7 @@ func AddRecordEndpoints(r *httprouter.Router, db recordQueries, res recordResolv
 		// decode json data
 		var a struct {
 			Id    uint64          `json:"id"`
+			Ttl   nulls.UInt32    `json:"ttl"`
 			Value json.RawMessage `json:"value"`
 		}
 		dec := json.NewDecoder(req.Body)
@@ -166,6 +178,10 @@ func AddRecordEndpoints(r *httprouter.Router, db recordQueries, res recordResolv
 			apiError(rw, http.StatusBadRequest, "Invalid JSON: "+err.Error())
 			return
 		}
+		if !validTtl(a.Ttl) {
+			apiError(rw, http.StatusBadRequest, "Invalid TTL")
+			return
+		}
 
 		zone, err := db.GetZone(req.Context(), domain)
 		if err != nil {
@@ -196,14 +212,15 @@ func AddRecordEndpoints(r *httprouter.Router, db recordQueries, res recordResolv
 
 		value, done := parseRecordValue(rw, recordValue{
 			Name:  zoneRecord.Name,
-			Type:  dns.StringToType[zoneRecord.Type],
+			Type:  models.StringToType(zoneRecord.Type),
 			Value: a.Value,
 		})
 		if done {
 			return
 		}
 
-		err = db.PutZoneRecordById(req.Context(), database.PutZoneRecordByIdParams{
+		err = db.PutZoneRecordByIdWithJournal(req.Context(), database.PutZoneRecordByIdParams{
+			Ttl:   a.Ttl,
 			Value: value,
 			Zone:  zone.ID,
 			ID:    int32(recordId),
@@ -212,6 +229,7 @@ func AddRecordEndpoints(r *httprouter.Router, db recordQueries, res recordResolv
 			apiError(rw, http.StatusInternalServerError, "Internal database error")
 			return
 		}
+		notify.Notify(domain)
 
 		rw.WriteHeader(http.StatusOK)
 	}))
@@ -251,7 +269,7 @@ func AddRecordEndpoints(r *httprouter.Router, db recordQueries, res recordResolv
 			return
 		}
 
-		err = db.DeleteZoneRecordById(req.Context(), database.DeleteZoneRecordByIdParams{
+		err = db.DeleteZoneRecordByIdWithJournal(req.Context(), database.DeleteZoneRecordByIdParams{
 			Zone: zone.ID,
 			ID:   int32(recordId),
 		})
@@ -259,6 +277,7 @@ func AddRecordEndpoints(r *httprouter.Router, db recordQueries, res recordResolv
 			apiError(rw, http.StatusInternalServerError, "Internal database error")
 			return
 		}
+		notify.Notify(domain)
 
 		rw.WriteHeader(http.StatusOK)
 	}))
@@ -270,6 +289,14 @@ func parseRecordValue(rw http.ResponseWriter, a recordValue) (string, bool) {
 	switch a.Type {
 	case dns.TypeMX:
 		tmpValue = new(models.MX)
+	case dns.TypeNS:
+		// NS records below the apex delegate to a child zone, the apex NS
+		// records are generated from the config
+		if a.Name == "@" {
+			apiError(rw, http.StatusBadRequest, "NS records are not allowed at the zone apex")
+			return "", true
+		}
+		tmpValue = new(models.NS)
 	case dns.TypeA:
 		tmpValue = new(models.A)
 	case dns.TypeAAAA:
@@ -280,13 +307,40 @@ func parseRecordValue(rw http.ResponseWriter, a recordValue) (string, bool) {
 		tmpValue = new(models.TXT)
 	case dns.TypeSRV:
 		tmpValue = new(models.SRV)
+	case dns.TypePTR:
+		tmpValue = new(models.PTR)
+	case dns.TypeNAPTR:
+		tmpValue = new(models.NAPTR)
+	case dns.TypeSSHFP:
+		tmpValue = new(models.SSHFP)
+	case dns.TypeTLSA:
+		tmpValue = new(models.TLSA)
+	case dns.TypeDS:
+		// DS records belong in the parent zone
+		if a.Name == "@" {
+			apiError(rw, http.StatusBadRequest, "DS records are not allowed at the zone apex")
+			return "", true
+		}
+		tmpValue = new(models.DS)
+	case dns.TypeURI:
+		tmpValue = new(models.URI)
+	case dns.TypeDNAME:
+		tmpValue = new(models.DNAME)
+	case dns.TypeSVCB:
+		tmpValue = new(models.SVCB)
+	case dns.TypeHTTPS:
+		tmpValue = new(models.HTTPS)
+	case models.TypeALIAS:
+		tmpValue = new(models.ALIAS)
 	case dns.TypeCAA:
-		// TODO(melon): implement this
-		apiError(rw, http.StatusNotImplemented, "Not Implemented")
-		return "", true
+		tmpValue = new(models.CAA)
 	default:
-		apiError(rw, http.StatusBadRequest, "Invalid record type")
-		return "", true
+		// types without a model use the RFC 3597 representation
+		if !converters.IsGeneric(a.Type) {
+			apiError(rw, http.StatusBadRequest, "Invalid record type")
+			return "", true
+		}
+		tmpValue = &models.Generic{Type: a.Type}
 	}
 	err := json.Unmarshal(a.Value, &tmpValue)
 	if err != nil {
@@ -301,11 +355,10 @@ func parseRecordValue(rw http.ResponseWriter, a recordValue) (string, bool) {
 	return value, false
 }
 
-func validateRecordName(name string) error {
-	if name == "@" || name == "*" {
-		return nil
-	}
-	name = strings.TrimPrefix(name, "*.")
-	name = strings.ReplaceAll(name, "_", "")
-	return validateDomain.Check(name)
+// maxTtl is the largest TTL allowed by RFC 2181
+const maxTtl = 1<<31 - 1
+
+// validTtl checks the TTL is empty or within the range allowed by RFC 2181
+func validTtl(ttl nulls.UInt32) bool {
+	return !ttl.Valid || ttl.UInt32 <= maxTtl
 }
@@ -20,10 +20,19 @@ import (
 type fakeRecordQueries struct {
 }
 
-func (f *fakeRecordQueries) AddZoneRecord(ctx context.Context, params database.AddZoneRecordParams) (int64, error) {
-	if params.Zone == 1 && params.Name == "ns1" && params.Type == "A" {
+func (f *fakeRecordQueries) AddZoneRecordWithJournal(ctx context.Context, params database.AddZoneRecordParams) (int64, error) {
+	if params.Zone == 1 && params.Name == "ns1" && params.Type == "A" && params.Ttl.UInt32 == 60 {
 		return 5, nil
 	}
+	if params.Zone == 1 && params.Name == "@" && params.Type == "CAA" && params.Value == "0\tissue\tletsencrypt.org" {
+		return 6, nil
+	}
+	if params.Zone == 1 && params.Name == "dev" && params.Type == "NS" && params.Value == "ns1.dev.example.com." {
+		return 8, nil
+	}
+	if params.Zone == 1 && params.Name == "@" && params.Type == "TYPE65000" && params.Value == `\# 4 0a000001` {
+		return 7, nil
+	}
 	panic("not implemented")
 }
 
@@ -64,18 +73,30 @@ func (f *fakeRecordQueries) GetZoneRecordById(ctx context.Context, params databa
 	panic("not implemented")
 }
 
-func (f *fakeRecordQueries) PutZoneRecordById(ctx context.Context, params database.PutZoneRecordByIdParams) error {
+func (f *fakeRecordQueries) PutZoneRecordByIdWithJournal(ctx context.Context, params database.PutZoneRecordByIdParams) error {
+	if params.Ttl.UInt32 != 60 {
+		panic("wrong ttl")
+	}
 	return nil
 }
 
-func (f *fakeRecordQueries) DeleteZoneRecordById(ctx context.Context, params database.DeleteZoneRecordByIdParams) error {
+func (f *fakeRecordQueries) DeleteZoneRecordByIdWithJournal(ctx context.Context, params database.DeleteZoneRecordByIdParams) error {
 	return nil
 }
 
+type fakeNotifier struct {
+	zones []string
+}
+
+func (f *fakeNotifier) Notify(zone string) {
+	f.zones = append(f.zones, zone)
+}
+
 func TestAddRecordEndpoints(t *testing.T) {
 	r := httprouter.New()
 	signer := genSigner(t)
-	AddRecordEndpoints(r, &fakeRecordQueries{}, &fakeResolver{}, signer.KeyStore())
+	notify := &fakeNotifier{}
+	AddRecordEndpoints(r, &fakeRecordQueries{}, &fakeResolver{}, notify, signer.KeyStore())
 
 	makeToken := func() string {
 		ps := auth.NewPermStorage()
@@ -96,9 +117,36 @@ func TestAddRecordEndpoints(t *testing.T) {
 		req = makeReq("{")
 		req.Header.Set("Authorization", "Bearer "+makeToken())
 		doTestRequest(t, "invalid json", req, r, http.StatusBadRequest, "Invalid JSON: unexpected EOF")
-		req = makeReq(`{"name":"ns1","type":1,"value":"10.23.41.5"}`)
+		req = makeReq(`{"name":"ns1","type":1,"ttl":-1,"value":"10.23.41.5"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "invalid ttl", req, r, http.StatusBadRequest, "Invalid TTL")
+		req = makeReq(`{"name":"ns1","type":1,"ttl":60,"value":"10.23.41.5"}`)
 		req.Header.Set("Authorization", "Bearer "+makeToken())
 		doTestRequest(t, "ok", req, r, http.StatusCreated, `{"id":5}`)
+		req = makeReq(`{"name":"@","type":257,"value":{"flag":0,"tag":"bad-tag","value":"letsencrypt.org"}}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "invalid caa", req, r, http.StatusBadRequest, "Invalid record: invalid CAA tag")
+		req = makeReq(`{"name":"@","type":257,"value":{"flag":0,"tag":"issue","value":"letsencrypt.org"}}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "ok caa", req, r, http.StatusCreated, `{"id":6}`)
+		req = makeReq(`{"name":"@","type":43,"value":{"key_tag":12345,"algorithm":13,"digest_type":2,"digest":"abcd"}}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "ds at apex", req, r, http.StatusBadRequest, "DS records are not allowed at the zone apex")
+		req = makeReq(`{"name":"@","type":65000,"value":"\\# 4 0A000001"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "ok generic", req, r, http.StatusCreated, `{"id":7}`)
+		req = makeReq(`{"name":"@","type":65000,"value":"\\# 5 0a000001"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "invalid generic length", req, r, http.StatusBadRequest, "Invalid record: RFC 3597 length does not match data")
+		req = makeReq(`{"name":"@","type":46,"value":"\\# 0"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "generic rrsig", req, r, http.StatusBadRequest, "Invalid record type")
+		req = makeReq(`{"name":"@","type":2,"value":"ns1.example.net"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "ns at apex", req, r, http.StatusBadRequest, "NS records are not allowed at the zone apex")
+		req = makeReq(`{"name":"dev","type":2,"value":"ns1.dev.example.com"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "ok delegation", req, r, http.StatusCreated, `{"id":8}`)
 	})
 	t.Run("GET domains :domain records", func(t *testing.T) {
 		makeReq := baseMakeReq(http.MethodGet, "/domains/example.com/records")
@@ -188,7 +236,10 @@ func TestAddRecordEndpoints(t *testing.T) {
 		req = baseMakeReq(http.MethodPut, "/domains/example.com/records/1")(`{"value":"10.0.26.5"}`)
 		req.Header.Set("Authorization", "Bearer "+makeToken())
 		doTestRequest(t, "record locked", req, r, http.StatusConflict, "Record locked")
-		req = makeReq(`{"value":"10.0.26.5"}`)
+		req = makeReq(`{"ttl":-1,"value":"10.0.26.5"}`)
+		req.Header.Set("Authorization", "Bearer "+makeToken())
+		doTestRequest(t, "invalid ttl", req, r, http.StatusBadRequest, "Invalid TTL")
+		req = makeReq(`{"ttl":60,"value":"10.0.26.5"}`)
 		req.Header.Set("Authorization", "Bearer "+makeToken())
 		doTestRequest(t, "ok", req, r, http.StatusOK, "")
 	})
@@ -206,4 +257,6 @@ func TestAddRecordEndpoints(t *testing.T) {
 		req.Header.Set("Authorization", "Bearer "+makeToken())
 		doTestRequest(t, "ok", req, r, http.StatusOK, "")
 	})
+
+	assert.Equal(t, []string{"example.com.", "example.com.", "example.com.", "example.com.", "example.com.", "example.com."}, notify.zones)
 }
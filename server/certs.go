@@ -0,0 +1,108 @@
+package server
+
+import (
+	"crypto/tls"
+	"github.com/1f349/azalea/logger"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertLoader provides the certificate for the DNS-over-TLS listener, the
+// certificate is reloaded when the certificate or key file is modified
+type CertLoader struct {
+	certPath string
+	keyPath  string
+
+	mu            *sync.RWMutex
+	cert          *tls.Certificate
+	modTime       time.Time
+	lastCheck     time.Time
+	checkInterval time.Duration
+}
+
+func NewCertLoader(certPath, keyPath string) (*CertLoader, error) {
+	c := &CertLoader{
+		certPath:      certPath,
+		keyPath:       keyPath,
+		mu:            new(sync.RWMutex),
+		checkInterval: 10 * time.Second,
+	}
+	modTime, err := c.filesModTime()
+	if err != nil {
+		return nil, err
+	}
+	err = c.load(modTime)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate, the files are checked
+// for changes at most once every check interval
+func (c *CertLoader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	cert, lastCheck := c.cert, c.lastCheck
+	c.mu.RUnlock()
+	if time.Since(lastCheck) < c.checkInterval {
+		return cert, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.lastCheck) < c.checkInterval {
+		return c.cert, nil
+	}
+	c.lastCheck = time.Now()
+	modTime, err := c.filesModTime()
+	if err != nil {
+		logger.Logger.Warn("Failed to check TLS certificate", "err", err)
+		return c.cert, nil
+	}
+	if modTime.Equal(c.modTime) {
+		return c.cert, nil
+	}
+
+	// keep using the old certificate if the new files are invalid
+	err = c.loadLocked(modTime)
+	if err != nil {
+		logger.Logger.Warn("Failed to reload TLS certificate", "err", err)
+		return c.cert, nil
+	}
+	logger.Logger.Info("Reloaded TLS certificate", "cert", c.certPath)
+	return c.cert, nil
+}
+
+// filesModTime returns the latest modification time of the certificate and key
+func (c *CertLoader) filesModTime() (time.Time, error) {
+	certStat, err := os.Stat(c.certPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	keyStat, err := os.Stat(c.keyPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if keyStat.ModTime().After(certStat.ModTime()) {
+		return keyStat.ModTime(), nil
+	}
+	return certStat.ModTime(), nil
+}
+
+func (c *CertLoader) load(modTime time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.loadLocked(modTime)
+}
+
+func (c *CertLoader) loadLocked(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		return err
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	c.lastCheck = time.Now()
+	return nil
+}
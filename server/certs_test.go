@@ -0,0 +1,74 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate and key to the paths
+func writeTestCert(t *testing.T, certPath, keyPath, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+	}, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func TestCertLoader_GetCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	writeTestCert(t, certPath, keyPath, "ns1.example.com")
+
+	c, err := NewCertLoader(certPath, keyPath)
+	assert.NoError(t, err)
+	cert, err := c.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "ns1.example.com", leaf.Subject.CommonName)
+
+	// the new certificate is loaded once the files change
+	c.checkInterval = 0
+	writeTestCert(t, certPath, keyPath, "ns2.example.com")
+	future := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certPath, future, future))
+	cert, err = c.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "ns2.example.com", leaf.Subject.CommonName)
+
+	// an invalid certificate keeps the previous certificate
+	assert.NoError(t, os.WriteFile(certPath, []byte("invalid"), 0600))
+	future = future.Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certPath, future, future))
+	cert, err = c.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "ns2.example.com", leaf.Subject.CommonName)
+}
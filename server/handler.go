@@ -9,7 +9,14 @@ import (
 )
 
 type Handler struct {
-	resolver *resolver.Resolver
+	resolver       *resolver.Resolver
+	transferAcl    TransferAcl
+	notifyReceiver NotifyReceiver
+	updater        *Updater
+
+	// udp limits the response size to fit in the UDP payload size of the
+	// request
+	udp bool
 
 	responseTimer  metrics.Timer
 	requestCounter metrics.Counter
@@ -24,9 +31,25 @@ func (h *Handler) Handle(response dns.ResponseWriter, req *dns.Msg) {
 			logger.Logger.Debug("Handling incoming query with no question")
 		}
 
+		if req.Opcode == dns.OpcodeNotify {
+			h.serveNotify(response, req)
+			return
+		}
+		if req.Opcode == dns.OpcodeUpdate {
+			h.serveUpdate(response, req)
+			return
+		}
+		if len(req.Question) == 1 && (req.Question[0].Qtype == dns.TypeAXFR || req.Question[0].Qtype == dns.TypeIXFR) {
+			h.serveTransfer(response, req)
+			return
+		}
+
 		var msg *dns.Msg
 		msg = h.resolver.Lookup(context.Background(), req, response.RemoteAddr())
 		if msg != nil {
+			if h.udp {
+				msg.Truncate(udpSize(req))
+			}
 			err := response.WriteMsg(msg)
 			if err != nil {
 				logger.Logger.Error("Error writing message", "err", err)
@@ -36,3 +59,13 @@ func (h *Handler) Handle(response dns.ResponseWriter, req *dns.Msg) {
 		logger.Logger.Debug("Sent response", "addr", response.RemoteAddr())
 	})
 }
+
+// udpSize returns the largest response size which can be sent to the client
+// over UDP, this is 512 bytes without EDNS
+func udpSize(req *dns.Msg) int {
+	opt := req.IsEdns0()
+	if opt == nil {
+		return dns.MinMsgSize
+	}
+	return int(min(max(opt.UDPSize(), dns.MinMsgSize), resolver.MaxUdpSize))
+}
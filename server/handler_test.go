@@ -0,0 +1,124 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/resolver"
+	"github.com/1f349/azalea/secondary"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestUdpSize(t *testing.T) {
+	for _, i := range []struct {
+		edns bool
+		size uint16
+		want int
+	}{
+		{false, 0, 512},
+		{true, 100, 512},
+		{true, 1232, 1232},
+		{true, 4096, resolver.MaxUdpSize},
+	} {
+		req := new(dns.Msg)
+		req.SetQuestion("example.com.", dns.TypeA)
+		if i.edns {
+			req.SetEdns0(i.size, false)
+		}
+		assert.Equal(t, i.want, udpSize(req))
+	}
+}
+
+func TestHandler_truncate(t *testing.T) {
+	soa, err := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 300")
+	assert.NoError(t, err)
+	var rrs []dns.RR
+	for i := 0; i < 40; i++ {
+		rr, err := dns.NewRR(fmt.Sprintf("big.example.com. 300 IN TXT \"record number %d with some padding\"", i))
+		assert.NoError(t, err)
+		rrs = append(rrs, rr)
+	}
+	store := secondary.NewStore()
+	store.Set(secondary.NewZone("example.com.", soa.(*dns.SOA), rrs))
+	res := resolver.NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}}, store, nil, nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	pc, err := net.ListenPacket("udp", ln.Addr().String())
+	assert.NoError(t, err)
+	srv := NewDnsServer(ln, pc, nil, res, nil, nil, nil)
+	srv.Run()
+	defer srv.Close()
+
+	exchange := func(net string, edns uint16) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion("big.example.com.", dns.TypeTXT)
+		if edns != 0 {
+			req.SetEdns0(edns, false)
+		}
+		c := &dns.Client{Net: net, UDPSize: 65535}
+		resp, _, err := c.Exchange(req, ln.Addr().String())
+		assert.NoError(t, err)
+		// the response was compressed when it was sent
+		resp.Compress = true
+		return resp
+	}
+
+	// without EDNS the response is limited to 512 bytes
+	resp := exchange("udp", 0)
+	assert.True(t, resp.Truncated)
+	assert.Less(t, resp.Len(), 513)
+	assert.Nil(t, resp.IsEdns0())
+
+	// the client buffer size is capped at the advertised size
+	resp = exchange("udp", 4096)
+	assert.True(t, resp.Truncated)
+	assert.LessOrEqual(t, resp.Len(), resolver.MaxUdpSize)
+	assert.NotNil(t, resp.IsEdns0())
+	assert.Equal(t, uint16(resolver.MaxUdpSize), resp.IsEdns0().UDPSize())
+
+	// TCP responses are not truncated
+	resp = exchange("tcp", 0)
+	assert.False(t, resp.Truncated)
+	assert.Len(t, resp.Answer, 40)
+}
+
+func TestHandler_tls(t *testing.T) {
+	soa, err := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 300")
+	assert.NoError(t, err)
+	a, err := dns.NewRR("www.example.com. 300 IN A 10.0.0.1")
+	assert.NoError(t, err)
+	store := secondary.NewStore()
+	store.Set(secondary.NewZone("example.com.", soa.(*dns.SOA), []dns.RR{a}))
+	res := resolver.NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}}, store, nil, nil)
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	writeTestCert(t, certPath, keyPath, "ns1.example.com")
+	certLoader, err := NewCertLoader(certPath, keyPath)
+	assert.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	pc, err := net.ListenPacket("udp", ln.Addr().String())
+	assert.NoError(t, err)
+	dotLn, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	tlsLn := tls.NewListener(dotLn, &tls.Config{GetCertificate: certLoader.GetCertificate})
+	srv := NewDnsServer(ln, pc, tlsLn, res, nil, nil, nil)
+	srv.Run()
+	defer srv.Close()
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	c := &dns.Client{Net: "tcp-tls", TLSConfig: &tls.Config{InsecureSkipVerify: true}}
+	resp, _, err := c.Exchange(req, dotLn.Addr().String())
+	assert.NoError(t, err)
+	assert.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+}
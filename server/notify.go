@@ -0,0 +1,118 @@
+package server
+
+import (
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/logger"
+	"github.com/miekg/dns"
+	"github.com/rcrowley/go-metrics"
+	"net"
+	"strings"
+	"time"
+)
+
+// NotifyReceiver is told about zones which NOTIFY messages are received for,
+// the return value is false if the zone is not transferred from a primary,
+// NotifyAllowed checks the message was sent by the primary
+type NotifyReceiver interface {
+	NotifyAllowed(addr net.Addr) bool
+	ReceiveNotify(zone string) bool
+}
+
+// serveNotify acknowledges a NOTIFY message and passes it to the receiver
+func (h *Handler) serveNotify(response dns.ResponseWriter, req *dns.Msg) {
+	if h.notifyReceiver == nil || len(req.Question) != 1 {
+		writeRcode(response, req, dns.RcodeRefused)
+		return
+	}
+	zone := req.Question[0].Name
+	if !h.notifyReceiver.NotifyAllowed(response.RemoteAddr()) {
+		logger.Logger.Warn("Refused NOTIFY", "zone", zone, "addr", response.RemoteAddr())
+		writeRcode(response, req, dns.RcodeRefused)
+		return
+	}
+	if !h.notifyReceiver.ReceiveNotify(zone) {
+		writeRcode(response, req, dns.RcodeNotAuth)
+		return
+	}
+	logger.Logger.Debug("Received NOTIFY", "zone", zone, "addr", response.RemoteAddr())
+
+	msg := new(dns.Msg)
+	msg.SetReply(req)
+	msg.Authoritative = true
+	err := response.WriteMsg(msg)
+	if err != nil {
+		logger.Logger.Error("Error writing message", "err", err)
+	}
+}
+
+// Notifier sends RFC 1996 NOTIFY messages to the secondary nameservers of a
+// zone when the zone changes
+type Notifier struct {
+	targets  map[string][]string
+	client   *dns.Client
+	attempts int
+	backoff  time.Duration
+}
+
+func NewNotifier(transfer map[string]conf.TransferConf) *Notifier {
+	targets := make(map[string][]string, len(transfer))
+	for zone, c := range transfer {
+		zone = dns.Fqdn(strings.ToLower(zone))
+		for _, i := range c.Notify {
+			if _, _, err := net.SplitHostPort(i); err != nil {
+				i = net.JoinHostPort(i, "53")
+			}
+			targets[zone] = append(targets[zone], i)
+		}
+	}
+	return &Notifier{
+		targets:  targets,
+		client:   &dns.Client{Net: "udp", Timeout: 2 * time.Second},
+		attempts: 5,
+		backoff:  time.Second,
+	}
+}
+
+// Notify sends a NOTIFY message for the zone to each configured target in the
+// background, failed messages are retried with an exponential backoff
+func (n *Notifier) Notify(zone string) {
+	zone = dns.Fqdn(strings.ToLower(zone))
+	for _, target := range n.targets[zone] {
+		go n.notifyTarget(zone, target)
+	}
+}
+
+func (n *Notifier) notifyTarget(zone, target string) {
+	sentCounter := metrics.GetOrRegisterCounter("notify."+target+".sent", metrics.DefaultRegistry)
+	retryCounter := metrics.GetOrRegisterCounter("notify."+target+".retries", metrics.DefaultRegistry)
+	failedCounter := metrics.GetOrRegisterCounter("notify."+target+".failed", metrics.DefaultRegistry)
+	lastSuccess := metrics.GetOrRegisterGauge("notify."+target+".last_success", metrics.DefaultRegistry)
+
+	backoff := n.backoff
+	for attempt := 1; attempt <= n.attempts; attempt++ {
+		if attempt > 1 {
+			retryCounter.Inc(1)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		msg := new(dns.Msg)
+		msg.SetNotify(zone)
+		resp, _, err := n.client.Exchange(msg, target)
+		if err != nil {
+			logger.Logger.Debug("Failed to send NOTIFY", "zone", zone, "target", target, "attempt", attempt, "err", err)
+			continue
+		}
+		if resp.Opcode != dns.OpcodeNotify || resp.Rcode != dns.RcodeSuccess {
+			logger.Logger.Debug("Invalid NOTIFY response", "zone", zone, "target", target, "attempt", attempt, "rcode", dns.RcodeToString[resp.Rcode])
+			continue
+		}
+
+		sentCounter.Inc(1)
+		lastSuccess.Update(time.Now().Unix())
+		return
+	}
+
+	failedCounter.Inc(1)
+	logger.Logger.Warn("Failed to deliver NOTIFY", "zone", zone, "target", target)
+}
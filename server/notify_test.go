@@ -0,0 +1,102 @@
+package server
+
+import (
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/resolver"
+	"github.com/1f349/azalea/secondary"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotifier_Notify(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	received := make(chan string, 1)
+	attempt := 0
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		attempt++
+		// drop the first message to check it is retried
+		if attempt == 1 {
+			return
+		}
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+		_ = w.WriteMsg(msg)
+		received <- req.Question[0].Name
+	})}
+	go func() { _ = srv.ActivateAndServe() }()
+	defer srv.Shutdown()
+
+	n := NewNotifier(map[string]conf.TransferConf{
+		"example.com": {Notify: []string{pc.LocalAddr().String()}},
+	})
+	n.client.Timeout = 100 * time.Millisecond
+	n.backoff = 10 * time.Millisecond
+	n.Notify("example.com.")
+
+	select {
+	case name := <-received:
+		assert.Equal(t, "example.com.", name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("NOTIFY was not received")
+	}
+}
+
+type fakeNotifyReceiver struct {
+	mu      sync.Mutex
+	primary net.IP
+	zones   []string
+}
+
+func (f *fakeNotifyReceiver) NotifyAllowed(addr net.Addr) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return addr.(*net.UDPAddr).IP.Equal(f.primary)
+}
+
+func (f *fakeNotifyReceiver) ReceiveNotify(zone string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.zones = append(f.zones, zone)
+	return zone == "example.com."
+}
+
+func TestHandler_notify(t *testing.T) {
+	store := secondary.NewStore()
+	res := resolver.NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}}, store, nil, nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	pc, err := net.ListenPacket("udp", ln.Addr().String())
+	assert.NoError(t, err)
+	receiver := &fakeNotifyReceiver{primary: net.IPv4(127, 0, 0, 2)}
+	srv := NewDnsServer(ln, pc, nil, res, nil, receiver, nil)
+	srv.Run()
+	defer srv.Close()
+
+	notify := func(zone string) int {
+		req := new(dns.Msg)
+		req.SetNotify(zone)
+		resp, _, err := new(dns.Client).Exchange(req, pc.LocalAddr().String())
+		assert.NoError(t, err)
+		return resp.Rcode
+	}
+
+	// only the primary can send NOTIFY messages
+	assert.Equal(t, dns.RcodeRefused, notify("example.com."))
+	receiver.mu.Lock()
+	assert.Empty(t, receiver.zones)
+	receiver.primary = net.IPv4(127, 0, 0, 1)
+	receiver.mu.Unlock()
+
+	assert.Equal(t, dns.RcodeSuccess, notify("example.com."))
+	assert.Equal(t, dns.RcodeNotAuth, notify("example.org."))
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	assert.Equal(t, []string{"example.com.", "example.org."}, receiver.zones)
+}
@@ -11,11 +11,15 @@ import (
 )
 
 type DnsServer struct {
-	tcpSocket net.Listener
-	udpSocket net.PacketConn
-	mu        *sync.RWMutex
-	resolver  *resolver.Resolver
-	closeFunc func()
+	tcpSocket      net.Listener
+	udpSocket      net.PacketConn
+	tlsSocket      net.Listener
+	mu             *sync.RWMutex
+	resolver       *resolver.Resolver
+	transferAcl    TransferAcl
+	notifyReceiver NotifyReceiver
+	updater        *Updater
+	closeFunc      func()
 }
 
 func (d *DnsServer) Run() {
@@ -31,11 +35,18 @@ func (d *DnsServer) Run() {
 
 	tcpDnsHandler := &Handler{
 		resolver:       d.resolver,
+		transferAcl:    d.transferAcl,
+		notifyReceiver: d.notifyReceiver,
+		updater:        d.updater,
 		requestCounter: tcpRequestCounter,
 		responseTimer:  tcpResponseTimer,
 	}
 	udpDnsHandler := &Handler{
 		resolver:       d.resolver,
+		transferAcl:    d.transferAcl,
+		notifyReceiver: d.notifyReceiver,
+		updater:        d.updater,
+		udp:            true,
 		requestCounter: udpRequestCounter,
 		responseTimer:  udpResponseTimer,
 	}
@@ -46,19 +57,36 @@ func (d *DnsServer) Run() {
 	tcpHandler.HandleFunc(".", tcpDnsHandler.Handle)
 	udpHandler.HandleFunc(".", udpDnsHandler.Handle)
 
+	servers := make([]*dns.Server, 0, 3)
+
+	// signed messages are verified by the server before they are handled
+	var tsigSecret map[string]string
+	acceptFunc := dns.DefaultMsgAcceptFunc
+	if d.updater != nil {
+		tsigSecret = d.updater.TsigSecrets()
+		acceptFunc = acceptUpdates
+	}
+
 	tcpServer := &dns.Server{
-		Listener:     d.tcpSocket,
-		Net:          "tcp",
-		Handler:      tcpHandler,
-		ReadTimeout:  2 * time.Second,
-		WriteTimeout: 2 * time.Second,
+		Listener:      d.tcpSocket,
+		Net:           "tcp",
+		Handler:       tcpHandler,
+		TsigSecret:    tsigSecret,
+		MsgAcceptFunc: acceptFunc,
+		ReadTimeout:   2 * time.Second,
+		WriteTimeout:  2 * time.Second,
 	}
 
 	udpServer := &dns.Server{
-		PacketConn:   d.udpSocket,
-		Net:          "udp",
-		Handler:      udpHandler,
-		UDPSize:      65535,
+		PacketConn:    d.udpSocket,
+		Net:           "udp",
+		Handler:       udpHandler,
+		TsigSecret:    tsigSecret,
+		MsgAcceptFunc: acceptFunc,
+
+		// this is only the buffer size for reading requests, the handler limits
+		// the size of responses
+		UDPSize:      dns.MaxMsgSize,
 		ReadTimeout:  2 * time.Second,
 		WriteTimeout: 2 * time.Second,
 	}
@@ -70,12 +98,45 @@ func (d *DnsServer) Run() {
 		}
 	}
 
-	go start(tcpServer)
-	go start(udpServer)
+	servers = append(servers, tcpServer, udpServer)
+
+	// the DNS-over-TLS listener is optional
+	if d.tlsSocket != nil {
+		tlsResponseTimer := metrics.NewTimer()
+		metrics.Register("request.handler.tls.response_time", tlsResponseTimer)
+		tlsRequestCounter := metrics.NewCounter()
+		metrics.Register("request.handler.tls.requests", tlsRequestCounter)
+
+		tlsDnsHandler := &Handler{
+			resolver:       d.resolver,
+			transferAcl:    d.transferAcl,
+			notifyReceiver: d.notifyReceiver,
+			updater:        d.updater,
+			requestCounter: tlsRequestCounter,
+			responseTimer:  tlsResponseTimer,
+		}
+		tlsHandler := dns.NewServeMux()
+		tlsHandler.HandleFunc(".", tlsDnsHandler.Handle)
+
+		servers = append(servers, &dns.Server{
+			Listener:      d.tlsSocket,
+			Net:           "tcp-tls",
+			Handler:       tlsHandler,
+			TsigSecret:    tsigSecret,
+			MsgAcceptFunc: acceptFunc,
+			ReadTimeout:   2 * time.Second,
+			WriteTimeout:  2 * time.Second,
+		})
+	}
+
+	for _, server := range servers {
+		go start(server)
+	}
 
 	d.closeFunc = func() {
-		_ = tcpServer.Shutdown()
-		_ = udpServer.Shutdown()
+		for _, server := range servers {
+			_ = server.Shutdown()
+		}
 	}
 }
 
@@ -85,11 +146,18 @@ func (d *DnsServer) Close() {
 	}
 }
 
-func NewDnsServer(tcpSocket net.Listener, udpSocket net.PacketConn, res *resolver.Resolver) *DnsServer {
+// NewDnsServer creates a DNS server for the TCP and UDP sockets, tlsSocket is
+// an optional listener for DNS-over-TLS which must already be wrapped with
+// tls.NewListener, dynamic updates are refused if updater is nil
+func NewDnsServer(tcpSocket net.Listener, udpSocket net.PacketConn, tlsSocket net.Listener, res *resolver.Resolver, transferAcl TransferAcl, notifyReceiver NotifyReceiver, updater *Updater) *DnsServer {
 	return &DnsServer{
-		tcpSocket: tcpSocket,
-		udpSocket: udpSocket,
-		mu:        new(sync.RWMutex),
-		resolver:  res,
+		tcpSocket:      tcpSocket,
+		udpSocket:      udpSocket,
+		tlsSocket:      tlsSocket,
+		mu:             new(sync.RWMutex),
+		resolver:       res,
+		transferAcl:    transferAcl,
+		notifyReceiver: notifyReceiver,
+		updater:        updater,
 	}
 }
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/logger"
+	"github.com/1f349/azalea/models"
+	"github.com/miekg/dns"
+	"github.com/rcrowley/go-metrics"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// maxEnvelopeSize is the approximate number of bytes of records sent in each
+// message of a zone transfer
+const maxEnvelopeSize = 16 * 1024
+
+// TransferAcl holds the peers allowed to request zone transfers for each zone
+type TransferAcl map[string][]netip.Prefix
+
+// NewTransferAcl parses the allowed transfer peers from the config, each entry
+// can be an IP address or a CIDR prefix
+func NewTransferAcl(transfer map[string]conf.TransferConf) (TransferAcl, error) {
+	acl := make(TransferAcl, len(transfer))
+	for zone, c := range transfer {
+		zone = dns.Fqdn(strings.ToLower(zone))
+		prefixes := make([]netip.Prefix, 0, len(c.Allow))
+		for _, i := range c.Allow {
+			if !strings.Contains(i, "/") {
+				addr, err := netip.ParseAddr(i)
+				if err != nil {
+					return nil, fmt.Errorf("invalid transfer peer for %s: %w", zone, err)
+				}
+				prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+			prefix, err := netip.ParsePrefix(i)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transfer peer for %s: %w", zone, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		}
+		acl[zone] = prefixes
+	}
+	return acl, nil
+}
+
+// Allowed checks if the remote address may request a transfer of the zone
+func (t TransferAcl) Allowed(zone string, addr net.Addr) bool {
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := addrPort.Addr().Unmap()
+	for _, prefix := range t[zone] {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveTransfer answers AXFR and IXFR queries by streaming the zone records
+// with the SOA record at the start and end of the transfer
+func (h *Handler) serveTransfer(response dns.ResponseWriter, req *dns.Msg) {
+	q := req.Question[0]
+	zone := dns.Fqdn(strings.ToLower(q.Name))
+	ctx := context.Background()
+
+	typeStr := strings.ToLower(dns.TypeToString[q.Qtype])
+	requestCounter := metrics.GetOrRegisterCounter("transfer."+typeStr+".requests", metrics.DefaultRegistry)
+	refusedCounter := metrics.GetOrRegisterCounter("transfer."+typeStr+".refused", metrics.DefaultRegistry)
+	requestCounter.Inc(1)
+
+	_, isTcp := response.RemoteAddr().(*net.TCPAddr)
+
+	// full transfers are only allowed over TCP
+	if !isTcp && q.Qtype == dns.TypeAXFR {
+		refusedCounter.Inc(1)
+		writeRcode(response, req, dns.RcodeRefused)
+		return
+	}
+	if !h.transferAcl.Allowed(zone, response.RemoteAddr()) {
+		logger.Logger.Warn("Refused zone transfer", "zone", zone, "type", dns.TypeToString[q.Qtype], "addr", response.RemoteAddr())
+		refusedCounter.Inc(1)
+		writeRcode(response, req, dns.RcodeRefused)
+		return
+	}
+
+	if q.Qtype == dns.TypeIXFR {
+		serial, ok := ixfrSerial(req)
+		if !ok {
+			writeRcode(response, req, dns.RcodeFormatError)
+			return
+		}
+		changes, covered, err := h.resolver.GetZoneChanges(ctx, zone, serial)
+		if err != nil {
+			h.transferError(response, req, zone, err)
+			return
+		}
+		if !isTcp {
+			sendUdpIxfr(response, req, changes, covered)
+			return
+		}
+		if covered {
+			logger.Logger.Info("Starting incremental zone transfer", "zone", zone, "addr", response.RemoteAddr(), "serial", serial)
+			err = sendTransfer(response, req, transferRRs(changes))
+			if err != nil {
+				logger.Logger.Error("Zone transfer failed", "zone", zone, "err", err)
+			}
+			return
+		}
+		// fall back to a full transfer when the journal does not cover the
+		// requested serial
+	}
+
+	records, err := h.resolver.GetZoneRecords(ctx, zone)
+	if err != nil {
+		h.transferError(response, req, zone, err)
+		return
+	}
+
+	rrs := make([]dns.RR, 1, len(records)+2)
+	var soa dns.RR
+	for _, rr := range transferRRs(records) {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			soa = rr
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+	if soa == nil {
+		writeRcode(response, req, dns.RcodeServerFailure)
+		return
+	}
+	rrs[0] = soa
+	rrs = append(rrs, soa)
+
+	logger.Logger.Info("Starting zone transfer", "zone", zone, "addr", response.RemoteAddr(), "records", len(rrs))
+	err = sendTransfer(response, req, rrs)
+	if err != nil {
+		logger.Logger.Error("Zone transfer failed", "zone", zone, "err", err)
+	}
+}
+
+// sendUdpIxfr replies to an IXFR query over UDP as described in RFC 1995
+// section 2, the changes are sent if they fit in a single message otherwise only
+// the current SOA record is sent which tells the secondary to retry over TCP
+func sendUdpIxfr(response dns.ResponseWriter, req *dns.Msg, changes []*models.Record, covered bool) {
+	msg := new(dns.Msg)
+	msg.SetReply(req)
+	msg.Authoritative = true
+	msg.Answer = transferRRs(changes)
+	if !covered || msg.Len() > udpSize(req) {
+		msg.Answer = msg.Answer[:1]
+	}
+	err := response.WriteMsg(msg)
+	if err != nil {
+		logger.Logger.Error("Error writing message", "err", err)
+	}
+}
+
+// transferError replies with the rcode matching an error from loading a zone
+func (h *Handler) transferError(response dns.ResponseWriter, req *dns.Msg, zone string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeRcode(response, req, dns.RcodeNotAuth)
+		return
+	}
+	logger.Logger.Error("Failed to load zone for transfer", "zone", zone, "err", err)
+	writeRcode(response, req, dns.RcodeServerFailure)
+}
+
+// ixfrSerial returns the serial from the SOA record in the authority section of
+// an IXFR query
+func ixfrSerial(req *dns.Msg) (uint32, bool) {
+	if len(req.Ns) != 1 {
+		return 0, false
+	}
+	soa, ok := req.Ns[0].(*dns.SOA)
+	if !ok {
+		return 0, false
+	}
+	return soa.Serial, true
+}
+
+// transferRRs converts the records into dns.RR values for a zone transfer
+func transferRRs(records []*models.Record) []dns.RR {
+	rrs := make([]dns.RR, 0, len(records))
+	for _, i := range records {
+		rrs = append(rrs, i.RR(i.TtlOr(models.DefaultTtl)))
+	}
+	return rrs
+}
+
+// sendTransfer streams the records to the client in envelopes of roughly
+// maxEnvelopeSize bytes
+func sendTransfer(response dns.ResponseWriter, req *dns.Msg, rrs []dns.RR) error {
+	ch := make(chan *dns.Envelope)
+	tr := new(dns.Transfer)
+
+	var wg sync.WaitGroup
+	var outErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		outErr = tr.Out(response, req, ch)
+		// drain the channel if the transfer is interrupted
+		for range ch {
+		}
+	}()
+
+	env := make([]dns.RR, 0)
+	size := 0
+	for _, rr := range rrs {
+		env = append(env, rr)
+		size += dns.Len(rr)
+		if size >= maxEnvelopeSize {
+			ch <- &dns.Envelope{RR: env}
+			env = make([]dns.RR, 0)
+			size = 0
+		}
+	}
+	if len(env) > 0 {
+		ch <- &dns.Envelope{RR: env}
+	}
+	close(ch)
+	wg.Wait()
+	return outErr
+}
+
+// writeRcode replies to the request with an empty message and the rcode
+func writeRcode(response dns.ResponseWriter, req *dns.Msg, rcode int) {
+	msg := new(dns.Msg)
+	msg.SetRcode(req, rcode)
+	err := response.WriteMsg(msg)
+	if err != nil {
+		logger.Logger.Error("Error writing message", "err", err)
+	}
+}
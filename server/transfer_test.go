@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/resolver"
+	"github.com/1f349/azalea/secondary"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestTransferAcl_Allowed(t *testing.T) {
+	acl, err := NewTransferAcl(map[string]conf.TransferConf{
+		"Example.com": {Allow: []string{"192.0.2.1", "2001:db8::/32"}},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		zone    string
+		addr    net.Addr
+		allowed bool
+	}{
+		{"example.com.", &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5353}, true},
+		{"example.com.", &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 5353}, false},
+		{"example.com.", &net.TCPAddr{IP: net.ParseIP("2001:db8::53"), Port: 5353}, true},
+		{"example.org.", &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5353}, false},
+	}
+	for _, i := range tests {
+		assert.Equal(t, i.allowed, acl.Allowed(i.zone, i.addr), i.addr.String())
+	}
+
+	_, err = NewTransferAcl(map[string]conf.TransferConf{
+		"example.com": {Allow: []string{"not an ip"}},
+	})
+	assert.Error(t, err)
+}
+
+// newTestTransferServer serves example.com from a secondary store with enough
+// records to need several envelopes, transfers are only allowed from localhost
+func newTestTransferServer(t *testing.T) (*DnsServer, string) {
+	soa, err := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 300")
+	assert.NoError(t, err)
+	var rrs []dns.RR
+	for i := 0; i < 500; i++ {
+		rr, err := dns.NewRR(fmt.Sprintf("host%d.example.com. 300 IN TXT \"record number %d with some padding\"", i, i))
+		assert.NoError(t, err)
+		rrs = append(rrs, rr)
+	}
+	store := secondary.NewStore()
+	store.Set(secondary.NewZone("example.com.", soa.(*dns.SOA), rrs))
+	res := resolver.NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}, Mbox: "hostmaster.example.com."}, store, nil, nil)
+
+	acl, err := NewTransferAcl(map[string]conf.TransferConf{
+		"example.com": {Allow: []string{"127.0.0.1"}},
+		"example.org": {Allow: []string{"127.0.0.1"}},
+	})
+	assert.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	pc, err := net.ListenPacket("udp", ln.Addr().String())
+	assert.NoError(t, err)
+	srv := NewDnsServer(ln, pc, nil, res, acl, nil, nil)
+	srv.Run()
+	return srv, ln.Addr().String()
+}
+
+func TestHandler_axfr(t *testing.T) {
+	srv, addr := newTestTransferServer(t)
+	defer srv.Close()
+
+	req := new(dns.Msg)
+	req.SetAxfr("example.com.")
+	env, err := new(dns.Transfer).In(req, addr)
+	assert.NoError(t, err)
+
+	var envelopes int
+	var rrs []dns.RR
+	for i := range env {
+		assert.NoError(t, i.Error)
+		envelopes++
+		rrs = append(rrs, i.RR...)
+	}
+
+	// the records are split across several messages
+	assert.Greater(t, envelopes, 1)
+
+	// the SOA record is first and last, the NS record and every TXT record is
+	// sent once between them
+	assert.Len(t, rrs, 503)
+	assert.Equal(t, dns.TypeSOA, rrs[0].Header().Rrtype)
+	assert.Equal(t, rrs[0].String(), rrs[len(rrs)-1].String())
+	for _, rr := range rrs[1 : len(rrs)-1] {
+		assert.NotEqual(t, dns.TypeSOA, rr.Header().Rrtype)
+	}
+	assert.Equal(t, uint32(1), rrs[0].(*dns.SOA).Serial)
+}
+
+func TestHandler_axfrRefused(t *testing.T) {
+	srv, addr := newTestTransferServer(t)
+	defer srv.Close()
+
+	exchange := func(network, zone string) int {
+		req := new(dns.Msg)
+		req.SetAxfr(zone)
+		resp, _, err := (&dns.Client{Net: network}).Exchange(req, addr)
+		assert.NoError(t, err)
+		return resp.Rcode
+	}
+
+	// full transfers are only allowed over TCP
+	assert.Equal(t, dns.RcodeRefused, exchange("udp", "example.com."))
+
+	// zones without an ACL entry are refused
+	assert.Equal(t, dns.RcodeRefused, exchange("tcp", "example.net."))
+
+	// allowed zones which are not hosted are not authoritative
+	assert.Equal(t, dns.RcodeNotAuth, exchange("tcp", "example.org."))
+}
+
+// journalStore adds a journal to the in-memory store, entries are returned from
+// the first entry with the requested previous serial like the database query
+type journalStore struct {
+	*secondary.Store
+	journal []database.ZoneJournal
+}
+
+func (j *journalStore) GetJournalEntries(_ context.Context, arg database.GetJournalEntriesParams) ([]database.ZoneJournal, error) {
+	for n, i := range j.journal {
+		if i.PrevSerial == arg.PrevSerial {
+			return j.journal[n:], nil
+		}
+	}
+	return nil, nil
+}
+
+func TestHandler_ixfr(t *testing.T) {
+	soa, err := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 3 300 300 300 300")
+	assert.NoError(t, err)
+	rr, err := dns.NewRR("www.example.com. 300 IN A 10.0.0.3")
+	assert.NoError(t, err)
+
+	// serial 1 to 2 adds large TXT records which don't fit in a UDP response,
+	// serial 2 to 3 changes the address
+	store := &journalStore{Store: secondary.NewStore(), journal: []database.ZoneJournal{
+		{ID: 1, Zone: 1, PrevSerial: 1, Serial: 2, Name: "big", Type: "TXT", Value: strings.Repeat("a", 250)},
+		{ID: 2, Zone: 1, PrevSerial: 1, Serial: 2, Name: "big", Type: "TXT", Value: strings.Repeat("b", 250)},
+		{ID: 3, Zone: 1, PrevSerial: 2, Serial: 3, Deleted: true, Name: "www", Type: "A", Value: "10.0.0.2"},
+		{ID: 4, Zone: 1, PrevSerial: 2, Serial: 3, Name: "www", Type: "A", Value: "10.0.0.3"},
+	}}
+	store.Set(secondary.NewZone("example.com.", soa.(*dns.SOA), []dns.RR{rr}))
+	res := resolver.NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}, Mbox: "hostmaster.example.com."}, store, nil, nil)
+	acl, err := NewTransferAcl(map[string]conf.TransferConf{
+		"example.com": {Allow: []string{"127.0.0.1"}},
+	})
+	assert.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	pc, err := net.ListenPacket("udp", ln.Addr().String())
+	assert.NoError(t, err)
+	srv := NewDnsServer(ln, pc, nil, res, acl, nil, nil)
+	srv.Run()
+	defer srv.Close()
+
+	ixfr := func(network string, serial uint32) []dns.RR {
+		req := new(dns.Msg)
+		req.SetIxfr("example.com.", serial, "ns1.example.com.", "hostmaster.example.com.")
+		if network == "udp" {
+			resp, _, err := new(dns.Client).Exchange(req, ln.Addr().String())
+			assert.NoError(t, err)
+			assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+			return resp.Answer
+		}
+		env, err := new(dns.Transfer).In(req, ln.Addr().String())
+		assert.NoError(t, err)
+		var rrs []dns.RR
+		for i := range env {
+			assert.NoError(t, i.Error)
+			rrs = append(rrs, i.RR...)
+		}
+		return rrs
+	}
+	serials := func(rrs []dns.RR) []uint32 {
+		var s []uint32
+		for _, i := range rrs {
+			if soa, ok := i.(*dns.SOA); ok {
+				s = append(s, soa.Serial)
+			}
+		}
+		return s
+	}
+
+	// a small change is sent over UDP
+	rrs := ixfr("udp", 2)
+	assert.Len(t, rrs, 6)
+	assert.Equal(t, []uint32{3, 2, 3, 3}, serials(rrs))
+
+	// changes which don't fit only send the current SOA record so the
+	// secondary retries over TCP
+	rrs = ixfr("udp", 1)
+	assert.Len(t, rrs, 1)
+	assert.Equal(t, []uint32{3}, serials(rrs))
+	rrs = ixfr("tcp", 1)
+	assert.Len(t, rrs, 10)
+	assert.Equal(t, []uint32{3, 1, 2, 2, 3, 3}, serials(rrs))
+
+	// a serial missing from the journal falls back to a full zone transfer,
+	// over UDP this is only the current SOA record
+	rrs = ixfr("udp", 0)
+	assert.Equal(t, []uint32{3}, serials(rrs))
+	rrs = ixfr("tcp", 0)
+	assert.Len(t, rrs, 4)
+	assert.Equal(t, []uint32{3, 3}, serials(rrs))
+	assert.Equal(t, dns.TypeSOA, rrs[0].Header().Rrtype)
+	assert.Equal(t, dns.TypeSOA, rrs[3].Header().Rrtype)
+}
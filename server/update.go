@@ -0,0 +1,563 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/converters"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/logger"
+	"github.com/1f349/azalea/models"
+	"github.com/1f349/azalea/utils"
+	"github.com/gobuffalo/nulls"
+	"github.com/miekg/dns"
+	"github.com/rcrowley/go-metrics"
+	"slices"
+	"strings"
+	"time"
+)
+
+// UpdatePolicy holds the TSIG keys allowed to send RFC 2136 dynamic updates and
+// the changes each key may make
+type UpdatePolicy map[string]updateKey
+
+type updateKey struct {
+	algorithm string
+	secret    string
+	zones     []string
+	names     []string
+	types     []uint16
+}
+
+// NewUpdatePolicy parses the dynamic update keys from the config
+func NewUpdatePolicy(update map[string]conf.UpdateConf) (UpdatePolicy, error) {
+	policy := make(UpdatePolicy, len(update))
+	for name, c := range update {
+		name = dns.CanonicalName(name)
+		key := updateKey{
+			algorithm: dns.HmacSHA256,
+			secret:    c.Secret,
+		}
+		if c.Algorithm != "" {
+			key.algorithm = dns.CanonicalName(c.Algorithm)
+		}
+		switch key.algorithm {
+		case dns.HmacSHA1, dns.HmacSHA224, dns.HmacSHA256, dns.HmacSHA384, dns.HmacSHA512:
+		default:
+			return nil, fmt.Errorf("invalid update algorithm for %s: %s", name, c.Algorithm)
+		}
+		if _, err := base64.StdEncoding.DecodeString(c.Secret); err != nil || c.Secret == "" {
+			return nil, fmt.Errorf("invalid update secret for %s", name)
+		}
+		for _, zone := range c.Zones {
+			key.zones = append(key.zones, dns.CanonicalName(zone))
+		}
+		for _, i := range c.Names {
+			key.names = append(key.names, dns.CanonicalName(i))
+		}
+		for _, i := range c.Types {
+			rrtype := models.StringToType(strings.ToUpper(i))
+			if rrtype == dns.TypeNone {
+				return nil, fmt.Errorf("invalid update type for %s: %s", name, i)
+			}
+			key.types = append(key.types, rrtype)
+		}
+		policy[name] = key
+	}
+	return policy, nil
+}
+
+// TsigSecrets returns the secret of each key, the DNS server uses these to
+// verify signed messages
+func (u UpdatePolicy) TsigSecrets() map[string]string {
+	secrets := make(map[string]string, len(u))
+	for name, key := range u {
+		secrets[name] = key.secret
+	}
+	return secrets
+}
+
+// allowed checks if the key may change the name and type of the record in the
+// zone, a record with type ANY deletes every type so it is only allowed if
+// the key can change every type
+func (k updateKey) allowed(zone string, rr dns.RR) bool {
+	if !slices.Contains(k.zones, zone) {
+		return false
+	}
+	name := dns.CanonicalName(rr.Header().Name)
+	if len(k.names) > 0 && !slices.ContainsFunc(k.names, func(pattern string) bool {
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			return name != suffix && dns.IsSubDomain(suffix, name)
+		}
+		return name == pattern
+	}) {
+		return false
+	}
+	return len(k.types) == 0 || slices.Contains(k.types, rr.Header().Rrtype)
+}
+
+type updateQueries interface {
+	UpdateZoneWithJournal(ctx context.Context, zone string, fn func(zone database.Zone, records []database.Record) (deleted, added []database.Record, err error)) error
+}
+
+type zoneNotifier interface {
+	Notify(zone string)
+}
+
+// Updater applies RFC 2136 dynamic updates which are signed with a key from
+// the update policy
+type Updater struct {
+	policy UpdatePolicy
+	db     updateQueries
+	notify zoneNotifier
+}
+
+func NewUpdater(policy UpdatePolicy, db updateQueries, notify zoneNotifier) *Updater {
+	return &Updater{
+		policy: policy,
+		db:     db,
+		notify: notify,
+	}
+}
+
+// TsigSecrets returns the secrets of the update keys
+func (u *Updater) TsigSecrets() map[string]string {
+	return u.policy.TsigSecrets()
+}
+
+// updateTimeout limits the time spent applying a single dynamic update
+const updateTimeout = 10 * time.Second
+
+// acceptUpdates extends the default message checks to accept dynamic updates,
+// these can contain any number of records in the prerequisite and update
+// sections, an invalid zone section is replied to by Updater.Update so the
+// response can be signed
+func acceptUpdates(dh dns.Header) dns.MsgAcceptAction {
+	isResponse := dh.Bits&(1<<15) != 0
+	opcode := int(dh.Bits>>11) & 0xF
+	if isResponse || opcode != dns.OpcodeUpdate {
+		return dns.DefaultMsgAcceptFunc(dh)
+	}
+	return dns.MsgAccept
+}
+
+// updateError aborts the update transaction and is replied to with the rcode
+type updateError int
+
+func (e updateError) Error() string {
+	return "update failed: " + dns.RcodeToString[int(e)]
+}
+
+// serveUpdate applies a dynamic update which has been signed with TSIG, the
+// response is signed with the same key
+func (h *Handler) serveUpdate(response dns.ResponseWriter, req *dns.Msg) {
+	requestCounter := metrics.GetOrRegisterCounter("update.requests", metrics.DefaultRegistry)
+	refusedCounter := metrics.GetOrRegisterCounter("update.refused", metrics.DefaultRegistry)
+	requestCounter.Inc(1)
+
+	tsig := req.IsTsig()
+	if h.updater == nil || tsig == nil {
+		refusedCounter.Inc(1)
+		writeRcode(response, req, dns.RcodeRefused)
+		return
+	}
+	if err := response.TsigStatus(); err != nil {
+		logger.Logger.Warn("Refused update with invalid TSIG", "key", tsig.Hdr.Name, "addr", response.RemoteAddr(), "err", err)
+		refusedCounter.Inc(1)
+		writeRcode(response, req, dns.RcodeNotAuth)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+	rcode := h.updater.Update(ctx, tsig.Hdr.Name, tsig.Algorithm, req)
+	if rcode == dns.RcodeRefused {
+		logger.Logger.Warn("Refused update", "key", tsig.Hdr.Name, "addr", response.RemoteAddr())
+		refusedCounter.Inc(1)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetRcode(req, rcode)
+	msg.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	err := response.WriteMsg(msg)
+	if err != nil {
+		logger.Logger.Error("Error writing message", "err", err)
+	}
+}
+
+// Update checks the prerequisites and applies the changes in the update
+// message, the key name and algorithm must be from a verified TSIG record
+func (u *Updater) Update(ctx context.Context, keyName, algorithm string, req *dns.Msg) int {
+	if len(req.Question) != 1 || req.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	if req.Question[0].Qclass != dns.ClassINET {
+		return dns.RcodeNotAuth
+	}
+	zone := dns.CanonicalName(req.Question[0].Name)
+
+	key, ok := u.policy[dns.CanonicalName(keyName)]
+	if !ok || dns.CanonicalName(algorithm) != key.algorithm || !slices.Contains(key.zones, zone) {
+		return dns.RcodeRefused
+	}
+	if rcode := prescanUpdates(zone, req.Ns); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+	for _, rr := range req.Ns {
+		if !key.allowed(zone, rr) {
+			return dns.RcodeRefused
+		}
+	}
+
+	var changed bool
+	err := u.db.UpdateZoneWithJournal(ctx, zone, func(zoneRow database.Zone, records []database.Record) ([]database.Record, []database.Record, error) {
+		current, err := newUpdateRecords(zoneRow, records)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rcode := checkPrerequisites(zone, current, req.Answer); rcode != dns.RcodeSuccess {
+			return nil, nil, updateError(rcode)
+		}
+		deleted, added, err := applyUpdates(zone, current, req.Ns)
+		changed = len(deleted) > 0 || len(added) > 0
+		return deleted, added, err
+	})
+	var updateErr updateError
+	switch {
+	case err == nil:
+	case errors.As(err, &updateErr):
+		return int(updateErr)
+	case errors.Is(err, sql.ErrNoRows):
+		return dns.RcodeNotAuth
+	default:
+		logger.Logger.Error("Failed to apply update", "zone", zone, "err", err)
+		return dns.RcodeServerFailure
+	}
+
+	if changed {
+		logger.Logger.Info("Applied dynamic update", "zone", zone, "key", keyName)
+		u.notify.Notify(zone)
+	}
+	return dns.RcodeSuccess
+}
+
+// updateRecord is a stored record or a record added by the update, new
+// records have an ID of zero
+type updateRecord struct {
+	record database.Record
+	rr     dns.RR
+}
+
+// newUpdateRecords converts the zone records so they can be compared with the
+// records in the update, location resolving records are not real records so
+// updates can't change them
+func newUpdateRecords(zoneRow database.Zone, records []database.Record) ([]updateRecord, error) {
+	current := make([]updateRecord, 0, len(records))
+	for _, i := range records {
+		if i.IsLocationResolving() {
+			continue
+		}
+		record, err := i.ConvertRecord(zoneRow.Name)
+		if err != nil {
+			return nil, err
+		}
+		rr := record.RR(record.TtlOr(zoneRow.DefaultTtl))
+		rr.Header().Name = dns.CanonicalName(rr.Header().Name)
+		current = append(current, updateRecord{record: i, rr: rr})
+	}
+	return current, nil
+}
+
+// isMetaType returns true for the types which can only be used in questions or
+// are only valid in a single message
+func isMetaType(rrtype uint16) bool {
+	return rrtype == dns.TypeOPT || (rrtype >= 128 && rrtype <= 255)
+}
+
+// emptyRdata returns true if the record from the request has no rdata, these
+// only match the name and type
+func emptyRdata(rr dns.RR) bool {
+	return rr.Header().Rdlength == 0
+}
+
+// updateValue converts a record from the update into the stored value and the
+// dns.RR used to compare it with the zone records
+func updateValue(rr dns.RR) (models.RecordValue, dns.RR, error) {
+	value, err := converters.FromRR(rr)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := rr.Header()
+	return value, value.ValueRR(dns.RR_Header{
+		Name:   dns.CanonicalName(h.Name),
+		Rrtype: h.Rrtype,
+		Class:  dns.ClassINET,
+		Ttl:    h.Ttl,
+	}), nil
+}
+
+// prescanUpdates checks the update section before the prerequisites are
+// checked, this is described in RFC 2136 section 3.4.1
+func prescanUpdates(zone string, updates []dns.RR) int {
+	for _, rr := range updates {
+		h := rr.Header()
+		name := dns.CanonicalName(h.Name)
+		if !dns.IsSubDomain(zone, name) {
+			return dns.RcodeNotZone
+		}
+		switch h.Class {
+		case dns.ClassINET:
+			if isMetaType(h.Rrtype) || emptyRdata(rr) {
+				return dns.RcodeFormatError
+			}
+			if rcode := checkAddedRecord(zone, name, rr); rcode != dns.RcodeSuccess {
+				return rcode
+			}
+			continue
+		case dns.ClassANY:
+			if h.Ttl != 0 || !emptyRdata(rr) || (isMetaType(h.Rrtype) && h.Rrtype != dns.TypeANY) {
+				return dns.RcodeFormatError
+			}
+			continue
+		case dns.ClassNONE:
+			if h.Ttl != 0 || isMetaType(h.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+		// records with rdata must be stored or compared with stored records,
+		// the generated apex records are ignored when the update is applied
+		if generatedAtApex(zone, name, h.Rrtype) {
+			continue
+		}
+		if _, _, err := updateValue(rr); err != nil {
+			return dns.RcodeRefused
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// checkAddedRecord applies the rules used by the API to a record added by the
+// update, the apex NS records are generated from the zone settings and DS
+// records belong in the parent zone
+func checkAddedRecord(zone, name string, rr dns.RR) int {
+	rrtype := rr.Header().Rrtype
+	if name == zone && (rrtype == dns.TypeNS || rrtype == dns.TypeDS) {
+		return dns.RcodeRefused
+	}
+	// the SOA record is generated from the zone settings
+	if generatedAtApex(zone, name, rrtype) {
+		return dns.RcodeSuccess
+	}
+	if utils.ValidateRecordName(utils.SimplifyRecordName(name, zone)) != nil {
+		return dns.RcodeRefused
+	}
+	value, _, err := updateValue(rr)
+	if err != nil || value.Validate() != nil {
+		return dns.RcodeRefused
+	}
+	if value.EncodeValue() == "" {
+		return dns.RcodeFormatError
+	}
+	return dns.RcodeSuccess
+}
+
+// generatedAtApex returns true for the apex records generated from the zone
+// settings, these always exist and can't be changed by updates
+func generatedAtApex(zone, name string, rrtype uint16) bool {
+	return name == zone && (rrtype == dns.TypeSOA || rrtype == dns.TypeNS)
+}
+
+// nameInUse returns true if the name has records of any type
+func nameInUse(zone string, current []updateRecord, name string) bool {
+	return name == zone || slices.ContainsFunc(current, func(i updateRecord) bool {
+		return i.rr.Header().Name == name
+	})
+}
+
+// rrsetExists returns true if the name has records of the type
+func rrsetExists(zone string, current []updateRecord, name string, rrtype uint16) bool {
+	return generatedAtApex(zone, name, rrtype) || slices.ContainsFunc(current, func(i updateRecord) bool {
+		return i.rr.Header().Name == name && i.rr.Header().Rrtype == rrtype
+	})
+}
+
+// checkPrerequisites checks the prerequisite section of an update, this is
+// described in RFC 2136 section 3.2
+func checkPrerequisites(zone string, current []updateRecord, prereqs []dns.RR) int {
+	type rrsetKey struct {
+		name   string
+		rrtype uint16
+	}
+	var keys []rrsetKey
+	valueDependent := make(map[rrsetKey][]dns.RR)
+
+	for _, rr := range prereqs {
+		h := rr.Header()
+		name := dns.CanonicalName(h.Name)
+		if h.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(zone, name) {
+			return dns.RcodeNotZone
+		}
+		switch h.Class {
+		case dns.ClassANY:
+			if !emptyRdata(rr) {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if !nameInUse(zone, current, name) {
+					return dns.RcodeNameError
+				}
+			} else if !rrsetExists(zone, current, name, h.Rrtype) {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if !emptyRdata(rr) {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if nameInUse(zone, current, name) {
+					return dns.RcodeYXDomain
+				}
+			} else if rrsetExists(zone, current, name, h.Rrtype) {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			_, valueRR, err := updateValue(rr)
+			if err != nil {
+				return dns.RcodeNXRrset
+			}
+			key := rrsetKey{name, h.Rrtype}
+			if _, ok := valueDependent[key]; !ok {
+				keys = append(keys, key)
+			}
+			valueDependent[key] = append(valueDependent[key], valueRR)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	// value dependent prerequisites must match the whole RRset
+	for _, key := range keys {
+		var rrset []dns.RR
+		for _, i := range current {
+			if i.rr.Header().Name == key.name && i.rr.Header().Rrtype == key.rrtype {
+				rrset = append(rrset, i.rr)
+			}
+		}
+		expected := valueDependent[key]
+		for _, rr := range rrset {
+			if !slices.ContainsFunc(expected, func(i dns.RR) bool { return dns.IsDuplicate(i, rr) }) {
+				return dns.RcodeNXRrset
+			}
+		}
+		for _, rr := range expected {
+			if !slices.ContainsFunc(rrset, func(i dns.RR) bool { return dns.IsDuplicate(i, rr) }) {
+				return dns.RcodeNXRrset
+			}
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// applyUpdates applies the update section in order, this is described in RFC
+// 2136 section 3.4.2, changes to locked records refuse the whole update
+func applyUpdates(zone string, current []updateRecord, updates []dns.RR) (deleted, added []database.Record, err error) {
+	remove := func(match func(i updateRecord) bool) error {
+		if slices.ContainsFunc(current, func(i updateRecord) bool { return match(i) && i.record.Locked }) {
+			return updateError(dns.RcodeRefused)
+		}
+		for _, i := range current {
+			if match(i) && i.record.ID != 0 {
+				deleted = append(deleted, i.record)
+			}
+		}
+		current = slices.DeleteFunc(current, match)
+		return nil
+	}
+
+	for _, rr := range updates {
+		h := rr.Header()
+		name := dns.CanonicalName(h.Name)
+		if generatedAtApex(zone, name, h.Rrtype) {
+			continue
+		}
+		atName := func(i updateRecord) bool { return i.rr.Header().Name == name }
+
+		switch h.Class {
+		case dns.ClassINET:
+			// a CNAME can't share the name with other types, the zone apex
+			// always has the generated SOA and NS records
+			if h.Rrtype == dns.TypeCNAME && (name == zone || slices.ContainsFunc(current, func(i updateRecord) bool {
+				return atName(i) && i.rr.Header().Rrtype != dns.TypeCNAME
+			})) {
+				continue
+			}
+			if h.Rrtype != dns.TypeCNAME && slices.ContainsFunc(current, func(i updateRecord) bool {
+				return atName(i) && i.rr.Header().Rrtype == dns.TypeCNAME
+			}) {
+				continue
+			}
+
+			// the value was checked by checkAddedRecord
+			value, valueRR, err := updateValue(rr)
+			if err != nil {
+				return nil, nil, updateError(dns.RcodeRefused)
+			}
+			encoded := value.EncodeValue()
+			// an existing record is only replaced if the TTL changes, there can
+			// only be a single CNAME at the name
+			if slices.ContainsFunc(current, func(i updateRecord) bool {
+				return dns.IsDuplicate(i.rr, valueRR) && i.rr.Header().Ttl == h.Ttl
+			}) {
+				continue
+			}
+			err = remove(func(i updateRecord) bool {
+				return dns.IsDuplicate(i.rr, valueRR) || (h.Rrtype == dns.TypeCNAME && atName(i))
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			current = append(current, updateRecord{
+				record: database.Record{
+					Name:  utils.SimplifyRecordName(name, zone),
+					Type:  models.TypeToString(h.Rrtype),
+					Ttl:   nulls.NewUInt32(h.Ttl),
+					Value: encoded,
+				},
+				rr: valueRR,
+			})
+		case dns.ClassANY:
+			err := remove(func(i updateRecord) bool {
+				return atName(i) && (h.Rrtype == dns.TypeANY || i.rr.Header().Rrtype == h.Rrtype)
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		case dns.ClassNONE:
+			_, valueRR, err := updateValue(rr)
+			if err != nil {
+				return nil, nil, updateError(dns.RcodeRefused)
+			}
+			err = remove(func(i updateRecord) bool {
+				return dns.IsDuplicate(i.rr, valueRR)
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	for _, i := range current {
+		if i.record.ID == 0 {
+			added = append(added, i.record)
+		}
+	}
+	return deleted, added, nil
+}
@@ -0,0 +1,518 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"github.com/1f349/azalea/conf"
+	"github.com/1f349/azalea/database"
+	"github.com/1f349/azalea/resolver"
+	"github.com/1f349/azalea/secondary"
+	"github.com/gobuffalo/nulls"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTsigSecret = "c2VjcmV0IHNlY3JldCBzZWNyZXQgc2VjcmV0IQ=="
+
+type fakeUpdateQueries struct {
+	zone    database.Zone
+	records []database.Record
+	deleted []database.Record
+	added   []database.Record
+}
+
+func (f *fakeUpdateQueries) UpdateZoneWithJournal(ctx context.Context, zone string, fn func(zone database.Zone, records []database.Record) (deleted, added []database.Record, err error)) error {
+	if zone != f.zone.Name {
+		return sql.ErrNoRows
+	}
+	deleted, added, err := fn(f.zone, slices.Clone(f.records))
+	if err != nil {
+		return err
+	}
+	f.deleted = deleted
+	f.added = added
+	return nil
+}
+
+type fakeZoneNotifier struct {
+	zones []string
+}
+
+func (f *fakeZoneNotifier) Notify(zone string) {
+	f.zones = append(f.zones, zone)
+}
+
+func newTestUpdater(t *testing.T) (*Updater, *fakeUpdateQueries, *fakeZoneNotifier) {
+	t.Helper()
+	policy, err := NewUpdatePolicy(map[string]conf.UpdateConf{
+		"admin": {Secret: testTsigSecret, Zones: []string{"example.com"}},
+		"certbot": {
+			Algorithm: "hmac-sha512",
+			Secret:    testTsigSecret,
+			Zones:     []string{"example.com"},
+			Names:     []string{"_acme-challenge.example.com", "*._acme.example.com"},
+			Types:     []string{"txt"},
+		},
+	})
+	assert.NoError(t, err)
+	db := &fakeUpdateQueries{
+		zone: database.Zone{ID: 1, Name: "example.com.", Serial: 1, DefaultTtl: 300},
+		records: []database.Record{
+			{ID: 1, Zone: 1, Name: "www", Type: "A", Value: "10.0.0.1"},
+			{ID: 2, Zone: 1, Name: "www", Type: "A", Value: "10.0.0.2"},
+			{ID: 3, Zone: 1, Name: "@", Type: "TXT", Locked: true, Value: "v=spf1 -all"},
+			{ID: 4, Zone: 1, Name: "alias", Type: "CNAME", Value: "www.example.com."},
+			{ID: 5, Zone: 1, Name: "_acme-challenge", Type: "TXT", Ttl: nulls.NewUInt32(60), Value: "old"},
+		},
+	}
+	notify := new(fakeZoneNotifier)
+	return NewUpdater(policy, db, notify), db, notify
+}
+
+// newTestUpdate creates an update message which has been packed and unpacked
+// so the records without rdata match the messages sent by clients
+func newTestUpdate(t *testing.T, zone string, build func(msg *dns.Msg)) *dns.Msg {
+	t.Helper()
+	msg := new(dns.Msg)
+	msg.SetUpdate(zone)
+	build(msg)
+	raw, err := msg.Pack()
+	assert.NoError(t, err)
+	out := new(dns.Msg)
+	assert.NoError(t, out.Unpack(raw))
+	return out
+}
+
+func mustRRs(t *testing.T, records ...string) []dns.RR {
+	t.Helper()
+	rrs := make([]dns.RR, 0, len(records))
+	for _, i := range records {
+		rr, err := dns.NewRR(i)
+		assert.NoError(t, err)
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
+
+func TestNewUpdatePolicy(t *testing.T) {
+	_, err := NewUpdatePolicy(map[string]conf.UpdateConf{"key": {Algorithm: "hmac-md5", Secret: testTsigSecret}})
+	assert.EqualError(t, err, "invalid update algorithm for key.: hmac-md5")
+	_, err = NewUpdatePolicy(map[string]conf.UpdateConf{"key": {Secret: "not base64"}})
+	assert.EqualError(t, err, "invalid update secret for key.")
+	_, err = NewUpdatePolicy(map[string]conf.UpdateConf{"key": {Secret: testTsigSecret, Types: []string{"BOGUS"}}})
+	assert.EqualError(t, err, "invalid update type for key.: BOGUS")
+
+	policy, err := NewUpdatePolicy(map[string]conf.UpdateConf{"Key": {Secret: testTsigSecret, Zones: []string{"Example.com"}, Types: []string{"txt", "TYPE65280"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, UpdatePolicy{"key.": {
+		algorithm: dns.HmacSHA256,
+		secret:    testTsigSecret,
+		zones:     []string{"example.com."},
+		types:     []uint16{dns.TypeTXT, 65280},
+	}}, policy)
+	assert.Equal(t, map[string]string{"key.": testTsigSecret}, policy.TsigSecrets())
+}
+
+func TestUpdateKey_allowed(t *testing.T) {
+	updater, _, _ := newTestUpdater(t)
+	key := updater.policy["certbot."]
+	for _, i := range []struct {
+		zone string
+		rr   string
+		want bool
+	}{
+		{"example.com.", "_acme-challenge.example.com. 60 IN TXT \"token\"", true},
+		{"example.com.", "_ACME-Challenge.example.com. 60 IN TXT \"token\"", true},
+		{"example.com.", "www._acme.example.com. 60 IN TXT \"token\"", true},
+		{"example.com.", "_acme.example.com. 60 IN TXT \"token\"", false},
+		{"example.com.", "www.example.com. 60 IN TXT \"token\"", false},
+		{"example.com.", "_acme-challenge.example.com. 60 IN A 10.0.0.1", false},
+		{"example.org.", "_acme-challenge.example.org. 60 IN TXT \"token\"", false},
+	} {
+		t.Run(i.rr, func(t *testing.T) {
+			assert.Equal(t, i.want, key.allowed(i.zone, mustRRs(t, i.rr)[0]))
+		})
+	}
+
+	// deleting every type at the name requires access to every type
+	anyRR := &dns.ANY{Hdr: dns.RR_Header{Name: "_acme-challenge.example.com.", Rrtype: dns.TypeANY, Class: dns.ClassANY}}
+	assert.False(t, key.allowed("example.com.", anyRR))
+	assert.True(t, updater.policy["admin."].allowed("example.com.", anyRR))
+}
+
+func TestUpdater_Update(t *testing.T) {
+	for _, i := range []struct {
+		name    string
+		key     string
+		zone    string
+		build   func(msg *dns.Msg)
+		rcode   int
+		deleted []int32
+		added   []database.Record
+	}{
+		{
+			name: "add txt",
+			key:  "certbot.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "_acme-challenge.example.com. 60 IN TXT \"token\""))
+			},
+			added: []database.Record{{Name: "_acme-challenge", Type: "TXT", Ttl: nulls.NewUInt32(60), Value: "token"}},
+		},
+		{
+			name: "replace rrset",
+			key:  "certbot.",
+			build: func(msg *dns.Msg) {
+				msg.RemoveRRset(mustRRs(t, "_acme-challenge.example.com. 60 IN TXT \"old\""))
+				msg.Insert(mustRRs(t, "_acme-challenge.example.com. 60 IN TXT \"token\""))
+			},
+			deleted: []int32{5},
+			added:   []database.Record{{Name: "_acme-challenge", Type: "TXT", Ttl: nulls.NewUInt32(60), Value: "token"}},
+		},
+		{
+			name: "existing record",
+			key:  "certbot.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "_acme-challenge.example.com. 60 IN TXT \"old\""))
+			},
+		},
+		{
+			name: "remove added record",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "new.example.com. 60 IN A 10.0.0.3"))
+				msg.Remove(mustRRs(t, "new.example.com. 60 IN A 10.0.0.3"))
+			},
+		},
+		{
+			name: "value dependent prerequisite",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Used(mustRRs(t, "www.example.com. 0 IN A 10.0.0.2", "www.example.com. 0 IN A 10.0.0.1"))
+				msg.Remove(mustRRs(t, "www.example.com. 0 IN A 10.0.0.1"))
+			},
+			deleted: []int32{1},
+		},
+		{
+			name: "value dependent prerequisite mismatch",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Used(mustRRs(t, "www.example.com. 0 IN A 10.0.0.1"))
+				msg.Remove(mustRRs(t, "www.example.com. 0 IN A 10.0.0.1"))
+			},
+			rcode: dns.RcodeNXRrset,
+		},
+		{
+			name: "rrset exists",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.RRsetUsed(mustRRs(t, "www.example.com. 0 IN AAAA ::1"))
+			},
+			rcode: dns.RcodeNXRrset,
+		},
+		{
+			name: "rrset does not exist",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.RRsetNotUsed(mustRRs(t, "example.com. 0 IN NS ns1.example.com."))
+			},
+			rcode: dns.RcodeYXRrset,
+		},
+		{
+			name: "name in use",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.NameUsed(mustRRs(t, "missing.example.com. 0 IN A 10.0.0.1"))
+			},
+			rcode: dns.RcodeNameError,
+		},
+		{
+			name: "name not in use",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.NameNotUsed(mustRRs(t, "www.example.com. 0 IN A 10.0.0.1"))
+				msg.Insert(mustRRs(t, "www.example.com. 60 IN A 10.0.0.3"))
+			},
+			rcode: dns.RcodeYXDomain,
+		},
+		{
+			name: "locked record",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.RemoveName(mustRRs(t, "example.com. 0 IN A 10.0.0.1"))
+			},
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name: "cname conflict",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "alias.example.com. 60 IN A 10.0.0.1", "www.example.com. 60 IN CNAME example.com."))
+			},
+		},
+		{
+			name: "replace cname",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "alias.example.com. 60 IN CNAME example.com."))
+			},
+			deleted: []int32{4},
+			added:   []database.Record{{Name: "alias", Type: "CNAME", Ttl: nulls.NewUInt32(60), Value: "example.com."}},
+		},
+		{
+			name: "apex records",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "example.com. 60 IN SOA ns1.example.com. hostmaster.example.com. 5 300 300 300 300"))
+				msg.RemoveRRset(mustRRs(t, "example.com. 0 IN NS ns1.example.com."))
+			},
+		},
+		{
+			name: "apex ns",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "example.com. 60 IN NS ns2.example.com."))
+			},
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name: "apex ds",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "example.com. 60 IN DS 12345 13 2 "+strings.Repeat("ab", 32)))
+			},
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name: "delegation ds",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "sub.example.com. 60 IN DS 12345 13 2 "+strings.Repeat("AB", 32)))
+			},
+			added: []database.Record{{Name: "sub", Type: "DS", Ttl: nulls.NewUInt32(60), Value: "12345\t13\t2\t" + strings.Repeat("ab", 32)}},
+		},
+		{
+			name: "invalid caa value",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, `www.example.com. 60 IN CAA 0 issue "ca.example.net\009x"`))
+			},
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name: "caa issuemail",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, `www.example.com. 60 IN CAA 0 issuemail "authority.example"`))
+			},
+			added: []database.Record{{Name: "www", Type: "CAA", Ttl: nulls.NewUInt32(60), Value: "0\tissuemail\tauthority.example"}},
+		},
+		{
+			name: "invalid caa tag",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, `www.example.com. 60 IN CAA 0 unknownpropertyx "value"`))
+			},
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name: "invalid record name",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "a\\009b.example.com. 60 IN A 10.0.0.3"))
+			},
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name: "no zone section",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Question = nil
+			},
+			rcode: dns.RcodeFormatError,
+		},
+		{
+			name: "unsupported type",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "www.example.com. 60 IN DNSKEY 257 3 13 AAAA"))
+			},
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name: "not zone",
+			key:  "admin.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "www.example.org. 60 IN A 10.0.0.1"))
+			},
+			rcode: dns.RcodeNotZone,
+		},
+		{
+			name: "policy name",
+			key:  "certbot.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "www.example.com. 60 IN TXT \"token\""))
+			},
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name: "policy zone",
+			key:  "admin.",
+			zone: "example.org.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "www.example.org. 60 IN A 10.0.0.1"))
+			},
+			rcode: dns.RcodeRefused,
+		},
+		{
+			name: "unknown key",
+			key:  "missing.",
+			build: func(msg *dns.Msg) {
+				msg.Insert(mustRRs(t, "www.example.com. 60 IN A 10.0.0.3"))
+			},
+			rcode: dns.RcodeRefused,
+		},
+	} {
+		t.Run(i.name, func(t *testing.T) {
+			updater, db, notify := newTestUpdater(t)
+			zone := i.zone
+			if zone == "" {
+				zone = "example.com."
+			}
+			req := newTestUpdate(t, zone, i.build)
+			algorithm := dns.HmacSHA256
+			if i.key == "certbot." {
+				algorithm = dns.HmacSHA512
+			}
+			assert.Equal(t, dns.RcodeToString[i.rcode], dns.RcodeToString[updater.Update(context.Background(), i.key, algorithm, req)])
+
+			var deleted []int32
+			for _, r := range db.deleted {
+				deleted = append(deleted, r.ID)
+			}
+			assert.Equal(t, i.deleted, deleted)
+			assert.Equal(t, i.added, db.added)
+			if len(i.deleted) > 0 || len(i.added) > 0 {
+				assert.Equal(t, []string{"example.com."}, notify.zones)
+			} else {
+				assert.Empty(t, notify.zones)
+			}
+		})
+	}
+
+	t.Run("apex cname", func(t *testing.T) {
+		// the generated SOA and NS records stop a CNAME being added at the apex
+		// even without stored records at the apex
+		updater, db, notify := newTestUpdater(t)
+		db.records = slices.DeleteFunc(db.records, func(r database.Record) bool {
+			return r.Name == "@"
+		})
+		req := newTestUpdate(t, "example.com.", func(msg *dns.Msg) {
+			msg.Insert(mustRRs(t, "example.com. 60 IN CNAME www.example.org."))
+		})
+		assert.Equal(t, dns.RcodeSuccess, updater.Update(context.Background(), "admin.", dns.HmacSHA256, req))
+		assert.Empty(t, db.added)
+		assert.Empty(t, notify.zones)
+	})
+
+	t.Run("long txt", func(t *testing.T) {
+		// DKIM keys are sent as several character-strings which are joined
+		// when stored and split again when the record is served
+		updater, db, _ := newTestUpdater(t)
+		rr := &dns.TXT{
+			Hdr: dns.RR_Header{Name: "dkim._domainkey.example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{"v=DKIM1; k=rsa; p=" + strings.Repeat("A", 237), strings.Repeat("B", 200)},
+		}
+		req := newTestUpdate(t, "example.com.", func(msg *dns.Msg) {
+			msg.Insert([]dns.RR{rr})
+		})
+		assert.Equal(t, dns.RcodeSuccess, updater.Update(context.Background(), "admin.", dns.HmacSHA256, req))
+		if !assert.Len(t, db.added, 1) {
+			return
+		}
+		assert.Len(t, db.added[0].Value, 455)
+
+		record, err := db.added[0].ConvertRecord("example.com.")
+		assert.NoError(t, err)
+		msg := new(dns.Msg)
+		msg.SetQuestion("dkim._domainkey.example.com.", dns.TypeTXT)
+		msg.Answer = []dns.RR{record.RR(60)}
+		_, err = msg.Pack()
+		assert.NoError(t, err)
+		assert.Equal(t, strings.Join(rr.Txt, ""), strings.Join(msg.Answer[0].(*dns.TXT).Txt, ""))
+	})
+
+	t.Run("wrong algorithm", func(t *testing.T) {
+		updater, _, _ := newTestUpdater(t)
+		req := newTestUpdate(t, "example.com.", func(msg *dns.Msg) {
+			msg.Insert(mustRRs(t, "_acme-challenge.example.com. 60 IN TXT \"token\""))
+		})
+		assert.Equal(t, dns.RcodeRefused, updater.Update(context.Background(), "certbot.", dns.HmacSHA256, req))
+	})
+}
+
+func TestHandler_update(t *testing.T) {
+	soa, err := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 300 300 300 300")
+	assert.NoError(t, err)
+	store := secondary.NewStore()
+	store.Set(secondary.NewZone("example.com.", soa.(*dns.SOA), nil))
+	res := resolver.NewResolver(conf.SoaConf{Ns: []string{"ns1.example.com."}}, store, nil, nil)
+
+	updater, db, notify := newTestUpdater(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	pc, err := net.ListenPacket("udp", ln.Addr().String())
+	assert.NoError(t, err)
+	srv := NewDnsServer(ln, pc, nil, res, nil, nil, updater)
+	srv.Run()
+	defer srv.Close()
+
+	exchange := func(secret string) (*dns.Msg, error) {
+		req := new(dns.Msg)
+		req.SetUpdate("example.com.")
+		req.Insert(mustRRs(t, "new.example.com. 60 IN A 10.0.0.3"))
+		c := &dns.Client{Net: "tcp"}
+		if secret != "" {
+			req.SetTsig("admin.", dns.HmacSHA256, 300, time.Now().Unix())
+			c.TsigSecret = map[string]string{"admin.": secret}
+		}
+		resp, _, err := c.Exchange(req, ln.Addr().String())
+		return resp, err
+	}
+
+	// unsigned updates are refused
+	resp, err := exchange("")
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+
+	// the response to an update signed with the wrong secret is not signed
+	resp, err = exchange("d3Jvbmcgc2VjcmV0")
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeNotAuth, resp.Rcode)
+	assert.Nil(t, resp.IsTsig())
+	assert.Empty(t, db.added)
+
+	// the client verifies the signed response
+	resp, err = exchange(testTsigSecret)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.NotNil(t, resp.IsTsig())
+	assert.Equal(t, []database.Record{{Name: "new", Type: "A", Ttl: nulls.NewUInt32(60), Value: "10.0.0.3"}}, db.added)
+	assert.Equal(t, []string{"example.com."}, notify.zones)
+
+	// an invalid zone section gets a signed FORMERR response
+	req := new(dns.Msg)
+	req.SetUpdate("example.com.")
+	req.Question = append(req.Question, req.Question[0])
+	req.SetTsig("admin.", dns.HmacSHA256, 300, time.Now().Unix())
+	c := &dns.Client{Net: "tcp", TsigSecret: map[string]string{"admin.": testTsigSecret}}
+	resp, _, err = c.Exchange(req, ln.Addr().String())
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeFormatError, resp.Rcode)
+	assert.NotNil(t, resp.IsTsig())
+}
@@ -1,6 +1,9 @@
 package utils
 
-import "strings"
+import (
+	validateDomain "github.com/chmike/domain"
+	"strings"
+)
 
 // ResolveRecordName expands shortened record names relative to the provided zone
 //
@@ -36,3 +39,14 @@ func SimplifyRecordName(name, zone string) string {
 	}
 	return strings.TrimSuffix(name, "."+zone)
 }
+
+// ValidateRecordName checks the shortened record name is "@", "*" or a valid
+// domain name which can start with a wildcard label and contain underscores
+func ValidateRecordName(name string) error {
+	if name == "@" || name == "*" {
+		return nil
+	}
+	name = strings.TrimPrefix(name, "*.")
+	name = strings.ReplaceAll(name, "_", "")
+	return validateDomain.Check(name)
+}